@@ -0,0 +1,187 @@
+package main
+
+import (
+	"backend-go/database"
+	"backend-go/encryption"
+	"backend-go/keys"
+	"backend-go/storage"
+	"backend-go/thumbnails"
+	"backend-go/totp"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// runEncryptDocuments chiffre les documents envoyés avant l'activation du
+// chiffrement. Chaque fichier est recopié chiffré sous une nouvelle clé de
+// stockage, la base pointe vers la copie, puis l'original et son aperçu en
+// clair sont supprimés ; l'aperçu est régénéré par le serveur
+func runEncryptDocuments(args []string) error {
+	flags := newFlagSet("encrypt-documents")
+	dryRun := flags.Bool("dry-run", false, "afficher les fichiers à chiffrer sans les modifier")
+	flags.Parse(args)
+
+	encryption.Init()
+	if !encryption.Enabled() {
+		return errors.New("DOCUMENT_ENCRYPTION_KEYS non configuré")
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT DISTINCT v.file_path, v.mime_type
+		FROM document_versions v
+		LEFT JOIN file_keys k ON k.storage_key = v.file_path
+		WHERE k.storage_key IS NULL
+		ORDER BY v.file_path`)
+	if err != nil {
+		return err
+	}
+	type plainFile struct{ path, mimeType string }
+	var files []plainFile
+	for rows.Next() {
+		var f plainFile
+		if err := rows.Scan(&f.path, &f.mimeType); err != nil {
+			rows.Close()
+			return err
+		}
+		files = append(files, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var encrypted, missing int
+	for _, f := range files {
+		if *dryRun {
+			fmt.Printf("%s\n", f.path)
+			encrypted++
+			continue
+		}
+
+		newKey, err := encryptFile(ctx, storage.KeyFromPath(f.path), f.mimeType)
+		if errors.Is(err, storage.ErrNotFound) {
+			fmt.Printf("%s\tintrouvable\n", f.path)
+			missing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		if newKey == "" {
+			fmt.Printf("%s\tdocument supprimé entre-temps\n", f.path)
+			continue
+		}
+		fmt.Printf("%s\t%s\tchiffré\n", f.path, newKey)
+		encrypted++
+	}
+
+	action := "chiffré(s)"
+	if *dryRun {
+		action = "à chiffrer"
+	}
+	fmt.Printf("%d fichier(s) %s, %d introuvable(s)\n", encrypted, action, missing)
+	return nil
+}
+
+// encryptFile recopie un fichier en clair sous une nouvelle clé chiffrée et
+// retourne cette clé, ou "" si plus aucune version ne référence le fichier
+func encryptFile(ctx context.Context, key, mimeType string) (string, error) {
+	reader, object, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	newKey := storage.NewKey("documents", "")
+	err = encryption.Put(ctx, database.DB, newKey, reader, object.Size, mimeType)
+	reader.Close()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE document_versions SET file_path = $2 WHERE file_path = $1", key, newKey)
+	if err != nil {
+		return "", err
+	}
+	rows, err := tx.Query(`
+		UPDATE documents SET file_path = $2, thumbnail_status = $3, thumbnail_attempts = 0, updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT id, thumbnail_key FROM documents WHERE file_path = $1 FOR UPDATE) old
+		WHERE documents.id = old.id
+		RETURNING old.thumbnail_key`,
+		key, newKey, thumbnails.StatusPending,
+	)
+	if err != nil {
+		return "", err
+	}
+	var oldThumbnails []string
+	for rows.Next() {
+		var thumbnailKey *string
+		if err := rows.Scan(&thumbnailKey); err != nil {
+			rows.Close()
+			return "", err
+		}
+		if thumbnailKey != nil {
+			oldThumbnails = append(oldThumbnails, *thumbnailKey)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		tx.Rollback()
+		return "", encryption.Delete(ctx, database.DB, newKey)
+	}
+	if err := tx.Commit(); err != nil {
+		encryption.Delete(ctx, database.DB, newKey)
+		return "", err
+	}
+
+	if err := storage.Default.Delete(ctx, key); err != nil {
+		fmt.Printf("  suppression de l'original impossible: %v\n", err)
+	}
+	for _, thumbnailKey := range oldThumbnails {
+		if err := encryption.Delete(ctx, database.DB, thumbnailKey); err != nil {
+			fmt.Printf("  suppression de l'aperçu %s impossible: %v\n", thumbnailKey, err)
+		}
+	}
+	return newKey, nil
+}
+
+// runRewrapKeys rechiffre immédiatement avec la clé maître active les clés de
+// fichiers enveloppées par une ancienne clé, les clés de signature JWT et les
+// secrets TOTP, sans attendre le serveur
+func runRewrapKeys(args []string) error {
+	flags := newFlagSet("rewrap-keys")
+	flags.Parse(args)
+
+	encryption.Init()
+	if !encryption.Enabled() {
+		return errors.New("DOCUMENT_ENCRYPTION_KEYS non configuré")
+	}
+
+	rewrapped, err := encryption.Rewrap(context.Background(), database.DB)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d clé(s) de fichiers rechiffrée(s)\n", rewrapped)
+
+	sealed, err := keys.Rewrap(context.Background(), database.DB)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d clé(s) de signature rechiffrée(s)\n", sealed)
+
+	secrets, err := totp.Rewrap(context.Background(), database.DB)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d secret(s) TOTP rechiffré(s)\n", secrets)
+	return nil
+}
@@ -0,0 +1,107 @@
+// Commande sycadmin : tâches d'exploitation du backend Save Your Car.
+//
+//	go run ./cmd/sycadmin <commande> [options]
+//
+// La connexion à la base utilise les mêmes variables DB_* que le serveur.
+package main
+
+import (
+	"backend-go/database"
+	"backend-go/storage"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/joho/godotenv"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands map[string]command
+
+// Les commandes sont déclarées dans init : leurs options affichent l'aide de commands
+func init() {
+	commands = map[string]command{
+		"migrate":                 {"migrate [up | down -steps N | status]", runMigrate},
+		"create-user":             {"create-user -email E -name N [-password P] [-role user|garage|admin]", runCreateUser},
+		"promote":                 {"promote -email E -role user|garage|admin", runPromote},
+		"reset-password":          {"reset-password -email E [-password P]", runResetPassword},
+		"transfer-vehicle":        {"transfer-vehicle -vehicle ID -to EMAIL", runTransferVehicle},
+		"reconcile-subscriptions": {"reconcile-subscriptions [-dry-run]", runReconcileSubscriptions},
+		"purge-reset-tokens":      {"purge-reset-tokens", runPurgeResetTokens},
+		"reconcile-storage":       {"reconcile-storage [-dry-run] [-grace 24h]", runReconcileStorage},
+		"migrate-storage":         {"migrate-storage [-from uploads] [-dry-run]", runMigrateStorage},
+		"purge-documents":         {"purge-documents [-dry-run]", runPurgeDocuments},
+		"encrypt-documents":       {"encrypt-documents [-dry-run]", runEncryptDocuments},
+		"rewrap-keys":             {"rewrap-keys", runRewrapKeys},
+	}
+}
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("Fichier .env non trouvé, utilisation des variables d'environnement système")
+	}
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Commande inconnue: %s\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	// Le schéma n'est pas migré automatiquement : c'est le rôle de "migrate"
+	database.Open()
+	defer database.DB.Close()
+	storage.Init()
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Erreur: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: sycadmin <commande> [options]")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Commandes :")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+// newFlagSet crée le jeu d'options d'une commande, qui s'arrête en cas d'erreur
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: sycadmin %s\n", commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// required vérifie que les options obligatoires sont renseignées
+func required(flags *flag.FlagSet, values map[string]string) error {
+	for name, value := range values {
+		if value == "" {
+			flags.Usage()
+			return fmt.Errorf("option -%s requise", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"backend-go/database"
+	"backend-go/reconcile"
+	"backend-go/retention"
+	"backend-go/storage"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func runPurgeResetTokens(args []string) error {
+	flags := newFlagSet("purge-reset-tokens")
+	flags.Parse(args)
+
+	result, err := database.DB.Exec("DELETE FROM password_reset_tokens WHERE expires_at < CURRENT_TIMESTAMP OR used = TRUE")
+	if err != nil {
+		return err
+	}
+
+	purged, _ := result.RowsAffected()
+	fmt.Printf("%d token(s) de réinitialisation supprimé(s)\n", purged)
+	return nil
+}
+
+// runPurgeDocuments supprime définitivement les documents supprimés depuis
+// plus de DOCUMENT_RETENTION, sans attendre le passage du serveur
+func runPurgeDocuments(args []string) error {
+	flags := newFlagSet("purge-documents")
+	dryRun := flags.Bool("dry-run", false, "afficher les documents à purger sans les supprimer")
+	flags.Parse(args)
+
+	retention.Init()
+	report, err := retention.PurgeDeletedDocuments(context.Background(), database.DB, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range report.Documents {
+		for _, key := range document.Keys {
+			fmt.Printf("%d\t%s\n", document.ID, key)
+		}
+	}
+
+	action := "purgé(s)"
+	if *dryRun {
+		action = "à purger"
+	}
+	fmt.Printf("%d document(s) %s, %d fichier(s), %d suppression(s) en échec (rétention %s)\n",
+		len(report.Documents), action, report.Files, report.Failed, retention.DocumentRetention)
+	return nil
+}
+
+// runReconcileStorage compare le stockage aux références en base, comme le
+// serveur une fois par jour : fichiers orphelins supprimés après le délai de
+// grâce, fichiers manquants relevés dans missing_files
+func runReconcileStorage(args []string) error {
+	flags := newFlagSet("reconcile-storage")
+	dryRun := flags.Bool("dry-run", false, "afficher le rapport sans rien supprimer ni relever")
+	grace := flags.Duration("grace", 24*time.Hour, "ignorer les fichiers orphelins plus récents (upload en cours)")
+	flags.Parse(args)
+
+	reconcile.GracePeriod = *grace
+	report, err := reconcile.Run(context.Background(), database.DB, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range report.Orphans {
+		fmt.Printf("orphelin\t%s\t%d\t%s\n", object.Key, object.Size, object.ModTime.Format("2006-01-02 15:04"))
+	}
+	for _, ref := range report.Missing {
+		fmt.Printf("manquant\t%s\t%s %d\n", ref.Key, ref.Source, ref.RecordID)
+	}
+
+	action := "supprimé(s)"
+	if *dryRun {
+		action = "à supprimer"
+	}
+	fmt.Printf("%d fichier(s) parcouru(s) : %d orphelin(s) %s (%d octets, %d en échec), %d fichier(s) manquant(s), %d clé(s) de chiffrement sans fichier\n",
+		report.Scanned, len(report.Orphans), action, report.OrphanBytes, report.Failed, len(report.Missing), report.DanglingKeys)
+	return nil
+}
+
+// runMigrateStorage copie les fichiers référencés en base depuis un dossier
+// local vers le stockage configuré (STORAGE_BACKEND), par exemple avant de
+// passer en S3. Les fichiers déjà présents sont ignorés
+func runMigrateStorage(args []string) error {
+	flags := newFlagSet("migrate-storage")
+	from := flags.String("from", "uploads", "dossier local des fichiers uploadés")
+	dryRun := flags.Bool("dry-run", false, "afficher les fichiers à copier sans les copier")
+	flags.Parse(args)
+
+	ctx := context.Background()
+	references, err := reconcile.References(ctx, database.DB)
+	if err != nil {
+		return err
+	}
+	referenced := reconcile.ReferencedKeys(references)
+
+	source := storage.NewLocal(*from)
+	var copied, skipped, missing int
+	for key := range referenced {
+		if _, err := storage.Default.Stat(ctx, key); err == nil {
+			skipped++
+			continue
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		reader, object, err := source.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			fmt.Printf("%s\tabsent de %s\n", key, *from)
+			missing++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		if *dryRun {
+			reader.Close()
+			fmt.Printf("%s\t%d\n", key, object.Size)
+			copied++
+			continue
+		}
+
+		err = storage.Default.Put(ctx, key, reader, object.Size, object.ContentType)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		fmt.Printf("%s\t%d\tcopié\n", key, object.Size)
+		copied++
+	}
+
+	action := "copié(s)"
+	if *dryRun {
+		action = "à copier"
+	}
+	fmt.Printf("%d fichier(s) %s, %d déjà présent(s), %d introuvable(s)\n", copied, action, skipped, missing)
+	return nil
+}
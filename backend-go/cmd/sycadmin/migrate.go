@@ -0,0 +1,52 @@
+package main
+
+import (
+	"backend-go/database"
+	"backend-go/migrations"
+	"fmt"
+)
+
+func runMigrate(args []string) error {
+	action := "up"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	flags := newFlagSet("migrate")
+	steps := flags.Int("steps", 1, "nombre de migrations à annuler (down)")
+	flags.Parse(args)
+
+	switch action {
+	case "up":
+		applied, err := migrations.Up(database.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) appliquée(s)\n", applied)
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("-steps doit être supérieur à 0")
+		}
+		reverted, err := migrations.Down(database.DB, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) annulée(s)\n", reverted)
+	case "status":
+		states, err := migrations.Status(database.DB)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "en attente"
+			if state.AppliedAt != nil {
+				applied = "appliquée le " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s %s\n", state.Version, state.Name, applied)
+		}
+	default:
+		flags.Usage()
+		return fmt.Errorf("action inconnue: %s", action)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/subscription"
+)
+
+// runReconcileSubscriptions réaligne la table subscriptions sur Stripe, par
+// exemple après des webhooks perdus
+func runReconcileSubscriptions(args []string) error {
+	flags := newFlagSet("reconcile-subscriptions")
+	dryRun := flags.Bool("dry-run", false, "afficher les écarts sans modifier la base")
+	flags.Parse(args)
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	if stripe.Key == "" {
+		return errors.New("STRIPE_SECRET_KEY non configurée")
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, user_id, stripe_subscription_id, stripe_price_id, status,
+		       current_period_start, current_period_end
+		FROM subscriptions ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		var sub models.Subscription
+		err := rows.Scan(&sub.ID, &sub.UserID, &sub.StripeSubscriptionID, &sub.StripePriceID, &sub.Status,
+			&sub.CurrentPeriodStart, &sub.CurrentPeriodEnd)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	updated, failed := 0, 0
+	for _, local := range subscriptions {
+		remote, err := subscription.Get(local.StripeSubscriptionID, nil)
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+			// L'abonnement n'existe plus chez Stripe : il ne doit plus donner accès
+			remote = &stripe.Subscription{
+				Status:             stripe.SubscriptionStatusCanceled,
+				CurrentPeriodStart: local.CurrentPeriodStart.Unix(),
+				CurrentPeriodEnd:   local.CurrentPeriodEnd.Unix(),
+			}
+		} else if err != nil {
+			fmt.Printf("Abonnement %s : erreur Stripe: %v\n", local.StripeSubscriptionID, err)
+			failed++
+			continue
+		}
+
+		priceID := local.StripePriceID
+		if remote.Items != nil && len(remote.Items.Data) > 0 && remote.Items.Data[0].Price != nil {
+			priceID = remote.Items.Data[0].Price.ID
+		}
+		periodStart := time.Unix(remote.CurrentPeriodStart, 0)
+		periodEnd := time.Unix(remote.CurrentPeriodEnd, 0)
+
+		if string(remote.Status) == local.Status && priceID == local.StripePriceID &&
+			periodStart.Equal(local.CurrentPeriodStart) && periodEnd.Equal(local.CurrentPeriodEnd) {
+			continue
+		}
+
+		fmt.Printf("Abonnement %s (compte %d) : %s -> %s, prix %s -> %s, fin de période %s -> %s\n",
+			local.StripeSubscriptionID, local.UserID, local.Status, remote.Status,
+			local.StripePriceID, priceID,
+			local.CurrentPeriodEnd.Format("2006-01-02"), periodEnd.Format("2006-01-02"))
+		if *dryRun {
+			updated++
+			continue
+		}
+
+		_, err = database.DB.Exec(`
+			UPDATE subscriptions
+			SET status = $1, stripe_price_id = $2, current_period_start = $3, current_period_end = $4,
+			    updated_at = CURRENT_TIMESTAMP
+			WHERE id = $5`,
+			string(remote.Status), priceID, periodStart, periodEnd, local.ID,
+		)
+		if err != nil {
+			fmt.Printf("Abonnement %s : erreur mise à jour: %v\n", local.StripeSubscriptionID, err)
+			failed++
+			continue
+		}
+		updated++
+	}
+
+	verb := "corrigé(s)"
+	if *dryRun {
+		verb = "à corriger"
+	}
+	fmt.Printf("%d abonnement(s) vérifié(s), %d %s, %d erreur(s)\n", len(subscriptions), updated, verb, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d abonnement(s) non réconcilié(s)", failed)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"backend-go/security"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runCreateUser(args []string) error {
+	flags := newFlagSet("create-user")
+	email := flags.String("email", "", "adresse email du compte")
+	name := flags.String("name", "", "nom complet")
+	password := flags.String("password", "", "mot de passe (généré si absent)")
+	role := flags.String("role", models.RoleUser, "rôle du compte")
+	flags.Parse(args)
+
+	if err := required(flags, map[string]string{"email": *email, "name": *name}); err != nil {
+		return err
+	}
+	if !models.IsValidRole(*role) {
+		return fmt.Errorf("rôle invalide: %s", *role)
+	}
+
+	generated := *password == ""
+	if generated {
+		var err error
+		if *password, err = randomPassword(); err != nil {
+			return err
+		}
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	// Un compte créé par un administrateur a une adresse considérée comme vérifiée
+	var userID int
+	err = database.DB.QueryRow(
+		"INSERT INTO users (email, password, full_name, role, email_verified) VALUES ($1, $2, $3, $4, TRUE) RETURNING id",
+		*email, string(hashedPassword), *name, *role,
+	).Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("création du compte: %w", err)
+	}
+
+	fmt.Printf("Compte %d créé (%s, rôle %s)\n", userID, *email, *role)
+	if generated {
+		fmt.Printf("Mot de passe : %s\n", *password)
+	}
+	return nil
+}
+
+func runPromote(args []string) error {
+	flags := newFlagSet("promote")
+	email := flags.String("email", "", "adresse email du compte")
+	role := flags.String("role", "", "nouveau rôle")
+	flags.Parse(args)
+
+	if err := required(flags, map[string]string{"email": *email, "role": *role}); err != nil {
+		return err
+	}
+	if !models.IsValidRole(*role) {
+		return fmt.Errorf("rôle invalide: %s", *role)
+	}
+
+	var userID int
+	err := database.DB.QueryRow(`
+		UPDATE users SET role = $1, updated_at = CURRENT_TIMESTAMP,
+			garage_id = CASE WHEN $1 = 'garage' THEN garage_id ELSE NULL END
+		WHERE email = $2
+		RETURNING id`,
+		*role, *email,
+	).Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("compte %s introuvable", *email)
+	}
+
+	// Le rôle est inscrit dans les jetons : les sessions ouvertes sont révoquées
+	if err := revokeSessions(userID); err != nil {
+		return err
+	}
+
+	security.LogEvent(security.EventRoleChanged, &userID, "", map[string]interface{}{
+		"to":     *role,
+		"source": "sycadmin",
+	})
+
+	fmt.Printf("Compte %d (%s) passé au rôle %s\n", userID, *email, *role)
+	return nil
+}
+
+func runResetPassword(args []string) error {
+	flags := newFlagSet("reset-password")
+	email := flags.String("email", "", "adresse email du compte")
+	password := flags.String("password", "", "nouveau mot de passe (généré si absent)")
+	flags.Parse(args)
+
+	if err := required(flags, map[string]string{"email": *email}); err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		var err error
+		if *password, err = randomPassword(); err != nil {
+			return err
+		}
+	}
+	if len(*password) < 6 {
+		return fmt.Errorf("le mot de passe doit contenir au moins 6 caractères")
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	var userID int
+	err = database.DB.QueryRow(
+		"UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE email = $2 RETURNING id",
+		string(hashedPassword), *email,
+	).Scan(&userID)
+	if err != nil {
+		return fmt.Errorf("compte %s introuvable", *email)
+	}
+
+	if err := revokeSessions(userID); err != nil {
+		return err
+	}
+
+	security.LogEvent(security.EventPasswordResetDone, &userID, "", map[string]interface{}{"source": "sycadmin"})
+
+	fmt.Printf("Mot de passe du compte %d (%s) réinitialisé, sessions révoquées\n", userID, *email)
+	if generated {
+		fmt.Printf("Mot de passe : %s\n", *password)
+	}
+	return nil
+}
+
+func revokeSessions(userID int) error {
+	_, err := database.DB.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	)
+	return err
+}
+
+func randomPassword() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
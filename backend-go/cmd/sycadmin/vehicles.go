@@ -0,0 +1,66 @@
+package main
+
+import (
+	"backend-go/database"
+	"fmt"
+	"strconv"
+)
+
+// runTransferVehicle transfère un véhicule, ses documents et ses rendez-vous
+// sans l'accord du propriétaire actuel (litige, compte inaccessible...)
+func runTransferVehicle(args []string) error {
+	flags := newFlagSet("transfer-vehicle")
+	vehicle := flags.String("vehicle", "", "identifiant du véhicule")
+	to := flags.String("to", "", "email du nouveau propriétaire")
+	flags.Parse(args)
+
+	if err := required(flags, map[string]string{"vehicle": *vehicle, "to": *to}); err != nil {
+		return err
+	}
+	vehicleID, err := strconv.Atoi(*vehicle)
+	if err != nil {
+		return fmt.Errorf("identifiant de véhicule invalide: %s", *vehicle)
+	}
+
+	var newOwnerID int
+	if err := database.DB.QueryRow("SELECT id FROM users WHERE email = $1", *to).Scan(&newOwnerID); err != nil {
+		return fmt.Errorf("compte %s introuvable", *to)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousOwnerID int
+	err = tx.QueryRow(`
+		UPDATE vehicles v SET user_id = $1, updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT id, user_id FROM vehicles WHERE id = $2 FOR UPDATE) old
+		WHERE v.id = old.id
+		RETURNING old.user_id`,
+		newOwnerID, vehicleID,
+	).Scan(&previousOwnerID)
+	if err != nil {
+		return fmt.Errorf("véhicule %d introuvable", vehicleID)
+	}
+
+	documents, err := tx.Exec("UPDATE documents SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE vehicle_id = $2 AND deleted_at IS NULL", newOwnerID, vehicleID)
+	if err != nil {
+		return fmt.Errorf("transfert des documents: %w", err)
+	}
+	appointments, err := tx.Exec("UPDATE appointments SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE vehicle_id = $2", newOwnerID, vehicleID)
+	if err != nil {
+		return fmt.Errorf("transfert des rendez-vous: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	documentCount, _ := documents.RowsAffected()
+	appointmentCount, _ := appointments.RowsAffected()
+	fmt.Printf("Véhicule %d transféré du compte %d au compte %d (%d document(s), %d rendez-vous)\n",
+		vehicleID, previousOwnerID, newOwnerID, documentCount, appointmentCount)
+	return nil
+}
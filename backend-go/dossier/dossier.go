@@ -0,0 +1,336 @@
+package dossier
+
+import (
+	"archive/zip"
+	"backend-go/encryption"
+	"backend-go/models"
+	"backend-go/storage"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrVehicleNotFound est retournée si le véhicule n'appartient pas à l'utilisateur
+var ErrVehicleNotFound = errors.New("véhicule non trouvé")
+
+// ManifestVersion est la version du format de manifest.json
+const ManifestVersion = 1
+
+// Dossier regroupe tout l'historique d'un véhicule exporté pour un acheteur
+type Dossier struct {
+	db           *sql.DB
+	Vehicle      models.Vehicle
+	Documents    []models.Document
+	Appointments []models.Appointment
+	GeneratedAt  time.Time
+}
+
+// Load charge le véhicule, ses documents et ses rendez-vous s'il appartient à userID
+func Load(db *sql.DB, vehicleID, userID int) (*Dossier, error) {
+	d := &Dossier{db: db, GeneratedAt: time.Now()}
+
+	v := &d.Vehicle
+	err := db.QueryRow(`
+		SELECT id, user_id, plate, model, brand, year, mileage, technical_control_date, created_at, updated_at
+		FROM vehicles WHERE id = $1 AND user_id = $2`, vehicleID, userID).Scan(
+		&v.ID, &v.UserID, &v.Plate, &v.Model, &v.Brand, &v.Year, &v.Mileage, &v.TechnicalControlDate, &v.CreatedAt, &v.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrVehicleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, vehicle_id, user_id, name, type, description, file_path, file_name, file_size, mime_type, file_sha256,
+		       issued_at, expires_at, created_at, updated_at
+		FROM documents WHERE vehicle_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at, id`, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var doc models.Document
+		err := rows.Scan(&doc.ID, &doc.VehicleID, &doc.UserID, &doc.Name, &doc.Type, &doc.Description, &doc.FilePath, &doc.FileName,
+			&doc.FileSize, &doc.MimeType, &doc.FileSHA256, &doc.IssuedAt, &doc.ExpiresAt, &doc.CreatedAt, &doc.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		d.Documents = append(d.Documents, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Tous les rendez-vous du véhicule, y compris ceux des propriétaires précédents
+	rows, err = db.Query(`
+		SELECT id, garage_name, garage_id, date, time, service, COALESCE(description, ''), COALESCE(status, ''), created_at, updated_at
+		FROM appointments WHERE vehicle_id = $1
+		ORDER BY date, id`, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a models.Appointment
+		err := rows.Scan(&a.ID, &a.GarageName, &a.GarageID, &a.Date, &a.Time, &a.Service, &a.Description, &a.Status, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		a.VehicleID = &vehicleID
+		d.Appointments = append(d.Appointments, a)
+	}
+	return d, rows.Err()
+}
+
+// FileName retourne le nom proposé pour l'archive
+func (d *Dossier) FileName() string {
+	plate := strings.ToUpper(strings.NewReplacer(" ", "", "/", "", "\\", "").Replace(d.Vehicle.Plate))
+	return storage.CleanFileName("dossier-"+plate+"-"+d.GeneratedAt.Format("2006-01-02")+".zip", "dossier.zip")
+}
+
+// manifest décrit le contenu de l'archive pour un traitement automatique
+type manifest struct {
+	Format       string               `json:"format"`
+	Version      int                  `json:"version"`
+	GeneratedAt  time.Time            `json:"generated_at"`
+	Vehicle      manifestVehicle      `json:"vehicle"`
+	Documents    []manifestDocument   `json:"documents"`
+	Appointments []models.Appointment `json:"appointments"`
+	Summary      string               `json:"summary"`
+}
+
+type manifestVehicle struct {
+	Plate                string     `json:"plate"`
+	Brand                string     `json:"brand"`
+	Model                string     `json:"model"`
+	Year                 *int       `json:"year"`
+	Mileage              *int       `json:"mileage"`
+	TechnicalControlDate *time.Time `json:"technical_control_date"`
+}
+
+type manifestDocument struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Description *string    `json:"description"`
+	Path        *string    `json:"path"` // nil si le fichier est introuvable dans le stockage
+	FileName    string     `json:"file_name"`
+	MimeType    string     `json:"mime_type"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256,omitempty"`
+	IssuedAt    *time.Time `json:"issued_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const summaryPath = "resume.pdf"
+
+// WriteZIP écrit l'archive au fil de l'eau : les documents dans documents/,
+// le résumé PDF et manifest.json, écrit en dernier avec les empreintes
+// calculées pendant la copie. Un fichier manquant dans le stockage est
+// signalé dans le manifest sans interrompre l'export
+func (d *Dossier) WriteZIP(ctx context.Context, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	m := manifest{
+		Format:       "saveyourcar-dossier",
+		Version:      ManifestVersion,
+		GeneratedAt:  d.GeneratedAt,
+		Appointments: d.Appointments,
+		Summary:      summaryPath,
+		Documents:    []manifestDocument{},
+		Vehicle: manifestVehicle{
+			Plate:                d.Vehicle.Plate,
+			Brand:                d.Vehicle.Brand,
+			Model:                d.Vehicle.Model,
+			Year:                 d.Vehicle.Year,
+			Mileage:              d.Vehicle.Mileage,
+			TechnicalControlDate: d.Vehicle.TechnicalControlDate,
+		},
+	}
+	if m.Appointments == nil {
+		m.Appointments = []models.Appointment{}
+	}
+
+	for _, doc := range d.Documents {
+		entry := manifestDocument{
+			ID:          doc.ID,
+			Name:        doc.Name,
+			Type:        doc.Type,
+			Description: doc.Description,
+			FileName:    doc.FileName,
+			MimeType:    doc.MimeType,
+			Size:        doc.FileSize,
+			IssuedAt:    doc.IssuedAt,
+			ExpiresAt:   doc.ExpiresAt,
+			CreatedAt:   doc.CreatedAt,
+		}
+
+		name := documentPath(doc)
+		size, sum, err := d.copyDocument(ctx, archive, name, doc)
+		switch {
+		case err == nil:
+			entry.Path = &name
+			entry.Size = size
+			entry.SHA256 = sum
+		case errors.Is(err, storage.ErrNotFound):
+			log.Printf("Export véhicule %d: fichier du document %d introuvable", d.Vehicle.ID, doc.ID)
+		default:
+			return err
+		}
+		m.Documents = append(m.Documents, entry)
+	}
+
+	summary, err := archive.CreateHeader(&zip.FileHeader{Name: summaryPath, Method: zip.Deflate, Modified: d.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := summary.Write(d.SummaryPDF()); err != nil {
+		return err
+	}
+
+	manifestFile, err := archive.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: d.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(manifestFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// copyDocument copie un document dans l'archive sans le recompresser (PDF et
+// images le sont déjà) et retourne sa taille et son empreinte SHA-256
+func (d *Dossier) copyDocument(ctx context.Context, archive *zip.Writer, name string, doc models.Document) (int64, string, error) {
+	reader, _, err := encryption.Get(ctx, d.db, storage.KeyFromPath(doc.FilePath))
+	if err != nil {
+		return 0, "", err
+	}
+	defer reader.Close()
+
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: doc.CreatedAt})
+	if err != nil {
+		return 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// documentPath range les documents par type, préfixés par leur identifiant
+// pour que deux fichiers de même nom ne se remplacent pas
+func documentPath(doc models.Document) string {
+	fileName := strings.NewReplacer("/", "_", "\\", "_").Replace(storage.CleanFileName(doc.FileName, "document"))
+	return path.Join("documents", doc.Type, strconv.Itoa(doc.ID)+"-"+fileName)
+}
+
+// documentTypeNames sont les libellés des types de document dans le résumé
+var documentTypeNames = map[string]string{
+	"carte_grise":        "Carte grise",
+	"assurance":          "Assurance",
+	"controle_technique": "Contrôle technique",
+	"facture":            "Facture",
+	"autre":              "Autre",
+}
+
+// SummaryPDF génère le résumé lisible du dossier : véhicule, contrôles
+// techniques, rendez-vous et liste des documents
+func (d *Dossier) SummaryPDF() []byte {
+	p := newPDFWriter()
+	v := d.Vehicle
+
+	p.title("Dossier du véhicule " + v.Plate)
+	p.text("Généré le " + d.GeneratedAt.Format("02/01/2006 à 15:04") + " par Save Your Car")
+
+	p.heading("Véhicule")
+	p.field("Immatriculation", v.Plate)
+	p.field("Marque", v.Brand)
+	p.field("Modèle", v.Model)
+	p.field("Année", optionalInt(v.Year, ""))
+	p.field("Kilométrage", optionalInt(v.Mileage, " km"))
+	p.field("Contrôle technique", optionalDate(v.TechnicalControlDate))
+
+	p.heading("Contrôles techniques")
+	controls := 0
+	for _, doc := range d.Documents {
+		if doc.Type != "controle_technique" {
+			continue
+		}
+		controls++
+		value := "Date inconnue"
+		if doc.IssuedAt != nil {
+			value = "Effectué le " + doc.IssuedAt.Format("02/01/2006")
+		}
+		if doc.ExpiresAt != nil {
+			value += ", valable jusqu'au " + doc.ExpiresAt.Format("02/01/2006")
+		}
+		p.field(doc.Name, value)
+	}
+	if controls == 0 {
+		p.text("Aucun procès-verbal de contrôle technique enregistré.")
+	}
+
+	p.heading("Historique des rendez-vous")
+	if len(d.Appointments) == 0 {
+		p.text("Aucun rendez-vous enregistré.")
+	}
+	for _, a := range d.Appointments {
+		value := a.Service + " - " + a.GarageName + " (" + models.GetStatusDisplayName(a.Status) + ")"
+		if a.Description != "" {
+			value += "\n" + a.Description
+		}
+		p.field(a.Date.Format("02/01/2006")+" "+a.Time, value)
+	}
+
+	p.heading("Documents")
+	if len(d.Documents) == 0 {
+		p.text("Aucun document enregistré.")
+	}
+	for _, doc := range d.Documents {
+		typeName := documentTypeNames[doc.Type]
+		if typeName == "" {
+			typeName = doc.Type
+		}
+		value := typeName + ", ajouté le " + doc.CreatedAt.Format("02/01/2006")
+		if doc.ExpiresAt != nil {
+			value += ", expire le " + doc.ExpiresAt.Format("02/01/2006")
+		}
+		p.field(doc.Name, value+"\n"+documentPath(doc))
+	}
+
+	p.space(20)
+	p.text("Les fichiers des documents sont joints dans le dossier documents/ de l'archive ; manifest.json en donne la liste avec leur empreinte SHA-256.")
+	return p.bytes()
+}
+
+func optionalInt(value *int, unit string) string {
+	if value == nil {
+		return "Non renseigné"
+	}
+	return fmt.Sprintf("%d%s", *value, unit)
+}
+
+func optionalDate(value *time.Time) string {
+	if value == nil {
+		return "Non renseigné"
+	}
+	return value.Format("02/01/2006")
+}
@@ -0,0 +1,193 @@
+package dossier
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Mise en page A4 en points PDF
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	margin       = 50.0
+	contentWidth = pageWidth - 2*margin
+)
+
+// averageCharWidth est la largeur moyenne d'un caractère Helvetica, en
+// fraction de la taille de police, utilisée pour couper les lignes
+const averageCharWidth = 0.52
+
+// pdfWriter produit un PDF texte simple (Helvetica, encodage WinAnsi) sans
+// dépendance externe : titres, champs "libellé : valeur" et paragraphes,
+// avec saut de page automatique
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func newPDFWriter() *pdfWriter {
+	p := &pdfWriter{}
+	p.newPage()
+	return p
+}
+
+func (p *pdfWriter) newPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+	p.y = pageHeight - margin
+}
+
+// ensure passe à la page suivante s'il reste moins de height points
+func (p *pdfWriter) ensure(height float64) {
+	if p.y-height < margin {
+		p.newPage()
+	}
+}
+
+func (p *pdfWriter) write(font string, size, x float64, text string) {
+	fmt.Fprintf(p.pages[len(p.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.y, pdfString(text))
+}
+
+func (p *pdfWriter) title(text string) {
+	p.ensure(30)
+	p.y -= 18
+	p.write("F2", 18, margin, text)
+	p.y -= 12
+}
+
+func (p *pdfWriter) heading(text string) {
+	p.ensure(40)
+	p.y -= 20
+	p.write("F2", 13, margin, text)
+	p.y -= 6
+}
+
+// field écrit "libellé : valeur" ; la valeur est coupée sur plusieurs lignes
+// si besoin, le libellé raccourci pour tenir dans sa colonne
+func (p *pdfWriter) field(label, value string) {
+	const size, labelWidth = 10.0, 150.0
+	labelSpace := labelWidth - 10.0
+	labelChars := int(labelSpace / (size * averageCharWidth))
+	if len([]rune(label)) > labelChars {
+		label = string([]rune(label)[:labelChars-1]) + "…"
+	}
+	lines := wrap(value, size, contentWidth-labelWidth)
+	p.ensure(float64(len(lines)) * 14)
+	for i, line := range lines {
+		p.y -= 14
+		if i == 0 {
+			p.write("F2", size, margin, label)
+		}
+		p.write("F1", size, margin+labelWidth, line)
+	}
+}
+
+func (p *pdfWriter) text(text string) {
+	const size = 10.0
+	for _, line := range wrap(text, size, contentWidth) {
+		p.ensure(14)
+		p.y -= 14
+		p.write("F1", size, margin, line)
+	}
+}
+
+func (p *pdfWriter) space(height float64) {
+	p.y -= height
+}
+
+// bytes assemble le fichier : catalogue, arbre des pages, polices, puis une
+// page et son contenu par page, et la table des références croisées
+func (p *pdfWriter) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objets 1 à 4 ; chaque page occupe ensuite deux objets (page, contenu)
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// wrap coupe text en lignes d'au plus width points, aux espaces
+func wrap(text string, size, width float64) []string {
+	maxChars := int(width / (size * averageCharWidth))
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > maxChars {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:maxChars]))
+				word = string(runes[maxChars:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= maxChars:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// winAnsi associe les caractères hors Latin-1 de l'encodage WinAnsi à leur octet
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, 'Œ': 0x8C, 'œ': 0x9C, 'Ÿ': 0x9F,
+}
+
+// pdfString encode text en WinAnsi et échappe les caractères spéciaux des
+// chaînes PDF ; les caractères non représentables deviennent "?"
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		var c byte
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			c = byte(r)
+		case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+			c = byte(r)
+		default:
+			var ok bool
+			if c, ok = winAnsi[r]; !ok {
+				c = '?'
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
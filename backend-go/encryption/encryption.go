@@ -0,0 +1,342 @@
+package encryption
+
+import (
+	"backend-go/storage"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrUnknownKey est retournée si la clé maître d'un fichier n'est plus configurée
+var ErrUnknownKey = errors.New("clé maître de chiffrement inconnue")
+
+// CiphertextContentType est le type enregistré dans le stockage pour un
+// fichier chiffré ; le type d'origine reste en base
+const CiphertextContentType = "application/octet-stream"
+
+// masterKey chiffre les clés de données des fichiers
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	// active chiffre les nouveaux fichiers ; nil si le chiffrement est désactivé
+	active     *masterKey
+	masterKeys = map[string]*masterKey{}
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Init lit DOCUMENT_ENCRYPTION_KEYS : "id:clé" séparés par des virgules, clés
+// de 32 octets encodées en base64. La première chiffre les nouveaux fichiers,
+// les suivantes, plus anciennes, ne servent qu'à relire les fichiers existants
+// le temps que Start les rechiffre avec la première
+func Init() {
+	value := os.Getenv("DOCUMENT_ENCRYPTION_KEYS")
+	if value == "" {
+		log.Println("⚠️  DOCUMENT_ENCRYPTION_KEYS non configuré : les documents sont stockés en clair")
+		return
+	}
+
+	keys, err := parseKeys(value)
+	if err != nil {
+		log.Fatalf("DOCUMENT_ENCRYPTION_KEYS invalide: %v", err)
+	}
+	active = keys[0]
+	for _, key := range keys {
+		masterKeys[key.id] = key
+	}
+	log.Printf("Chiffrement des documents: clé maître %s", active.id)
+}
+
+// parseKeys lit une liste de clés maîtres au format de DOCUMENT_ENCRYPTION_KEYS
+func parseKeys(value string) ([]*masterKey, error) {
+	var keys []*masterKey
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("entrée %q : format attendu id:clé", entry)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("clé %s en double", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("clé %s : %d octets en base64 attendus", id, dataKeySize)
+		}
+		seen[id] = true
+		keys = append(keys, &masterKey{id: id, key: key})
+	}
+	return keys, nil
+}
+
+// Enabled indique si les nouveaux fichiers sont chiffrés
+func Enabled() bool {
+	return active != nil
+}
+
+// ActiveKeyID retourne l'identifiant de la clé maître active, "" si le
+// chiffrement est désactivé
+func ActiveKeyID() string {
+	if active == nil {
+		return ""
+	}
+	return active.id
+}
+
+// Seal chiffre avec la clé maître active un secret conservé en base autre
+// qu'une clé de fichier, comme une clé privée de signature. associated lie le
+// résultat à son emplacement et doit être redonné à Open. Retourne
+// l'identifiant de la clé maître et le secret chiffré en base64
+func Seal(associated string, secret []byte) (string, string, error) {
+	if active == nil {
+		return "", "", errors.New("DOCUMENT_ENCRYPTION_KEYS non configuré")
+	}
+	sealed, err := wrap(active, associated, secret)
+	if err != nil {
+		return "", "", err
+	}
+	return active.id, sealed, nil
+}
+
+// Open déchiffre un secret chiffré par Seal avec la clé maître keyID
+func Open(keyID, associated, sealed string) ([]byte, error) {
+	return unwrap(keyID, associated, sealed)
+}
+
+// wrap chiffre la clé de données d'un fichier ; la clé de stockage sert de
+// données associées, une clé enveloppée ne peut pas servir à un autre fichier
+func wrap(master *masterKey, storageKey string, dataKey []byte) (string, error) {
+	aead, err := newAEAD(master.key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, dataKey, []byte(storageKey))), nil
+}
+
+func unwrap(keyID, storageKey, wrapped string) ([]byte, error) {
+	master, ok := masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	aead, err := newAEAD(master.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrCorrupted
+	}
+	dataKey, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(storageKey))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return dataKey, nil
+}
+
+// Put enregistre un fichier dans le stockage, chiffré avec une nouvelle clé
+// de données si le chiffrement est activé. La clé enveloppée est conservée
+// dans file_keys avant l'écriture du fichier
+func Put(ctx context.Context, db *sql.DB, key string, r io.Reader, size int64, contentType string) error {
+	if active == nil {
+		return storage.Default.Put(ctx, key, r, size, contentType)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	wrapped, err := wrap(active, key, dataKey)
+	if err != nil {
+		return err
+	}
+	encrypted, err := newEncryptReader(r, dataKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO file_keys (storage_key, key_id, wrapped_key) VALUES ($1, $2, $3)", key, active.id, wrapped)
+	if err != nil {
+		return err
+	}
+
+	encryptedSize := int64(-1)
+	if size >= 0 {
+		encryptedSize = EncryptedSize(size)
+	}
+	if err := storage.Default.Put(ctx, key, encrypted, encryptedSize, CiphertextContentType); err != nil {
+		if _, err := db.Exec("DELETE FROM file_keys WHERE storage_key = $1", key); err != nil {
+			log.Printf("Erreur suppression clé du fichier %s: %v", key, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Get ouvre un fichier du stockage et le déchiffre au fil de la lecture. Un
+// fichier sans clé, envoyé avant l'activation du chiffrement, est lu tel quel.
+// Object.Size est la taille en clair
+func Get(ctx context.Context, db *sql.DB, key string) (io.ReadCloser, *storage.Object, error) {
+	var keyID, wrapped string
+	err := db.QueryRowContext(ctx, "SELECT key_id, wrapped_key FROM file_keys WHERE storage_key = $1", key).Scan(&keyID, &wrapped)
+	if err == sql.ErrNoRows {
+		return storage.Default.Get(ctx, key)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	dataKey, err := unwrap(keyID, key, wrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, object, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	decrypted, size, err := newDecryptReader(reader, dataKey, object.Size)
+	if err != nil {
+		reader.Close()
+		return nil, nil, fmt.Errorf("%s: %w", key, err)
+	}
+
+	plain := *object
+	plain.Size = size
+	plain.ContentType = ""
+	return decrypted, &plain, nil
+}
+
+// Encrypted indique si un fichier est chiffré : il ne peut alors pas être
+// téléchargé directement depuis le stockage (URL signée S3)
+func Encrypted(ctx context.Context, db *sql.DB, key string) (bool, error) {
+	var encrypted bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM file_keys WHERE storage_key = $1)", key).Scan(&encrypted)
+	return encrypted, err
+}
+
+// Delete supprime un fichier du stockage puis sa clé
+func Delete(ctx context.Context, db *sql.DB, key string) error {
+	if err := storage.Default.Delete(ctx, key); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "DELETE FROM file_keys WHERE storage_key = $1", key)
+	return err
+}
+
+// rewrapBatch est le nombre de clés rechiffrées par requête
+const rewrapBatch = 100
+
+// Rewrap rechiffre avec la clé maître active les clés de données enveloppées
+// par une ancienne clé encore configurée. Les fichiers ne sont pas relus ; une
+// clé illisible est signalée et laissée en l'état. Retourne le nombre de clés
+// rechiffrées
+func Rewrap(ctx context.Context, db *sql.DB) (int, error) {
+	if active == nil {
+		return 0, nil
+	}
+	var oldIDs []string
+	for id := range masterKeys {
+		if id != active.id {
+			oldIDs = append(oldIDs, id)
+		}
+	}
+	if len(oldIDs) == 0 {
+		return 0, nil
+	}
+
+	rewrapped := 0
+	after := ""
+	for {
+		rows, err := db.QueryContext(ctx, `
+			SELECT storage_key, key_id, wrapped_key FROM file_keys
+			WHERE key_id = ANY($1) AND storage_key > $2
+			ORDER BY storage_key
+			LIMIT $3`, pq.Array(oldIDs), after, rewrapBatch)
+		if err != nil {
+			return rewrapped, err
+		}
+		type fileKey struct{ storageKey, keyID, wrapped string }
+		var batch []fileKey
+		for rows.Next() {
+			var k fileKey
+			if err := rows.Scan(&k.storageKey, &k.keyID, &k.wrapped); err != nil {
+				rows.Close()
+				return rewrapped, err
+			}
+			batch = append(batch, k)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return rewrapped, err
+		}
+		if len(batch) == 0 {
+			return rewrapped, nil
+		}
+
+		after = batch[len(batch)-1].storageKey
+
+		for _, k := range batch {
+			dataKey, err := unwrap(k.keyID, k.storageKey, k.wrapped)
+			if err != nil {
+				log.Printf("Rechiffrement de la clé du fichier %s impossible: %v", k.storageKey, err)
+				continue
+			}
+			wrapped, err := wrap(active, k.storageKey, dataKey)
+			if err != nil {
+				return rewrapped, err
+			}
+			// Une clé supprimée ou déjà rechiffrée entre-temps est ignorée
+			result, err := db.ExecContext(ctx, `
+				UPDATE file_keys SET key_id = $2, wrapped_key = $3, rewrapped_at = CURRENT_TIMESTAMP
+				WHERE storage_key = $1 AND key_id = $4`,
+				k.storageKey, active.id, wrapped, k.keyID,
+			)
+			if err != nil {
+				return rewrapped, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				rewrapped++
+			}
+		}
+	}
+}
+
+// Start rechiffre en arrière-plan, au démarrage puis toutes les every, les
+// clés de données enveloppées par une ancienne clé maître. Plusieurs
+// répliques peuvent tourner en même temps : une clé déjà rechiffrée est ignorée
+func Start(db *sql.DB, every time.Duration) {
+	if active == nil {
+		return
+	}
+	go func() {
+		for {
+			rewrapped, err := Rewrap(context.Background(), db)
+			if err != nil {
+				log.Printf("Erreur rechiffrement des clés de fichiers: %v", err)
+			} else if rewrapped > 0 {
+				log.Printf("%d clé(s) de fichiers rechiffrée(s) avec la clé maître %s", rewrapped, active.id)
+			}
+			time.Sleep(every)
+		}
+	}()
+}
@@ -0,0 +1,272 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Format d'un fichier chiffré : un en-tête (magic, version, préfixe de nonce)
+// puis le contenu découpé en blocs de chunkSize octets, chacun scellé en
+// AES-256-GCM. Le nonce d'un bloc contient son numéro et un indicateur de
+// dernier bloc : un fichier tronqué, réordonné ou rallongé est détecté
+const (
+	chunkSize   = 64 * 1024
+	tagSize     = 16
+	prefixSize  = 7
+	headerSize  = len(magic) + 1 + prefixSize
+	dataKeySize = 32
+)
+
+const magic = "SYCE"
+
+const formatVersion = 1
+
+// ErrCorrupted est retournée pour un fichier chiffré illisible avec sa clé
+var ErrCorrupted = errors.New("fichier chiffré corrompu")
+
+var errNotSeekable = errors.New("fichier chiffré non positionnable")
+
+// EncryptedSize retourne la taille chiffrée d'un contenu de size octets
+func EncryptedSize(size int64) int64 {
+	return int64(headerSize) + size + tagSize*chunkCount(size)
+}
+
+// PlaintextSize retourne la taille d'origine d'un fichier chiffré de size octets
+func PlaintextSize(size int64) (int64, error) {
+	body := size - int64(headerSize)
+	if body < tagSize {
+		return 0, ErrCorrupted
+	}
+	chunks := (body + chunkSize + tagSize - 1) / (chunkSize + tagSize)
+	return body - tagSize*chunks, nil
+}
+
+// chunkCount est le nombre de blocs d'un contenu ; un contenu vide en a un
+func chunkCount(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + chunkSize - 1) / chunkSize
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, index int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(index))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptReader chiffre src au fil de la lecture
+type encryptReader struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  int64
+	buf    []byte
+	out    []byte // données chiffrées pas encore lues
+	done   bool
+}
+
+func newEncryptReader(src io.Reader, dataKey []byte) (*encryptReader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, formatVersion)
+	header = append(header, prefix...)
+	return &encryptReader{
+		src:    bufio.NewReaderSize(src, chunkSize),
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, chunkSize, chunkSize+tagSize),
+		out:    header,
+	}, nil
+}
+
+// Read retourne les erreurs de src telles quelles (fichier trop gros...)
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealChunk lit le bloc suivant ; c'est le dernier si src n'a rien de plus
+func (r *encryptReader) sealChunk() error {
+	n, err := io.ReadFull(r.src, r.buf[:chunkSize])
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.aead.Seal(r.buf[:0], chunkNonce(r.prefix, r.index, last), r.buf[:n], nil)
+	r.index++
+	r.done = last
+	return nil
+}
+
+// decryptReader déchiffre un fichier au fil de la lecture
+type decryptReader struct {
+	src    io.ReadCloser
+	aead   cipher.AEAD
+	prefix []byte
+	size   int64 // taille en clair
+	pos    int64
+	next   int64 // bloc auquel src est positionné
+	buf    []byte
+	plain  []byte // données en clair pas encore lues
+}
+
+// seekableReader permet les requêtes Range quand le stockage est positionnable
+type seekableReader struct {
+	*decryptReader
+	seeker io.Seeker
+}
+
+// newDecryptReader lit l'en-tête de src, un fichier chiffré de encryptedSize octets
+func newDecryptReader(src io.ReadCloser, dataKey []byte, encryptedSize int64) (io.ReadCloser, int64, error) {
+	size, err := PlaintextSize(encryptedSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, 0, ErrCorrupted
+	}
+	if !bytes.Equal(header[:len(magic)], []byte(magic)) || header[len(magic)] != formatVersion {
+		return nil, 0, ErrCorrupted
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := &decryptReader{
+		src:    src,
+		aead:   aead,
+		prefix: header[len(magic)+1:],
+		size:   size,
+		buf:    make([]byte, chunkSize+tagSize),
+	}
+	if seeker, ok := src.(io.Seeker); ok {
+		return &seekableReader{decryptReader: r, seeker: seeker}, size, nil
+	}
+	return r, size, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	return r.read(p, nil)
+}
+
+func (r *decryptReader) read(p []byte, seeker io.Seeker) (int, error) {
+	if len(r.plain) == 0 {
+		// Le bloc unique d'un fichier vide est vérifié avant EOF
+		if r.size == 0 && r.next == 0 {
+			if err := r.openChunk(0, seeker); err != nil {
+				return 0, err
+			}
+		}
+		if r.pos >= r.size {
+			return 0, io.EOF
+		}
+		if err := r.openChunk(r.pos/chunkSize, seeker); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+// openChunk déchiffre le bloc index, en repositionnant src après un Seek
+func (r *decryptReader) openChunk(index int64, seeker io.Seeker) error {
+	if index != r.next {
+		if seeker == nil {
+			return errNotSeekable
+		}
+		if _, err := seeker.Seek(int64(headerSize)+index*(chunkSize+tagSize), io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	last := index == chunkCount(r.size)-1
+	sealed := r.buf[:min(chunkSize, r.size-index*chunkSize)+tagSize]
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrCorrupted
+		}
+		return err
+	}
+	plain, err := r.aead.Open(sealed[:0], chunkNonce(r.prefix, index, last), sealed, nil)
+	if err != nil {
+		return ErrCorrupted
+	}
+	r.next = index + 1
+	r.plain = plain[r.pos-index*chunkSize:]
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
+
+func (r *seekableReader) Read(p []byte) (int, error) {
+	return r.read(p, r.seeker)
+}
+
+// Seek ne déplace src qu'à la lecture suivante, au début du bloc concerné
+func (r *seekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("position négative")
+	}
+	r.pos = offset
+	r.plain = nil
+	return offset, nil
+}
@@ -0,0 +1,228 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// seekableBuffer simule un fichier local du stockage, positionnable
+type seekableBuffer struct {
+	*bytes.Reader
+}
+
+func (seekableBuffer) Close() error { return nil }
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func encrypt(t *testing.T, plain, dataKey []byte) []byte {
+	t.Helper()
+	// Lectures d'un octet : les blocs ne doivent pas dépendre du découpage de src
+	r, err := newEncryptReader(iotest.OneByteReader(bytes.NewReader(plain)), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encrypted
+}
+
+func decrypt(encrypted, dataKey []byte) ([]byte, error) {
+	r, _, err := newDecryptReader(io.NopCloser(bytes.NewReader(encrypted)), dataKey, int64(len(encrypted)))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		plain := randomBytes(t, size)
+		encrypted := encrypt(t, plain, dataKey)
+
+		if int64(len(encrypted)) != EncryptedSize(int64(size)) {
+			t.Errorf("%d octets : taille chiffrée %d, EncryptedSize %d", size, len(encrypted), EncryptedSize(int64(size)))
+		}
+		if got, err := PlaintextSize(int64(len(encrypted))); err != nil || got != int64(size) {
+			t.Errorf("%d octets : PlaintextSize = %d, %v", size, got, err)
+		}
+
+		decrypted, err := decrypt(encrypted, dataKey)
+		if err != nil {
+			t.Fatalf("%d octets : %v", size, err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("%d octets : contenu déchiffré différent", size)
+		}
+	}
+}
+
+func TestStreamRandomPrefix(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	plain := randomBytes(t, 100)
+	if bytes.Equal(encrypt(t, plain, dataKey), encrypt(t, plain, dataKey)) {
+		t.Error("deux chiffrements du même contenu sont identiques")
+	}
+}
+
+func TestStreamWrongKey(t *testing.T) {
+	encrypted := encrypt(t, randomBytes(t, 100), randomBytes(t, dataKeySize))
+	if _, err := decrypt(encrypted, randomBytes(t, dataKeySize)); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("autre clé : %v, attendu ErrCorrupted", err)
+	}
+}
+
+func TestStreamTruncated(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	sealedChunk := chunkSize + tagSize
+
+	tests := []struct {
+		name string
+		size int
+		keep int // octets chiffrés conservés
+	}{
+		// Le dernier bloc retiré : l'avant-dernier n'est pas marqué comme dernier
+		{"dernier bloc retiré", 2 * chunkSize, headerSize + sealedChunk},
+		{"bloc de 1 octet retiré", chunkSize + 1, headerSize + sealedChunk},
+		{"coupé au milieu d'un bloc", 2 * chunkSize, headerSize + sealedChunk + 100},
+		{"tag du dernier bloc tronqué", chunkSize + 1, headerSize + sealedChunk + 1 + tagSize - 1},
+		{"en-tête seul", chunkSize, headerSize},
+		{"en-tête tronqué", 10, headerSize - 1},
+		{"vide", 0, 0},
+	}
+	for _, test := range tests {
+		encrypted := encrypt(t, randomBytes(t, test.size), dataKey)
+		if _, err := decrypt(encrypted[:test.keep], dataKey); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s : %v, attendu ErrCorrupted", test.name, err)
+		}
+	}
+}
+
+func TestStreamReordered(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	sealedChunk := chunkSize + tagSize
+	encrypted := encrypt(t, randomBytes(t, 3*chunkSize), dataKey)
+
+	first := encrypted[headerSize : headerSize+sealedChunk]
+	second := encrypted[headerSize+sealedChunk : headerSize+2*sealedChunk]
+
+	swapped := append([]byte(nil), encrypted[:headerSize]...)
+	swapped = append(swapped, second...)
+	swapped = append(swapped, first...)
+	swapped = append(swapped, encrypted[headerSize+2*sealedChunk:]...)
+	if _, err := decrypt(swapped, dataKey); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("blocs permutés : %v, attendu ErrCorrupted", err)
+	}
+
+	// Un bloc dupliqué à la place d'un autre
+	duplicated := append([]byte(nil), encrypted...)
+	copy(duplicated[headerSize+sealedChunk:], first)
+	if _, err := decrypt(duplicated, dataKey); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("bloc dupliqué : %v, attendu ErrCorrupted", err)
+	}
+
+	// Le dernier bloc d'un autre fichier chiffré avec la même clé
+	other := encrypt(t, randomBytes(t, 3*chunkSize), dataKey)
+	spliced := append([]byte(nil), encrypted...)
+	copy(spliced[headerSize+2*sealedChunk:], other[headerSize+2*sealedChunk:])
+	if _, err := decrypt(spliced, dataKey); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("bloc d'un autre fichier : %v, attendu ErrCorrupted", err)
+	}
+}
+
+func TestStreamExtended(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	for _, size := range []int{0, 10, chunkSize} {
+		encrypted := encrypt(t, randomBytes(t, size), dataKey)
+		// Un bloc du même fichier rejoué à la fin
+		extended := append(append([]byte(nil), encrypted...), encrypted[headerSize:]...)
+		if _, err := decrypt(extended, dataKey); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%d octets rallongés : %v, attendu ErrCorrupted", size, err)
+		}
+	}
+}
+
+func TestStreamTampered(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	for _, size := range []int{0, 100, chunkSize + 1} {
+		encrypted := encrypt(t, randomBytes(t, size), dataKey)
+		positions := map[string]int{
+			"magic":               0,
+			"version":             len(magic),
+			"préfixe de nonce":    len(magic) + 1,
+			"premier octet":       headerSize,
+			"tag du premier bloc": headerSize + min(size, chunkSize) + tagSize - 1,
+			"dernier octet":       len(encrypted) - 1,
+		}
+		for name, position := range positions {
+			tampered := append([]byte(nil), encrypted...)
+			tampered[position] ^= 0x01
+			if _, err := decrypt(tampered, dataKey); !errors.Is(err, ErrCorrupted) {
+				t.Errorf("%d octets, %s modifié : %v, attendu ErrCorrupted", size, name, err)
+			}
+		}
+	}
+}
+
+func TestStreamSeek(t *testing.T) {
+	dataKey := randomBytes(t, dataKeySize)
+	plain := randomBytes(t, 3*chunkSize+5)
+	encrypted := encrypt(t, plain, dataKey)
+
+	r, size, err := newDecryptReader(seekableBuffer{bytes.NewReader(encrypted)}, dataKey, int64(len(encrypted)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(plain)) {
+		t.Fatalf("taille %d, attendu %d", size, len(plain))
+	}
+	seeker, ok := r.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("lecteur non positionnable sur un stockage positionnable")
+	}
+
+	// Requêtes Range : à cheval sur deux blocs, en arrière, jusqu'à la fin
+	for _, rng := range []struct{ offset, length int }{
+		{chunkSize - 10, 20},
+		{5, 10},
+		{2*chunkSize + 1, chunkSize + 4},
+		{len(plain) - 1, 1},
+	} {
+		if _, err := seeker.Seek(int64(rng.offset), io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, rng.length)
+		if _, err := io.ReadFull(seeker, got); err != nil {
+			t.Fatalf("lecture à %d : %v", rng.offset, err)
+		}
+		if !bytes.Equal(got, plain[rng.offset:rng.offset+rng.length]) {
+			t.Errorf("lecture à %d : contenu différent", rng.offset)
+		}
+	}
+	if _, err := seeker.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("lecture après la fin : %v, attendu EOF", err)
+	}
+
+	// Sans Seek possible, un retour en arrière est refusé
+	plainReader, _, err := newDecryptReader(io.NopCloser(bytes.NewReader(encrypted)), dataKey, int64(len(encrypted)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := plainReader.(io.Seeker); ok {
+		t.Error("lecteur positionnable sur un stockage qui ne l'est pas")
+	}
+}
@@ -0,0 +1,174 @@
+package entitlements
+
+import (
+	"backend-go/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fonctionnalités débloquées par un abonnement. FeaturePremiumQuotas donne
+// les quotas de l'abonnement premium (paquet quotas)
+const (
+	FeatureDocumentScanner = "document_scanner"
+	FeaturePremiumQuotas   = "premium_quotas"
+)
+
+// Features liste les fonctionnalités connues, dans l'ordre d'affichage
+var Features = []string{FeatureDocumentScanner, FeaturePremiumQuotas}
+
+// Prices associe chaque prix Stripe aux fonctionnalités qu'il débloque ; par
+// défaut les formules mensuelle et annuelle débloquent tout
+var Prices = map[string][]string{
+	"price_1RzNCQBO0KsxxPgtqALYncGp": Features,
+	"price_1RzN3OBO0KsxxPgtkwx0kuZJ": Features,
+}
+
+// CacheTTL est la durée pendant laquelle les droits d'un utilisateur sont
+// servis sans relire ses abonnements
+var CacheTTL = time.Minute
+
+type cacheEntry struct {
+	features  map[string]bool
+	expiresAt time.Time
+}
+
+var (
+	cacheMu   sync.Mutex
+	cache     = map[int]cacheEntry{}
+	lastSweep time.Time
+)
+
+// Init lit ENTITLEMENT_PRICES, "prix:fonctionnalité|fonctionnalité" séparés
+// par des virgules, qui remplace les prix par défaut, et ENTITLEMENT_CACHE_TTL,
+// une durée Go ("1m")
+func Init() {
+	if value := os.Getenv("ENTITLEMENT_PRICES"); value != "" {
+		prices, err := parsePrices(value)
+		if err != nil {
+			log.Fatalf("ENTITLEMENT_PRICES invalide: %v", err)
+		}
+		Prices = prices
+	}
+
+	if value := os.Getenv("ENTITLEMENT_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			log.Fatalf("ENTITLEMENT_CACHE_TTL invalide: %s", value)
+		}
+		CacheTTL = ttl
+	}
+}
+
+// parsePrices lit une liste de prix au format de ENTITLEMENT_PRICES
+func parsePrices(value string) (map[string][]string, error) {
+	known := map[string]bool{}
+	for _, feature := range Features {
+		known[feature] = true
+	}
+
+	prices := map[string][]string{}
+	for _, entry := range strings.Split(value, ",") {
+		priceID, list, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || priceID == "" {
+			return nil, fmt.Errorf("entrée %q : format attendu prix:fonctionnalité|fonctionnalité", entry)
+		}
+		if _, exists := prices[priceID]; exists {
+			return nil, fmt.Errorf("prix %s en double", priceID)
+		}
+		features := []string{}
+		for _, feature := range strings.Split(list, "|") {
+			feature = strings.TrimSpace(feature)
+			if feature == "" {
+				continue
+			}
+			if !known[feature] {
+				return nil, fmt.Errorf("prix %s : fonctionnalité %q inconnue", priceID, feature)
+			}
+			features = append(features, feature)
+		}
+		prices[priceID] = features
+	}
+	return prices, nil
+}
+
+// Queryer est *sql.DB ou *sql.Tx
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// For retourne les fonctionnalités débloquées par les abonnements actifs ou en
+// essai de l'utilisateur. Le résultat est gardé CacheTTL : un changement
+// d'abonnement passé par une autre réplique est vu au plus CacheTTL plus tard
+func For(ctx context.Context, db Queryer, userID int) (map[string]bool, error) {
+	cacheMu.Lock()
+	entry, ok := cache[userID]
+	cacheMu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.features, nil
+	}
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT stripe_price_id FROM subscriptions WHERE user_id = $1 AND status IN ($2, $3)",
+		userID, models.SubscriptionStatusActive, models.SubscriptionStatusTrialing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	features := map[string]bool{}
+	for rows.Next() {
+		var priceID string
+		if err := rows.Scan(&priceID); err != nil {
+			return nil, err
+		}
+		unlocked, ok := Prices[priceID]
+		if !ok {
+			log.Printf("⚠️  Prix Stripe %s sans fonctionnalités (ENTITLEMENT_PRICES), abonnement de l'utilisateur %d", priceID, userID)
+		}
+		for _, feature := range unlocked {
+			features[feature] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	// Les entrées expirées sont retirées au plus une fois par CacheTTL
+	if now.Sub(lastSweep) > CacheTTL {
+		for id, entry := range cache {
+			if !now.Before(entry.expiresAt) {
+				delete(cache, id)
+			}
+		}
+		lastSweep = now
+	}
+	cache[userID] = cacheEntry{features: features, expiresAt: now.Add(CacheTTL)}
+	return features, nil
+}
+
+// Has indique si l'utilisateur a accès à une fonctionnalité
+func Has(ctx context.Context, db Queryer, userID int, feature string) (bool, error) {
+	features, err := For(ctx, db, userID)
+	if err != nil {
+		return false, err
+	}
+	return features[feature], nil
+}
+
+// Invalidate oublie les droits en cache d'un utilisateur, après un changement
+// de son abonnement
+func Invalidate(userID int) {
+	cacheMu.Lock()
+	delete(cache, userID)
+	cacheMu.Unlock()
+}
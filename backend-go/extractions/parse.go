@@ -0,0 +1,185 @@
+package extractions
+
+import (
+	"backend-go/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Result est ce qu'on a pu lire dans le texte d'un document
+type Result struct {
+	Fields   map[string]string
+	Vehicle  models.SuggestedVehicleFields
+	Document models.SuggestedDocumentFields
+}
+
+// Immatriculation SIV (AB-123-CD, sans I, O ni U) ou ancien format FNI (1234 AB 56)
+const (
+	sivPlate = `[A-HJ-NP-TV-Z]{2}[- ]?\d{3}[- ]?[A-HJ-NP-TV-Z]{2}`
+	fniPlate = `\d{1,4}[- ]?[A-Z]{1,3}[- ]?(?:\d{2}|2[AB]|97\d)`
+	date     = `\d{2}[/.-]\d{2}[/.-]\d{4}`
+	vin      = `[A-HJ-NPR-Z0-9]{17}`
+	words    = `[A-Z0-9][A-Z0-9 &'/.+\-]*`
+)
+
+// label reconnaît un libellé du certificat d'immatriculation tel qu'il sort
+// de pdftotext ou de l'OCR : "D.1", "D1", "D. 1", "(D.1)", "D.1:"
+func label(name string) string {
+	return `(?:^|[\s(])` + strings.Replace(regexp.QuoteMeta(name), `\.`, `\.?\s?`, 1) + `[.:)]*[ \t]+`
+}
+
+// carteGriseFields associe chaque champ du certificat d'immatriculation au
+// format de sa valeur
+var carteGriseFields = []struct {
+	Name    string
+	Pattern *regexp.Regexp
+}{
+	{"A", regexp.MustCompile(label("A") + `(` + sivPlate + `|` + fniPlate + `)\b`)},
+	{"B", regexp.MustCompile(label("B") + `(` + date + `)`)},
+	{"D.1", regexp.MustCompile(label("D.1") + `(` + words + `)`)},
+	{"D.2", regexp.MustCompile(label("D.2") + `(` + words + `)`)},
+	{"D.3", regexp.MustCompile(label("D.3") + `(` + words + `)`)},
+	{"E", regexp.MustCompile(label("E") + `(` + vin + `)\b`)},
+	{"J.1", regexp.MustCompile(label("J.1") + `([A-Z]{2,5})\b`)},
+}
+
+var (
+	anyPlate   = regexp.MustCompile(`\b(` + sivPlate + `)\b`)
+	exactSIV   = regexp.MustCompile(`^` + sivPlate + `$`)
+	anyVIN     = regexp.MustCompile(`\b(` + vin + `)\b`)
+	nextLabel  = regexp.MustCompile(`\s{2,}|\s\(?[A-Z](?:\.\d+)*[.:)]*\s`)
+	period     = regexp.MustCompile(`(?i)\bdu\s+(` + date + `)\s+au\s+(` + date + `)`)
+	validUntil = regexp.MustCompile(`(?i)(?:jusqu'au|valable au|fin de validit[ée]|expire le)\s*:?\s*(` + date + `)`)
+)
+
+// Parse lit les champs d'un document de type docType (carte_grise ou assurance)
+func Parse(docType, content string) Result {
+	content = normalize(content)
+	switch docType {
+	case "carte_grise":
+		return parseCarteGrise(content)
+	case "assurance":
+		return parseAssurance(content)
+	}
+	return Result{Fields: map[string]string{}}
+}
+
+// parseCarteGrise lit les champs A (immatriculation), B (date de première
+// immatriculation), D.1 (marque), D.2 (type, variante, version), D.3
+// (dénomination commerciale), E (numéro VIN) et J.1 (genre national)
+func parseCarteGrise(content string) Result {
+	result := Result{Fields: map[string]string{}}
+	for _, field := range carteGriseFields {
+		if m := field.Pattern.FindStringSubmatch(content); m != nil {
+			if value := cleanValue(m[1]); value != "" {
+				result.Fields[field.Name] = value
+			}
+		}
+	}
+
+	// L'OCR perd parfois les libellés : l'immatriculation et le VIN se
+	// reconnaissent aussi à leur format
+	if _, ok := result.Fields["A"]; !ok {
+		if m := anyPlate.FindStringSubmatch(content); m != nil {
+			result.Fields["A"] = m[1]
+		}
+	}
+	if _, ok := result.Fields["E"]; !ok {
+		if m := anyVIN.FindStringSubmatch(content); m != nil && strings.ContainsAny(m[1], "0123456789") {
+			result.Fields["E"] = m[1]
+		}
+	}
+
+	if plate, ok := result.Fields["A"]; ok {
+		result.Vehicle.Plate = stringPtr(normalizePlate(plate))
+	}
+	if brand, ok := result.Fields["D.1"]; ok {
+		result.Vehicle.Brand = stringPtr(brand)
+	}
+	if model, ok := result.Fields["D.3"]; ok {
+		result.Vehicle.Model = stringPtr(model)
+	} else if model, ok := result.Fields["D.2"]; ok {
+		result.Vehicle.Model = stringPtr(model)
+	}
+	if registered, ok := parseDate(result.Fields["B"]); ok {
+		year := registered.Year()
+		result.Vehicle.Year = &year
+		result.Vehicle.FirstRegistrationDate = stringPtr(registered.Format("2006-01-02"))
+	}
+	if vin, ok := result.Fields["E"]; ok {
+		result.Vehicle.VIN = stringPtr(vin)
+	}
+	if category, ok := result.Fields["J.1"]; ok {
+		result.Vehicle.Category = stringPtr(category)
+	}
+	return result
+}
+
+// parseAssurance lit l'immatriculation et la période de validité d'une
+// attestation d'assurance ("du 01/01/2025 au 31/12/2025")
+func parseAssurance(content string) Result {
+	result := Result{Fields: map[string]string{}}
+
+	if m := anyPlate.FindStringSubmatch(content); m != nil {
+		result.Fields["plate"] = m[1]
+		result.Vehicle.Plate = stringPtr(normalizePlate(m[1]))
+	}
+
+	if m := period.FindStringSubmatch(content); m != nil {
+		result.Fields["valid_from"] = m[1]
+		result.Fields["valid_until"] = m[2]
+	} else if m := validUntil.FindStringSubmatch(content); m != nil {
+		result.Fields["valid_until"] = m[1]
+	}
+	if from, ok := parseDate(result.Fields["valid_from"]); ok {
+		result.Document.IssuedAt = stringPtr(from.Format("2006-01-02"))
+	}
+	if until, ok := parseDate(result.Fields["valid_until"]); ok {
+		result.Document.ExpiresAt = stringPtr(until.Format("2006-01-02"))
+	}
+	return result
+}
+
+// normalize uniformise les espaces et les tirets produits par l'OCR
+func normalize(content string) string {
+	return strings.NewReplacer(
+		" ", " ", " ", " ", "\t", "  ",
+		"‐", "-", "‑", "-", "–", "-", "—", "-",
+		"\r\n", "\n", "\r", "\n",
+	).Replace(content)
+}
+
+// cleanValue coupe la valeur au libellé suivant quand plusieurs champs sont
+// sur la même ligne
+func cleanValue(value string) string {
+	if loc := nextLabel.FindStringIndex(value); loc != nil {
+		value = value[:loc[0]]
+	}
+	return strings.TrimSpace(value)
+}
+
+// normalizePlate écrit l'immatriculation au format usuel : AB-123-CD ou 1234 AB 56
+func normalizePlate(plate string) string {
+	compact := strings.NewReplacer("-", "", " ", "").Replace(plate)
+	if len(compact) == 7 && exactSIV.MatchString(compact) {
+		return compact[:2] + "-" + compact[2:5] + "-" + compact[5:]
+	}
+	return strings.Join(strings.FieldsFunc(plate, func(r rune) bool { return r == '-' || r == ' ' }), " ")
+}
+
+func parseDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	value = strings.NewReplacer(".", "/", "-", "/").Replace(value)
+	parsed, err := time.Parse("02/01/2006", value)
+	if err != nil || parsed.Year() < 1900 {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,149 @@
+package extractions
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCarteGrise(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name: "pdftotext -layout",
+			content: "CERTIFICAT D'IMMATRICULATION\n" +
+				"A   AB-123-CD          B   15/03/2019\n" +
+				"D.1 RENAULT            D.2 5AJA13   D.3 CLIO\n" +
+				"E   VF15RBJ0D12345678  J.1 VP\n",
+			want: map[string]string{
+				"A": "AB-123-CD", "B": "15/03/2019", "D.1": "RENAULT", "D.2": "5AJA13",
+				"D.3": "CLIO", "E": "VF15RBJ0D12345678", "J.1": "VP",
+			},
+		},
+		{
+			name:    "plusieurs champs séparés d'un seul espace",
+			content: "D.1 PEUGEOT D.2 2DKFWM D.3 208 ACTIVE J.1 VP",
+			want:    map[string]string{"D.1": "PEUGEOT", "D.2": "2DKFWM", "D.3": "208 ACTIVE", "J.1": "VP"},
+		},
+		{
+			name:    "libellés entre parenthèses",
+			content: "(A) FG 456 HJ\n(B) 01.02.2020\n(D.1) CITROEN\n(D.3) C3\n(J.1) CTTE",
+			want:    map[string]string{"A": "FG 456 HJ", "B": "01.02.2020", "D.1": "CITROEN", "D.3": "C3", "J.1": "CTTE"},
+		},
+		{
+			name:    "libellés sans point",
+			content: "D1 TOYOTA\nD2 ZWE211\nD3 YARIS",
+			want:    map[string]string{"D.1": "TOYOTA", "D.2": "ZWE211", "D.3": "YARIS"},
+		},
+		{
+			name:    "libellés avec espace et deux-points",
+			content: "D. 1: DACIA\nD. 3: SANDERO\nE: UU1B5220559876543",
+			want:    map[string]string{"D.1": "DACIA", "D.3": "SANDERO", "E": "UU1B5220559876543"},
+		},
+		{
+			name:    "immatriculation FNI",
+			content: "A 1234 AB 56\nB 20-06-1998",
+			want:    map[string]string{"A": "1234 AB 56", "B": "20-06-1998"},
+		},
+		{
+			name:    "immatriculation FNI de Corse",
+			content: "A 123-ABC-2A",
+			want:    map[string]string{"A": "123-ABC-2A"},
+		},
+		{
+			name:    "libellés perdus par l'OCR",
+			content: "RENAULT CLIO\nGH-789-JK\nWVWZZZ1JZXW000001\n",
+			want:    map[string]string{"A": "GH-789-JK", "E": "WVWZZZ1JZXW000001"},
+		},
+		{
+			name:    "sans chiffre, ce n'est pas un VIN",
+			content: "CERTIFICATDIMMATR",
+			want:    map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Parse("carte_grise", test.content).Fields
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Fields = %v, attendu %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseCarteGriseVehicle(t *testing.T) {
+	result := Parse("carte_grise", "A AB123CD\nB 15/03/2019\nD.1 RENAULT\nD.2 5AJA13\nE VF15RBJ0D12345678\nJ.1 VP")
+	vehicle := result.Vehicle
+	checks := []struct {
+		field string
+		got   *string
+		want  string
+	}{
+		{"Plate", vehicle.Plate, "AB-123-CD"},
+		{"Brand", vehicle.Brand, "RENAULT"},
+		// Sans D.3, le modèle est le type D.2
+		{"Model", vehicle.Model, "5AJA13"},
+		{"FirstRegistrationDate", vehicle.FirstRegistrationDate, "2019-03-15"},
+		{"VIN", vehicle.VIN, "VF15RBJ0D12345678"},
+		{"Category", vehicle.Category, "VP"},
+	}
+	for _, check := range checks {
+		if check.got == nil || *check.got != check.want {
+			t.Errorf("%s = %v, attendu %q", check.field, check.got, check.want)
+		}
+	}
+	if vehicle.Year == nil || *vehicle.Year != 2019 {
+		t.Errorf("Year = %v, attendu 2019", vehicle.Year)
+	}
+}
+
+func TestParseAssurance(t *testing.T) {
+	tests := []struct {
+		name                   string
+		content                string
+		plate, issued, expires string
+	}{
+		{
+			name:    "période du … au …",
+			content: "Véhicule assuré : AB-123-CD\nPériode de validité du 01/01/2025 au 31/12/2025",
+			plate:   "AB-123-CD", issued: "2025-01-01", expires: "2025-12-31",
+		},
+		{
+			name:    "période en majuscules sur plusieurs espaces",
+			content: "IMMATRICULATION AB 123 CD   DU  01.04.2025   AU  31.03.2026",
+			plate:   "AB-123-CD", issued: "2025-04-01", expires: "2026-03-31",
+		},
+		{
+			name:    "date de fin seule",
+			content: "Attestation valable jusqu'au 30/06/2025 pour le véhicule EF-456-GH",
+			plate:   "EF-456-GH", expires: "2025-06-30",
+		},
+		{
+			name:    "date invalide",
+			content: "du 31/02/2025 au 99/99/2025",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := Parse("assurance", test.content)
+			if got := deref(result.Vehicle.Plate); got != test.plate {
+				t.Errorf("Plate = %q, attendu %q", got, test.plate)
+			}
+			if got := deref(result.Document.IssuedAt); got != test.issued {
+				t.Errorf("IssuedAt = %q, attendu %q", got, test.issued)
+			}
+			if got := deref(result.Document.ExpiresAt); got != test.expires {
+				t.Errorf("ExpiresAt = %q, attendu %q", got, test.expires)
+			}
+		})
+	}
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,177 @@
+package extractions
+
+import (
+	"backend-go/encryption"
+	"backend-go/media"
+	"backend-go/models"
+	"backend-go/storage"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// Statuts d'une extraction (colonne document_extractions.status)
+const (
+	StatusPending     = "pending"
+	StatusProcessing  = "processing"
+	StatusDone        = "done"
+	StatusFailed      = "failed"
+	StatusUnsupported = "unsupported"
+)
+
+// maxAttempts est le nombre d'essais avant de marquer une extraction en échec
+const maxAttempts = 3
+
+// retryAfter est le délai avant de reprendre une extraction en cours : l'OCR
+// d'une photo peut prendre plusieurs secondes, une réplique a pu s'arrêter
+const retryAfter = 10 * time.Minute
+
+var wake = make(chan struct{}, 1)
+
+// Notify réveille le worker après l'upload d'un document
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Supported indique si les champs d'un type de document peuvent être extraits
+func Supported(docType string) bool {
+	for _, t := range models.DocumentExtractionTypes {
+		if t == docType {
+			return true
+		}
+	}
+	return false
+}
+
+// Queue met (ou remet) en attente l'extraction d'un document et réveille le worker
+func Queue(db *sql.DB, documentID, userID int) error {
+	_, err := db.Exec(`
+		INSERT INTO document_extractions (document_id, user_id, status)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (document_id) DO UPDATE SET status = $3, attempts = 0, updated_at = CURRENT_TIMESTAMP`,
+		documentID, userID, StatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	Notify()
+	return nil
+}
+
+// Start lance le worker : il traite les extractions en attente au démarrage,
+// à chaque Notify et toutes les pollEvery. Plusieurs répliques peuvent
+// tourner en même temps, chaque extraction n'est prise que par une seule
+func Start(db *sql.DB, pollEvery time.Duration) {
+	go func() {
+		ticker := time.NewTicker(pollEvery)
+		defer ticker.Stop()
+
+		for {
+			for {
+				processed, err := processNext(db)
+				if err != nil {
+					log.Printf("Erreur worker extractions: %v", err)
+					break
+				}
+				if !processed {
+					break
+				}
+			}
+
+			select {
+			case <-wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processNext lit un document en attente ; retourne false s'il n'y en a aucun
+func processNext(db *sql.DB) (bool, error) {
+	var extractionID, attempts int
+	var filePath, docType string
+	err := db.QueryRow(`
+		UPDATE document_extractions e
+		SET status = $1, attempts = e.attempts + 1, updated_at = CURRENT_TIMESTAMP
+		FROM documents d
+		WHERE d.id = e.document_id AND e.id = (
+			SELECT id FROM document_extractions
+			WHERE status = $2
+			OR (status = $1 AND updated_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second')
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING e.id, d.file_path, d.type, e.attempts`,
+		StatusProcessing, StatusPending, int64(retryAfter.Seconds()),
+	).Scan(&extractionID, &filePath, &docType, &attempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Réplique arrêtée pendant le dernier essai
+	if attempts > maxAttempts {
+		return true, setStatus(db, extractionID, StatusFailed)
+	}
+
+	result, source, err := extract(db, storage.KeyFromPath(filePath), docType)
+	switch {
+	case err == nil:
+		fields, _ := json.Marshal(result.Fields)
+		vehicle, _ := json.Marshal(result.Vehicle)
+		document, _ := json.Marshal(result.Document)
+		_, err = db.Exec(`
+			UPDATE document_extractions
+			SET status = $2, source = $3, fields = $4, suggested_vehicle = $5, suggested_document = $6, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`,
+			extractionID, StatusDone, source, string(fields), string(vehicle), string(document),
+		)
+		return true, err
+	case errors.Is(err, media.ErrUnsupported), errors.Is(err, media.ErrInvalidImage):
+		return true, setStatus(db, extractionID, StatusUnsupported)
+	case errors.Is(err, storage.ErrNotFound):
+		log.Printf("Extraction %d impossible: fichier %s introuvable", extractionID, filePath)
+		return true, setStatus(db, extractionID, StatusFailed)
+	default:
+		log.Printf("Extraction %d impossible (essai %d/%d): %v", extractionID, attempts, maxAttempts, err)
+		// L'extraction reste en cours et sera reprise après retryAfter
+		if attempts >= maxAttempts {
+			return true, setStatus(db, extractionID, StatusFailed)
+		}
+	}
+	return true, nil
+}
+
+func setStatus(db *sql.DB, extractionID int, status string) error {
+	_, err := db.Exec("UPDATE document_extractions SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", extractionID, status)
+	return err
+}
+
+// extract lit le fichier, en extrait le texte et y cherche les champs du type de document
+func extract(db *sql.DB, key, docType string) (Result, string, error) {
+	reader, _, err := encryption.Get(context.Background(), db, key)
+	if err != nil {
+		return Result{}, "", err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return Result{}, "", err
+	}
+
+	text, source, err := media.ExtractText(data)
+	if err != nil {
+		return Result{}, "", err
+	}
+	return Parse(docType, text), source, nil
+}
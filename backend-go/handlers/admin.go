@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"backend-go/security"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateUserRole change le rôle d'un compte (réservé aux administrateurs). Les
+// sessions du compte sont révoquées pour que le nouveau rôle s'applique aussitôt
+func UpdateUserRole(c *gin.Context) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID utilisateur invalide"})
+		return
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Rôle invalide (user, garage ou admin)"})
+		return
+	}
+
+	// Un administrateur ne peut pas se retirer ses propres droits
+	if targetID == adminID.(int) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Impossible de modifier son propre rôle"})
+		return
+	}
+
+	var previousRole string
+	err = database.DB.QueryRow(`
+		UPDATE users u SET role = $1, updated_at = CURRENT_TIMESTAMP,
+			garage_id = CASE WHEN $1 = 'garage' THEN u.garage_id ELSE NULL END
+		FROM (SELECT id, role FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE u.id = old.id
+		RETURNING old.role`,
+		req.Role, targetID,
+	).Scan(&previousRole)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Utilisateur non trouvé"})
+		return
+	}
+
+	if err := revokeAllSessions(targetID); err != nil {
+		fmt.Printf("Erreur révocation sessions après changement de rôle: %v\n", err)
+	}
+
+	security.LogEvent(security.EventRoleChanged, &targetID, c.ClientIP(), map[string]interface{}{
+		"from":     previousRole,
+		"to":       req.Role,
+		"admin_id": adminID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rôle mis à jour avec succès",
+		"role":    req.Role,
+	})
+}
+
+// CreateGarage enregistre un garage partenaire
+func CreateGarage(c *gin.Context) {
+	var req models.CreateGarageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	var garageID int
+	err := database.DB.QueryRow(`
+		INSERT INTO garages (name, external_id, address, city, postal_code, phone, email)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (external_id) DO NOTHING
+		RETURNING id`,
+		req.Name, req.ExternalID, req.Address, req.City, req.PostalCode, req.Phone, req.Email,
+	).Scan(&garageID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"message": "Un garage existe déjà avec cet identifiant"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur création garage: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création garage"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Garage créé avec succès",
+		"garage_id": garageID,
+	})
+}
+
+// AddGarageStaff rattache un compte existant à un garage et lui donne le rôle garage
+func AddGarageStaff(c *gin.Context) {
+	garageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID garage invalide"})
+		return
+	}
+
+	var req models.AddGarageStaffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	var garageExists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM garages WHERE id = $1)", garageID).Scan(&garageExists)
+	if err != nil || !garageExists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Garage non trouvé"})
+		return
+	}
+
+	// Les administrateurs agissent déjà sur tous les garages
+	var staffID int
+	err = database.DB.QueryRow(`
+		UPDATE users SET role = $1, garage_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE email = $3 AND role <> $4
+		RETURNING id`,
+		models.RoleGarage, garageID, req.Email, models.RoleAdmin,
+	).Scan(&staffID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Utilisateur non trouvé. Le membre du personnel doit d'abord créer un compte."})
+		return
+	}
+
+	if err := revokeAllSessions(staffID); err != nil {
+		fmt.Printf("Erreur révocation sessions après rattachement garage: %v\n", err)
+	}
+
+	security.LogEvent(security.EventRoleChanged, &staffID, c.ClientIP(), map[string]interface{}{
+		"to":        models.RoleGarage,
+		"garage_id": garageID,
+		"admin_id":  c.GetInt("user_id"),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Compte rattaché au garage",
+		"user_id": staffID,
+	})
+}
+
+// RemoveGarageStaff détache un membre du personnel, qui redevient un simple utilisateur
+func RemoveGarageStaff(c *gin.Context) {
+	garageID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID garage invalide"})
+		return
+	}
+
+	staffID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID utilisateur invalide"})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE users SET role = $1, garage_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND garage_id = $3 AND role = $4`,
+		models.RoleUser, staffID, garageID, models.RoleGarage,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour utilisateur"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Membre du personnel non trouvé"})
+		return
+	}
+
+	if err := revokeAllSessions(staffID); err != nil {
+		fmt.Printf("Erreur révocation sessions après détachement garage: %v\n", err)
+	}
+
+	security.LogEvent(security.EventRoleChanged, &staffID, c.ClientIP(), map[string]interface{}{
+		"from":      models.RoleGarage,
+		"to":        models.RoleUser,
+		"garage_id": garageID,
+		"admin_id":  c.GetInt("user_id"),
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Compte détaché du garage"})
+}
+
+// GetMissingFiles liste les lignes dont le fichier est introuvable dans le
+// stockage, relevées par la dernière réconciliation
+func GetMissingFiles(c *gin.Context) {
+	rows, err := database.DB.Query(`
+		SELECT source, record_id, storage_key, detected_at
+		FROM missing_files
+		ORDER BY detected_at DESC, source, record_id`)
+	if err != nil {
+		fmt.Printf("Erreur lecture fichiers manquants: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture fichiers manquants"})
+		return
+	}
+	defer rows.Close()
+
+	missingFiles := []models.MissingFileResponse{}
+	for rows.Next() {
+		var missing models.MissingFileResponse
+		if err := rows.Scan(&missing.Source, &missing.RecordID, &missing.StorageKey, &missing.DetectedAt); err != nil {
+			fmt.Printf("Erreur lecture fichier manquant: %v\n", err)
+			continue
+		}
+		missingFiles = append(missingFiles, missing)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"missing_files": missingFiles})
+}
@@ -38,6 +38,16 @@ func CreateAppointment(c *gin.Context) {
 		return
 	}
 
+	// Vérifier que le véhicule appartient à l'utilisateur
+	if req.VehicleID != nil {
+		var vehicleExists bool
+		err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM vehicles WHERE id = $1 AND user_id = $2)", *req.VehicleID, userID).Scan(&vehicleExists)
+		if err != nil || !vehicleExists {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Véhicule non trouvé"})
+			return
+		}
+	}
+
 	var appointmentID int
 	err = database.DB.QueryRow(`
 		INSERT INTO appointments (user_id, vehicle_id, garage_name, garage_id, date, time, service, description, status) 
@@ -68,6 +78,7 @@ func GetUserAppointments(c *gin.Context) {
 	rows, err := database.DB.Query(`
 		SELECT a.id, a.vehicle_id, a.garage_name, a.garage_id, a.date, a.time, 
 		       a.service, a.description, a.status, a.created_at,
+		       a.proposed_date, a.proposed_time, a.garage_note,
 		       v.id, v.plate, v.model, v.brand, v.year, v.mileage, v.technical_control_date, v.image_url, v.brand_image_url
 		FROM appointments a
 		LEFT JOIN vehicles v ON a.vehicle_id = v.id
@@ -95,6 +106,7 @@ func GetUserAppointments(c *gin.Context) {
 			&appointment.ID, &vehicleID, &appointment.GarageName, &appointment.GarageID,
 			&appointment.Date, &appointment.Time, &appointment.Service, &appointment.Description,
 			&appointment.Status, &appointment.CreatedAt,
+			&appointment.ProposedDate, &appointment.ProposedTime, &appointment.GarageNote,
 			&vehicleID, &vehiclePlate, &vehicleModel, &vehicleBrand, &vehicleYear,
 			&vehicleMileage, &vehicleTechnicalControl, &vehicleImageURL, &vehicleBrandImageURL,
 		)
@@ -171,6 +183,7 @@ func GetAppointment(c *gin.Context) {
 	err = database.DB.QueryRow(`
 		SELECT a.id, a.vehicle_id, a.garage_name, a.garage_id, a.date, a.time, 
 		       a.service, a.description, a.status, a.created_at,
+		       a.proposed_date, a.proposed_time, a.garage_note,
 		       v.id, v.plate, v.model, v.brand, v.year, v.mileage, v.technical_control_date, v.image_url, v.brand_image_url
 		FROM appointments a
 		LEFT JOIN vehicles v ON a.vehicle_id = v.id
@@ -180,6 +193,7 @@ func GetAppointment(c *gin.Context) {
 		&appointment.ID, &vehicleID, &appointment.GarageName, &appointment.GarageID,
 		&appointment.Date, &appointment.Time, &appointment.Service, &appointment.Description,
 		&appointment.Status, &appointment.CreatedAt,
+		&appointment.ProposedDate, &appointment.ProposedTime, &appointment.GarageNote,
 		&vehicleID, &vehiclePlate, &vehicleModel, &vehicleBrand, &vehicleYear,
 		&vehicleMileage, &vehicleTechnicalControl, &vehicleImageURL, &vehicleBrandImageURL,
 	)
@@ -297,6 +311,11 @@ func UpdateAppointment(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Statut invalide"})
 			return
 		}
+		// Le client peut seulement annuler, les autres statuts sont décidés par le garage
+		if req.Status != models.AppointmentStatusCancelled {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Seule l'annulation est possible"})
+			return
+		}
 		updateFields = append(updateFields, "status = $"+strconv.Itoa(paramCount))
 		updateValues = append(updateValues, req.Status)
 		paramCount++
@@ -337,11 +356,12 @@ func UpdateAppointment(c *gin.Context) {
 	})
 }
 
-// ValidateAppointment valide ou rejette un rendez-vous (pour les garages)
+// ValidateAppointment valide ou rejette un rendez-vous du garage de l'appelant
+// (rôles garage et admin). Conservée pour l'application, le garage dispose
+// aussi des routes /garage/appointments/...
 func ValidateAppointment(c *gin.Context) {
-	appointmentID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de rendez-vous invalide"})
+	garageID, ok := staffGarageID(c)
+	if !ok {
 		return
 	}
 
@@ -355,38 +375,69 @@ func ValidateAppointment(c *gin.Context) {
 		return
 	}
 
-	var newStatus string
 	switch req.Action {
 	case "validate":
-		newStatus = models.AppointmentStatusValidated
+		updateAppointmentStatus(c, garageID, garageValidateFrom, models.AppointmentStatusValidated, "")
 	case "reject":
-		newStatus = models.AppointmentStatusRejected
+		updateAppointmentStatus(c, garageID, garageRejectFrom, models.AppointmentStatusRejected, req.Reason)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Action invalide (validate ou reject requis)"})
+	}
+}
+
+// RespondToProposal permet au client d'accepter ou de refuser le créneau
+// proposé par le garage. Accepté, il remplace la date et confirme le rendez-vous ;
+// refusé, la demande repasse en attente
+func RespondToProposal(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
 		return
 	}
 
-	// Mettre à jour le statut
-	query := "UPDATE appointments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2"
-	result, err := database.DB.Exec(query, newStatus, appointmentID)
+	appointmentID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lors de la validation", "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de rendez-vous invalide"})
 		return
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Rendez-vous non trouvé"})
+	var req models.AppointmentProposalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	var query, newStatus string
+	switch req.Action {
+	case "accept":
+		newStatus = models.AppointmentStatusConfirmed
+		query = `UPDATE appointments SET status = $1, date = proposed_date, time = proposed_time,
+			proposed_date = NULL, proposed_time = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2 AND user_id = $3 AND status = $4`
+	case "decline":
+		newStatus = models.AppointmentStatusPending
+		query = `UPDATE appointments SET status = $1, proposed_date = NULL, proposed_time = NULL,
+			updated_at = CURRENT_TIMESTAMP
+			WHERE id = $2 AND user_id = $3 AND status = $4`
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Action invalide (accept ou decline requis)"})
 		return
 	}
 
-	actionMsg := "validé"
-	if req.Action == "reject" {
-		actionMsg = "refusé"
+	result, err := database.DB.Exec(query, newStatus, appointmentID, userID, models.AppointmentStatusProposed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour rendez-vous"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Aucune proposition en attente pour ce rendez-vous"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Rendez-vous " + actionMsg + " avec succès",
+		"message": "Réponse à la proposition enregistrée",
 		"status":  newStatus,
 	})
 }
@@ -2,16 +2,18 @@ package handlers
 
 import (
 	"backend-go/database"
+	"backend-go/mailer"
 	"backend-go/models"
+	"backend-go/security"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -59,14 +61,13 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Générer un token JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"email":   req.Email,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 jours
-	})
+	// Envoyer le lien de confirmation de l'adresse email
+	if err := sendVerificationEmail(c, userID, req.Email, req.FullName, ""); err != nil {
+		fmt.Printf("Erreur envoi email de vérification: %v\n", err)
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// Ouvrir une session et générer les jetons
+	tokens, err := issueSession(c, userID, req.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
 		return
@@ -79,7 +80,9 @@ func Register(c *gin.Context) {
 			Email:    req.Email,
 			FullName: req.FullName,
 		},
-		"token": tokenString,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -90,14 +93,29 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Réserver la tentative, ou la refuser si le compte ou l'adresse IP est
+	// temporairement bloqué
+	ip := c.ClientIP()
+	attempt, wait, err := reserveLoginAttempt(req.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return
+	}
+	if wait > 0 {
+		security.LogEvent(security.EventLoginThrottled, nil, ip, map[string]interface{}{"email": req.Email})
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
 	// Chercher l'utilisateur
 	var user models.User
-	err := database.DB.QueryRow(
-		"SELECT id, email, password, full_name FROM users WHERE email = $1",
+	err = database.DB.QueryRow(
+		"SELECT id, email, password, full_name, email_verified, totp_enabled, role FROM users WHERE email = $1",
 		req.Email,
-	).Scan(&user.ID, &user.Email, &user.Password, &user.FullName)
+	).Scan(&user.ID, &user.Email, &user.Password, &user.FullName, &user.EmailVerified, &user.TOTPEnabled, &user.Role)
 
 	if err != nil {
+		attempt.failed(nil)
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Email ou mot de passe incorrect"})
 		return
 	}
@@ -105,18 +123,32 @@ func Login(c *gin.Context) {
 	// Vérifier le mot de passe
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
+		attempt.failed(&user.ID)
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Email ou mot de passe incorrect"})
 		return
 	}
 
-	// Générer un token JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 jours
-	})
+	// Connexion réussie : effacer les échecs du compte
+	attempt.succeeded()
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// Double authentification : la session ne sera ouverte qu'avec un code valide
+	if user.TOTPEnabled {
+		challenge, err := issueTwoFactorChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(twoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	// Ouvrir une session et générer les jetons
+	tokens, err := issueSession(c, user.ID, user.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
 		return
@@ -124,11 +156,15 @@ func Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"user": models.UserResponse{
-			ID:       user.ID,
-			Email:    user.Email,
-			FullName: user.FullName,
+			ID:            user.ID,
+			Email:         user.Email,
+			FullName:      user.FullName,
+			EmailVerified: user.EmailVerified,
+			Role:          user.Role,
 		},
-		"token": tokenString,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -228,14 +264,13 @@ func RegisterWithVehicle(c *gin.Context) {
 		return
 	}
 
-	// Générer un token JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"email":   req.Email,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 jours
-	})
+	// Envoyer le lien de confirmation de l'adresse email
+	if err := sendVerificationEmail(c, userID, req.Email, req.FullName, ""); err != nil {
+		fmt.Printf("Erreur envoi email de vérification: %v\n", err)
+	}
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	// Ouvrir une session et générer les jetons
+	tokens, err := issueSession(c, userID, req.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
 		return
@@ -248,7 +283,9 @@ func RegisterWithVehicle(c *gin.Context) {
 			Email:    req.Email,
 			FullName: req.FullName,
 		},
-		"token": tokenString,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -261,8 +298,8 @@ func ForgotPassword(c *gin.Context) {
 
 	// Vérifier si l'utilisateur existe
 	var userID int
-	var email string
-	err := database.DB.QueryRow("SELECT id, email FROM users WHERE email = $1", req.Email).Scan(&userID, &email)
+	var email, fullName string
+	err := database.DB.QueryRow("SELECT id, email, full_name FROM users WHERE email = $1", req.Email).Scan(&userID, &email, &fullName)
 	if err != nil {
 		// Ne pas révéler si l'email existe ou non pour des raisons de sécurité
 		c.JSON(http.StatusOK, gin.H{"message": "Si cet email existe, un lien de réinitialisation a été envoyé."})
@@ -290,17 +327,34 @@ func ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// TODO: Envoyer l'email avec le lien de réinitialisation
-	// Pour l'instant, on retourne le token (à ne pas faire en production)
-	resetLink := fmt.Sprintf("http://yourapp.com/reset-password?token=%s", resetToken)
-	
-	// En développement, log le lien
-	fmt.Printf("🔗 Lien de réinitialisation pour %s: %s\n", email, resetLink)
+	// Envoyer l'email avec le lien de réinitialisation
+	lang := req.Language
+	if lang == "" {
+		lang = c.GetHeader("Accept-Language")
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Si cet email existe, un lien de réinitialisation a été envoyé.",
-		"resetLink": resetLink, // Temporaire pour les tests
+	msg, err := mailer.Render("password_reset", lang, email, gin.H{
+		"Name":             fullName,
+		"Link":             passwordResetLink(resetToken),
+		"ExpiresInMinutes": 60,
 	})
+	if err != nil {
+		fmt.Printf("Erreur préparation email de réinitialisation: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur envoi email"})
+		return
+	}
+	mailer.SendAsync(msg)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Si cet email existe, un lien de réinitialisation a été envoyé."})
+}
+
+// passwordResetLink construit le lien ouvert depuis l'email de réinitialisation
+func passwordResetLink(token string) string {
+	baseURL := os.Getenv("PASSWORD_RESET_URL")
+	if baseURL == "" {
+		baseURL = "https://saveyourcar.fr/reset-password"
+	}
+	return baseURL + "?token=" + url.QueryEscape(token)
 }
 
 func ResetPassword(c *gin.Context) {
@@ -310,28 +364,45 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
+	// Limiter les essais de tokens depuis une même adresse IP : la tentative
+	// est comptée avant la vérification du token
+	ip := c.ClientIP()
+	wait, locked, err := security.ResetPasswordByIP.Attempt(ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return
+	}
+	if wait > 0 {
+		security.LogEvent(security.EventResetThrottled, nil, ip, nil)
+		respondTooManyAttempts(c, wait)
+		return
+	}
+
 	// Vérifier le token
 	var userID int
 	var expiresAt time.Time
 	var used bool
-	err := database.DB.QueryRow(
+	err = database.DB.QueryRow(
 		"SELECT user_id, expires_at, used FROM password_reset_tokens WHERE token = $1",
 		req.Token,
 	).Scan(&userID, &expiresAt, &used)
 
 	if err != nil {
+		recordResetFailure(ip, nil, "unknown", locked)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Token invalide"})
 		return
 	}
 
 	// Vérifier l'expiration
 	if time.Now().After(expiresAt) {
+		recordResetFailure(ip, &userID, "expired", locked)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Token expiré"})
 		return
 	}
 
 	// Vérifier si déjà utilisé
 	if used {
+		recordResetFailure(ip, &userID, "used", locked)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Token déjà utilisé"})
 		return
 	}
@@ -357,5 +428,26 @@ func ResetPassword(c *gin.Context) {
 		fmt.Printf("Erreur marquage token comme utilisé: %v\n", err)
 	}
 
+	// Invalider toutes les sessions existantes
+	if err := revokeAllSessions(userID); err != nil {
+		fmt.Printf("Erreur révocation sessions: %v\n", err)
+	}
+
+	if err := security.ResetPasswordByIP.Release(ip); err != nil {
+		fmt.Printf("Erreur remise à zéro des échecs réinitialisation: %v\n", err)
+	}
+
+	security.LogEvent(security.EventPasswordResetDone, &userID, ip, nil)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Mot de passe réinitialisé avec succès"})
+}
+
+// recordResetFailure journalise un token de réinitialisation invalide, déjà
+// compté par ResetPasswordByIP.Attempt ; locked indique que l'adresse IP est
+// désormais verrouillée
+func recordResetFailure(ip string, userID *int, reason string, locked bool) {
+	security.LogEvent(security.EventResetTokenInvalid, userID, ip, map[string]interface{}{"reason": reason})
+	if locked {
+		security.LogEvent(security.EventIPLocked, nil, ip, map[string]interface{}{"scope": security.ResetPasswordByIP.Scope})
+	}
 }
\ No newline at end of file
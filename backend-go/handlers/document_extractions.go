@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/extractions"
+	"backend-go/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDocumentExtraction retourne les champs lus sur une carte grise ou une
+// attestation d'assurance et les valeurs proposées pour le véhicule. Tant que
+// status vaut "pending" ou "processing", l'application rappelle plus tard
+func GetDocumentExtraction(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	var extraction models.DocumentExtraction
+	var fields []byte
+	var suggestedVehicle, suggestedDocument []byte
+	err = database.DB.QueryRow(`
+		SELECT e.id, e.document_id, d.vehicle_id, e.status, e.source, e.fields, e.suggested_vehicle, e.suggested_document, e.created_at, e.updated_at
+		FROM document_extractions e
+		JOIN documents d ON d.id = e.document_id
+		WHERE e.document_id = $1 AND d.user_id = $2 AND d.deleted_at IS NULL`, documentID, userID).Scan(
+		&extraction.ID, &extraction.DocumentID, &extraction.VehicleID, &extraction.Status, &extraction.Source,
+		&fields, &suggestedVehicle, &suggestedDocument, &extraction.CreatedAt, &extraction.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Aucune extraction pour ce document"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur récupération extraction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération extraction"})
+		return
+	}
+
+	if err := json.Unmarshal(fields, &extraction.Fields); err != nil {
+		extraction.Fields = map[string]string{}
+	}
+	if suggestedVehicle != nil {
+		json.Unmarshal(suggestedVehicle, &extraction.SuggestedVehicle)
+	}
+	if suggestedDocument != nil {
+		json.Unmarshal(suggestedDocument, &extraction.SuggestedDocument)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"extraction": extraction})
+}
+
+// ExtractDocument (re)lance la lecture d'un document, par exemple envoyé
+// avant la mise en place de l'extraction ou en échec
+func ExtractDocument(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	var docType string
+	err = database.DB.QueryRow("SELECT type FROM documents WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", documentID, userID).Scan(&docType)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+		return
+	}
+
+	if !extractions.Supported(docType) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"message":         "Extraction non disponible pour ce type de document",
+			"code":            "extraction_not_supported",
+			"supported_types": models.DocumentExtractionTypes,
+		})
+		return
+	}
+
+	if err := extractions.Queue(database.DB, documentID, userID.(int)); err != nil {
+		fmt.Printf("Erreur mise en attente extraction: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lancement extraction"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Extraction lancée", "status": extractions.StatusPending})
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"backend-go/shares"
+	"backend-go/storage"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateDocumentShare crée un lien public vers un document, valable
+// expires_in secondes et éventuellement utilisable une seule fois
+func CreateDocumentShare(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	var req models.DocumentShareRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message":        "Données invalides",
+				"error":          err.Error(),
+				"min_expires_in": int(shares.MinTTL.Seconds()),
+				"max_expires_in": int(shares.MaxTTL.Seconds()),
+			})
+			return
+		}
+	}
+
+	ttl := shares.DefaultTTL
+	if req.ExpiresIn != nil {
+		// expires_in est borné à la validation : la conversion ne peut pas déborder
+		ttl = time.Duration(*req.ExpiresIn) * time.Second
+	}
+	if req.Label != nil && len(*req.Label) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Libellé trop long"})
+		return
+	}
+
+	var documentExists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM documents WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)", documentID, userID).Scan(&documentExists)
+	if err != nil || !documentExists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+		return
+	}
+
+	tokenID, err := shares.NewTokenID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création du lien"})
+		return
+	}
+
+	// Le jeton porte l'expiration à la seconde près : elle doit se relire à l'identique
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl).Truncate(time.Second)
+
+	share := models.DocumentShare{
+		DocumentID: documentID,
+		Label:      req.Label,
+		SingleUse:  req.SingleUse,
+		Status:     shares.StatusActive,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+	}
+	err = database.DB.QueryRow(`
+		INSERT INTO document_shares (document_id, user_id, token_id, label, single_use, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		documentID, userID, tokenID, req.Label, req.SingleUse, expiresAt, now,
+	).Scan(&share.ID)
+	if err != nil {
+		fmt.Printf("Erreur création partage: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création du lien"})
+		return
+	}
+
+	url := shares.URL(tokenID, expiresAt)
+	share.URL = &url
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Lien de partage créé", "share": share})
+}
+
+// GetDocumentShares liste les liens de partage d'un document avec leur
+// nombre d'accès
+func GetDocumentShares(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT s.id, s.document_id, s.token_id, s.label, s.single_use, s.expires_at, s.first_used_at, s.revoked_at, s.created_at,
+		       COUNT(a.id), MAX(a.accessed_at)
+		FROM document_shares s
+		LEFT JOIN document_share_accesses a ON a.share_id = s.id
+		WHERE s.document_id = $1 AND s.user_id = $2
+		GROUP BY s.id
+		ORDER BY s.created_at DESC`, documentID, userID)
+	if err != nil {
+		fmt.Printf("Erreur récupération partages: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération des partages"})
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	result := []models.DocumentShare{}
+	for rows.Next() {
+		var share models.DocumentShare
+		var tokenID string
+		err := rows.Scan(&share.ID, &share.DocumentID, &tokenID, &share.Label, &share.SingleUse, &share.ExpiresAt,
+			&share.FirstUsedAt, &share.RevokedAt, &share.CreatedAt, &share.AccessCount, &share.LastAccessedAt)
+		if err != nil {
+			continue
+		}
+		share.Status = shares.Status(share.ExpiresAt, share.RevokedAt, share.SingleUse, share.FirstUsedAt, now)
+		if share.Status == shares.StatusActive {
+			url := shares.URL(tokenID, share.ExpiresAt)
+			share.URL = &url
+		}
+		result = append(result, share)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shares": result})
+}
+
+// RevokeDocumentShare rend un lien de partage inutilisable
+func RevokeDocumentShare(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+	shareID, err := strconv.Atoi(c.Param("share_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID partage invalide"})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE document_shares SET revoked_at = COALESCE(revoked_at, $1)
+		WHERE id = $2 AND document_id = $3 AND user_id = $4`,
+		time.Now().UTC(), shareID, documentID, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur révocation du lien"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Partage non trouvé"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lien de partage révoqué"})
+}
+
+// GetDocumentShareAccesses retourne le journal des accès à un lien de partage
+func GetDocumentShareAccesses(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+	shareID, err := strconv.Atoi(c.Param("share_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID partage invalide"})
+		return
+	}
+
+	var shareExists bool
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM document_shares WHERE id = $1 AND document_id = $2 AND user_id = $3)", shareID, documentID, userID).Scan(&shareExists)
+	if err != nil || !shareExists {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Partage non trouvé"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT id, outcome, ip_address, user_agent, accessed_at
+		FROM document_share_accesses
+		WHERE share_id = $1
+		ORDER BY accessed_at DESC
+		LIMIT 200`, shareID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération des accès"})
+		return
+	}
+	defer rows.Close()
+
+	accesses := []models.DocumentShareAccess{}
+	for rows.Next() {
+		var access models.DocumentShareAccess
+		if err := rows.Scan(&access.ID, &access.Outcome, &access.IPAddress, &access.UserAgent, &access.AccessedAt); err != nil {
+			continue
+		}
+		accesses = append(accesses, access)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accesses": accesses})
+}
+
+// GetSharedDocument sert un document partagé, sans authentification. La
+// signature est vérifiée avant toute requête en base ; chaque accès à un lien
+// authentique, accepté ou refusé, est journalisé pour le propriétaire
+func GetSharedDocument(c *gin.Context) {
+	now := time.Now().UTC()
+	tokenID, err := shares.Verify(c.Param("token"), now)
+	if errors.Is(err, shares.ErrInvalidToken) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Lien de partage invalide"})
+		return
+	}
+
+	var shareID int
+	var revokedAt *time.Time
+	var filePath, fileName, mimeType string
+	queryErr := database.DB.QueryRow(`
+		SELECT s.id, s.revoked_at, d.file_path, d.file_name, d.mime_type
+		FROM document_shares s
+		JOIN documents d ON d.id = s.document_id AND d.deleted_at IS NULL
+		WHERE s.token_id = $1`, tokenID).Scan(&shareID, &revokedAt, &filePath, &fileName, &mimeType)
+	if queryErr == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Lien de partage invalide"})
+		return
+	}
+	if queryErr != nil {
+		fmt.Printf("Erreur lecture partage: %v\n", queryErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture du lien"})
+		return
+	}
+
+	ip := c.ClientIP()
+	outcome := shares.OutcomeOK
+	switch {
+	case revokedAt != nil:
+		outcome = shares.StatusRevoked
+	case errors.Is(err, shares.ErrExpired):
+		outcome = shares.StatusExpired
+	default:
+		// Le premier accès est enregistré ; un lien à usage unique reste ouvert
+		// quelques minutes pour la même adresse IP
+		result, err := database.DB.Exec(`
+			UPDATE document_shares
+			SET first_used_at = COALESCE(first_used_at, $2), first_used_ip = COALESCE(first_used_ip, $3)
+			WHERE id = $1 AND (NOT single_use OR first_used_at IS NULL OR (first_used_ip = $3 AND first_used_at > $4))`,
+			shareID, now, ip, now.Add(-shares.SingleUseGrace),
+		)
+		if err != nil {
+			fmt.Printf("Erreur mise à jour partage: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture du lien"})
+			return
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			outcome = shares.StatusUsed
+		}
+	}
+
+	_, logErr := database.DB.Exec(
+		"INSERT INTO document_share_accesses (share_id, outcome, ip_address, user_agent, accessed_at) VALUES ($1, $2, $3, $4, $5)",
+		shareID, outcome, ip, c.Request.UserAgent(), now,
+	)
+	if logErr != nil {
+		fmt.Printf("Erreur journalisation accès partage: %v\n", logErr)
+	}
+
+	if outcome != shares.OutcomeOK {
+		c.JSON(http.StatusGone, gin.H{"message": "Ce lien de partage n'est plus valable", "code": "share_" + outcome})
+		return
+	}
+
+	// Le lien ne doit ni être indexé ni fuiter vers d'autres sites
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Robots-Tag", "noindex, nofollow")
+	c.Header("Referrer-Policy", "no-referrer")
+	download := c.Query("download") == "1"
+	if !download {
+		c.Header("Content-Disposition", storage.ContentDisposition("inline", fileName))
+	}
+	serveStoredFile(c, storage.KeyFromPath(filePath), fileName, mimeType, download)
+}
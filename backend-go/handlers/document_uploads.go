@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/encryption"
+	"backend-go/media"
+	"backend-go/models"
+	"backend-go/quotas"
+	"backend-go/resumable"
+	"backend-go/storage"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Envois reprenables (protocole tus 1.0) : POST /documents/uploads crée
+// l'envoi avec les champs du document dans Upload-Metadata, les requêtes
+// PATCH envoient la suite du fichier à partir de Upload-Offset et HEAD donne
+// la position à laquelle reprendre après une coupure. Le document est créé
+// à la réception du dernier octet, comme par POST /documents
+
+// documentUpload est un envoi reprenable lu en base
+type documentUpload struct {
+	ID          string
+	VehicleID   int
+	Name        string
+	Type        string
+	Description *string
+	FileName    string
+	IssuedAt    *time.Time
+	ExpiresAt   *time.Time
+	Length      int64
+	Offset      int64
+	Status      string
+	DocumentID  *int
+	Expires     time.Time
+	CreatedAt   time.Time
+}
+
+var errUploadPartTooLarge = errors.New("morceau plus grand que la taille restante de l'envoi")
+
+// uploadPartReader lit le corps d'une requête PATCH. Au-delà de la taille
+// restante de l'envoi, il retourne errUploadPartTooLarge ; une coupure de
+// connexion termine le morceau comme une fin normale, les octets reçus sont
+// conservés et le client reprend à la position retournée par HEAD
+type uploadPartReader struct {
+	body      io.Reader
+	remaining int64
+	read      int64
+}
+
+func (r *uploadPartReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.read += int64(n)
+	if r.read > r.remaining {
+		return 0, errUploadPartTooLarge
+	}
+	if err != nil && err != io.EOF {
+		return n, io.EOF
+	}
+	return n, err
+}
+
+// SetTusOptions ajoute à la réponse d'une requête OPTIONS les en-têtes de
+// découverte du protocole tus
+func SetTusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", resumable.Version)
+	c.Header("Tus-Version", resumable.Version)
+	c.Header("Tus-Extension", resumable.Extensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(media.MaxDocumentSize, 10))
+}
+
+// tusRequest ajoute l'en-tête Tus-Resumable à la réponse et vérifie que le
+// client utilise la même version du protocole ; sinon la réponse est envoyée
+func tusRequest(c *gin.Context) bool {
+	c.Header("Tus-Resumable", resumable.Version)
+	if c.GetHeader("Tus-Resumable") != resumable.Version {
+		c.Header("Tus-Version", resumable.Version)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"message": "Version du protocole tus non supportée", "code": "tus_version_unsupported"})
+		return false
+	}
+	return true
+}
+
+// setUploadHeaders ajoute la position, la taille et l'expiration d'un envoi à la réponse
+func setUploadHeaders(c *gin.Context, upload *documentUpload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+}
+
+// CreateDocumentUpload crée un envoi reprenable. Le type, les dates, le
+// véhicule et les quotas sont vérifiés dès la création, avant l'envoi du fichier
+func CreateDocumentUpload(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+	if !tusRequest(c) {
+		return
+	}
+
+	// L'extension creation-defer-length n'est pas supportée : la taille est
+	// connue dès la création
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Upload-Length invalide"})
+		return
+	}
+	if length > media.MaxDocumentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"message":  "Fichier trop volumineux",
+			"code":     "file_too_large",
+			"max_size": media.MaxDocumentSize,
+		})
+		return
+	}
+
+	metadata, err := resumable.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Upload-Metadata invalide"})
+		return
+	}
+	req, err := documentRequestFromMetadata(metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	if _, _, _, ok := checkDocumentRequest(c, userID.(int), req); !ok {
+		return
+	}
+	// Quotas de l'abonnement, vérifiés à nouveau à la création du document
+	if !checkQuota(c, quotas.CheckDocument(c.Request.Context(), database.DB, userID.(int), req.VehicleID, length)) {
+		return
+	}
+
+	id, err := resumable.NewID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création envoi"})
+		return
+	}
+
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = "document"
+	}
+
+	// Les dates saisies sont conservées telles quelles, elles sont vérifiées
+	// à nouveau à la création du document
+	upload := &documentUpload{ID: id, Length: length}
+	err = database.DB.QueryRow(`
+		INSERT INTO document_uploads (id, user_id, vehicle_id, name, type, description, file_name, issued_at, expires_at, upload_length, upload_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, CURRENT_TIMESTAMP + $11 * INTERVAL '1 second')
+		RETURNING upload_expires_at`,
+		id, userID, req.VehicleID, req.Name, req.Type, req.Description, fileName,
+		req.IssuedAt, req.ExpiresAt, length, int64(resumable.TTL.Seconds()),
+	).Scan(&upload.Expires)
+	if err != nil {
+		fmt.Printf("Erreur création envoi: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création envoi"})
+		return
+	}
+
+	c.Header("Location", "/documents/uploads/"+id)
+	c.Header("Upload-Expires", upload.Expires.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// documentRequestFromMetadata lit les champs d'un document dans les
+// métadonnées d'un envoi : les mêmes que le formulaire de POST /documents
+func documentRequestFromMetadata(metadata map[string]string) (models.DocumentRequest, error) {
+	var req models.DocumentRequest
+	vehicleID, err := strconv.Atoi(metadata["vehicle_id"])
+	if err != nil {
+		return req, errors.New("vehicle_id requis")
+	}
+	req.VehicleID = vehicleID
+	req.Name = metadata["name"]
+	if req.Name == "" {
+		return req, errors.New("name requis")
+	}
+	req.Type = metadata["type"]
+	if req.Type == "" {
+		return req, errors.New("type requis")
+	}
+	if description := metadata["description"]; description != "" {
+		req.Description = &description
+	}
+
+	for field, date := range map[string]**time.Time{"issued_at": &req.IssuedAt, "expires_at": &req.ExpiresAt} {
+		if metadata[field] == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", metadata[field])
+		if err != nil {
+			return req, fmt.Errorf("%s invalide : format AAAA-MM-JJ attendu", field)
+		}
+		*date = &parsed
+	}
+	return req, nil
+}
+
+// findDocumentUpload lit l'envoi upload_id de l'utilisateur ; s'il n'existe
+// pas ou a expiré, la réponse est envoyée
+func findDocumentUpload(c *gin.Context, userID int) (*documentUpload, bool) {
+	var upload documentUpload
+	var expired bool
+	err := database.DB.QueryRow(`
+		SELECT id, vehicle_id, name, type, description, file_name, issued_at, expires_at,
+		       upload_length, upload_offset, status, document_id, upload_expires_at, created_at,
+		       upload_expires_at < CURRENT_TIMESTAMP
+		FROM document_uploads
+		WHERE id = $1 AND user_id = $2`, c.Param("upload_id"), userID,
+	).Scan(
+		&upload.ID, &upload.VehicleID, &upload.Name, &upload.Type, &upload.Description, &upload.FileName,
+		&upload.IssuedAt, &upload.ExpiresAt, &upload.Length, &upload.Offset, &upload.Status,
+		&upload.DocumentID, &upload.Expires, &upload.CreatedAt, &expired,
+	)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Envoi non trouvé"})
+		return nil, false
+	}
+	if err != nil {
+		fmt.Printf("Erreur lecture envoi: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture envoi"})
+		return nil, false
+	}
+	if expired {
+		c.JSON(http.StatusGone, gin.H{"message": "Envoi expiré", "code": "upload_expired"})
+		return nil, false
+	}
+	return &upload, true
+}
+
+// HeadDocumentUpload retourne la position à laquelle reprendre un envoi
+func HeadDocumentUpload(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+	if !tusRequest(c) {
+		return
+	}
+
+	upload, ok := findDocumentUpload(c, userID.(int))
+	if !ok {
+		return
+	}
+	// Un fichier refusé à la fin de l'envoi ne peut pas être repris
+	if upload.Status == resumable.StatusFailed {
+		c.Status(http.StatusGone)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchDocumentUpload reçoit la suite d'un envoi à partir de Upload-Offset.
+// À la réception du dernier octet, le document est créé : le véhicule doit
+// toujours appartenir à l'utilisateur et le fichier passe les mêmes
+// vérifications que par POST /documents
+func PatchDocumentUpload(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+	if !tusRequest(c) {
+		return
+	}
+
+	if c.ContentType() != resumable.ContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"message": "Content-Type " + resumable.ContentType + " requis"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Upload-Offset invalide"})
+		return
+	}
+
+	upload, ok := findDocumentUpload(c, userID.(int))
+	if !ok {
+		return
+	}
+	switch upload.Status {
+	case resumable.StatusFailed:
+		c.JSON(http.StatusGone, gin.H{"message": "Fichier refusé, envoi abandonné", "code": "upload_failed"})
+		return
+	case resumable.StatusProcessing:
+		c.JSON(http.StatusConflict, gin.H{"message": "Envoi en cours de traitement", "code": "upload_processing"})
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"message": "Upload-Offset ne correspond pas à la position de l'envoi", "code": "upload_offset_mismatch"})
+		return
+	}
+
+	if upload.Status == resumable.StatusUploading {
+		if upload.Offset < upload.Length && !receiveUploadPart(c, upload) {
+			return
+		}
+		// Une requête vide relance la création du document après une erreur serveur
+		if upload.Offset == upload.Length && !finishDocumentUpload(c, userID.(int), upload) {
+			return
+		}
+	}
+
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// receiveUploadPart enregistre le corps de la requête comme morceau de
+// l'envoi et avance sa position ; en cas d'échec la réponse est envoyée
+func receiveUploadPart(c *gin.Context, upload *documentUpload) bool {
+	// Pas le contexte de la requête : il est annulé à la coupure de
+	// connexion, les octets déjà reçus doivent être enregistrés
+	ctx := context.Background()
+	body := &uploadPartReader{body: c.Request.Body, remaining: upload.Length - upload.Offset}
+	key := storage.NewKey("resumable", "")
+	if err := encryption.Put(ctx, database.DB, key, body, -1, "application/octet-stream"); err != nil {
+		if errors.Is(err, errUploadPartTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Le morceau dépasse Upload-Length", "code": "upload_length_exceeded"})
+			return false
+		}
+		fmt.Printf("Erreur sauvegarde morceau d'envoi: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde fichier"})
+		return false
+	}
+
+	saved := false
+	defer func() {
+		if !saved {
+			if err := encryption.Delete(ctx, database.DB, key); err != nil {
+				fmt.Printf("Erreur suppression morceau d'envoi: %v\n", err)
+			}
+		}
+	}()
+	if body.read == 0 {
+		return true
+	}
+
+	conflict, err := addUploadPart(ctx, upload, key, body.read)
+	if err != nil {
+		fmt.Printf("Erreur enregistrement morceau d'envoi: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde en base"})
+		return false
+	}
+	// Une autre requête sur le même envoi est passée entre-temps
+	if conflict {
+		c.JSON(http.StatusConflict, gin.H{"message": "Upload-Offset ne correspond pas à la position de l'envoi", "code": "upload_offset_mismatch"})
+		return false
+	}
+
+	saved = true
+	upload.Offset += body.read
+	return true
+}
+
+// addUploadPart avance la position d'un envoi et enregistre son nouveau
+// morceau dans une transaction. Retourne true si la position a changé depuis
+// la lecture de l'envoi
+func addUploadPart(ctx context.Context, upload *documentUpload, key string, size int64) (bool, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE document_uploads SET upload_offset = upload_offset + $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND upload_offset = $2 AND status = $4 AND upload_expires_at > CURRENT_TIMESTAMP`,
+		upload.ID, upload.Offset, size, resumable.StatusUploading,
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return true, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO document_upload_parts (upload_id, upload_offset, size, storage_key)
+		VALUES ($1, $2, $3, $4)`,
+		upload.ID, upload.Offset, size, key,
+	)
+	if err != nil {
+		return false, err
+	}
+	return false, tx.Commit()
+}
+
+// finishDocumentUpload crée le document d'un envoi complet. Après une erreur
+// serveur l'envoi peut être relancé ; un fichier refusé l'abandonne. En cas
+// d'échec la réponse est envoyée
+func finishDocumentUpload(c *gin.Context, userID int, upload *documentUpload) bool {
+	// Un seul appel crée le document, même si le client renvoie sa dernière requête
+	result, err := database.DB.Exec(`
+		UPDATE document_uploads SET status = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3 AND upload_offset = upload_length`,
+		upload.ID, resumable.StatusProcessing, resumable.StatusUploading,
+	)
+	if err != nil {
+		fmt.Printf("Erreur lecture envoi: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture envoi"})
+		return false
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Envoi en cours de traitement", "code": "upload_processing"})
+		return false
+	}
+
+	documentID, ok := createDocumentFromUpload(c, userID, upload)
+	status := resumable.StatusCompleted
+	if !ok {
+		status = resumable.StatusFailed
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			status = resumable.StatusUploading
+		}
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE document_uploads SET status = $2, document_id = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		upload.ID, status, documentID,
+	)
+	if err != nil {
+		fmt.Printf("Erreur mise à jour envoi: %v\n", err)
+	}
+	// Les morceaux ne servent plus une fois le document créé ou le fichier refusé
+	if status != resumable.StatusUploading {
+		if err := resumable.DeleteParts(context.Background(), database.DB, upload.ID); err != nil {
+			fmt.Printf("Erreur suppression morceaux d'envoi: %v\n", err)
+		}
+	}
+	if !ok {
+		return false
+	}
+
+	upload.Status = status
+	upload.DocumentID = documentID
+	return true
+}
+
+// createDocumentFromUpload assemble les morceaux d'un envoi et crée le
+// document par le même chemin que POST /documents ; en cas d'échec la
+// réponse est envoyée
+func createDocumentFromUpload(c *gin.Context, userID int, upload *documentUpload) (*int, bool) {
+	req := models.DocumentRequest{
+		VehicleID:   upload.VehicleID,
+		Name:        upload.Name,
+		Type:        upload.Type,
+		Description: upload.Description,
+		IssuedAt:    upload.IssuedAt,
+		ExpiresAt:   upload.ExpiresAt,
+	}
+	// Le véhicule a pu être transféré ou supprimé pendant l'envoi
+	allowedTypes, issuedAt, expiresAt, ok := checkDocumentRequest(c, userID, req)
+	if !ok {
+		return nil, false
+	}
+
+	file, err := assembleDocumentUpload(c.Request.Context(), upload)
+	if err != nil {
+		fmt.Printf("Erreur assemblage envoi %s: %v\n", upload.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture fichier"})
+		return nil, false
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	stored, ok := saveDocumentFile(c, file, &multipart.FileHeader{Filename: upload.FileName, Size: upload.Length}, allowedTypes)
+	if !ok {
+		return nil, false
+	}
+	response, ok := createDocumentFromFile(c, userID, req, stored, issuedAt, expiresAt)
+	if !ok {
+		return nil, false
+	}
+	return &response.ID, true
+}
+
+// assembleDocumentUpload recopie dans l'ordre les morceaux d'un envoi dans un
+// fichier temporaire, que saveDocumentFile peut relire depuis le début comme
+// un fichier de formulaire
+func assembleDocumentUpload(ctx context.Context, upload *documentUpload) (*os.File, error) {
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT upload_offset, size, storage_key FROM document_upload_parts
+		WHERE upload_id = $1
+		ORDER BY upload_offset`, upload.ID)
+	if err != nil {
+		return nil, err
+	}
+	type part struct {
+		offset, size int64
+		key          string
+	}
+	var parts []part
+	for rows.Next() {
+		var p part
+		if err := rows.Scan(&p.offset, &p.size, &p.key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "document-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*os.File, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	var written int64
+	for _, p := range parts {
+		if p.offset != written {
+			return fail(fmt.Errorf("morceau manquant à la position %d", written))
+		}
+		reader, _, err := encryption.Get(ctx, database.DB, p.key)
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", p.key, err))
+		}
+		n, err := io.Copy(file, reader)
+		reader.Close()
+		if err != nil {
+			return fail(fmt.Errorf("%s: %w", p.key, err))
+		}
+		if n != p.size {
+			return fail(fmt.Errorf("%s: %d octets au lieu de %d", p.key, n, p.size))
+		}
+		written += n
+	}
+	if written != upload.Length {
+		return fail(fmt.Errorf("%d octets reçus au lieu de %d", written, upload.Length))
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+	return file, nil
+}
+
+// DeleteDocumentUpload abandonne un envoi et supprime les morceaux reçus
+// (extension termination). Le document éventuellement créé est conservé
+func DeleteDocumentUpload(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+	if !tusRequest(c) {
+		return
+	}
+
+	terminated, err := resumable.Terminate(c.Request.Context(), database.DB, c.Param("upload_id"), userID.(int))
+	if err != nil {
+		fmt.Printf("Erreur suppression envoi: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur suppression envoi"})
+		return
+	}
+	if !terminated {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Envoi non trouvé ou en cours de traitement"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetDocumentUpload retourne l'état d'un envoi et, une fois terminé, le
+// document créé. Ce n'est pas une requête tus
+func GetDocumentUpload(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	upload, ok := findDocumentUpload(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	response := models.DocumentUploadResponse{
+		ID:           upload.ID,
+		VehicleID:    upload.VehicleID,
+		Name:         upload.Name,
+		Type:         upload.Type,
+		FileName:     upload.FileName,
+		UploadLength: upload.Length,
+		UploadOffset: upload.Offset,
+		Status:       upload.Status,
+		DocumentID:   upload.DocumentID,
+		ExpiresAt:    upload.Expires,
+		CreatedAt:    upload.CreatedAt,
+	}
+	if upload.DocumentID != nil {
+		downloadURL := fmt.Sprintf("/documents/%d/download", *upload.DocumentID)
+		response.DownloadURL = &downloadURL
+	}
+
+	c.JSON(http.StatusOK, gin.H{"upload": response})
+}
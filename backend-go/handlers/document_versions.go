@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/encryption"
+	"backend-go/media"
+	"backend-go/models"
+	"backend-go/quotas"
+	"backend-go/retention"
+	"backend-go/storage"
+	"backend-go/thumbnails"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AddDocumentVersion remplace le fichier d'un document par une nouvelle
+// version (attestation renouvelée, meilleur scan...). Les versions
+// précédentes restent consultables et téléchargeables
+func AddDocumentVersion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	// Refuser les fichiers trop gros pendant la réception
+	limitUploadBody(c, media.MaxDocumentSize)
+
+	var req models.DocumentVersionRequest
+	if err := c.ShouldBind(&req); err != nil {
+		if uploadError(c, err, "message", nil, media.MaxDocumentSize) {
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	var docType string
+	var vehicleID int
+	var issuedAt, expiresAt *time.Time
+	err = database.DB.QueryRow(`
+		SELECT type, vehicle_id, issued_at, expires_at
+		FROM documents
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, documentID, userID).Scan(&docType, &vehicleID, &issuedAt, &expiresAt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+		return
+	}
+
+	// Sans date fournie, la nouvelle version reprend celles de la précédente
+	if formDate(req.IssuedAt) != nil || formDate(req.ExpiresAt) != nil {
+		issuedAt = formDate(req.IssuedAt)
+		expiresAt, err = models.ValidateDocumentDates(docType, issuedAt, formDate(req.ExpiresAt), time.Now().UTC())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Dates du document invalides", "code": "invalid_document_dates", "error": err.Error()})
+			return
+		}
+	}
+
+	stored, ok := storeDocumentFile(c, models.DocumentAllowedMimeTypes[docType])
+	if !ok {
+		return
+	}
+
+	version, oldThumbnailKey, err := addDocumentVersion(c.Request.Context(), documentID, userID.(int), stored, issuedAt, expiresAt)
+	if err != nil {
+		// Supprimer le fichier si erreur BDD
+		if err := encryption.Delete(c.Request.Context(), database.DB, stored.Key); err != nil {
+			fmt.Printf("Erreur suppression fichier: %v\n", err)
+		}
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+			return
+		}
+		if quotaError(c, err) {
+			return
+		}
+		fmt.Printf("Erreur ajout version document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde en base"})
+		return
+	}
+
+	// L'aperçu de la version précédente est remplacé
+	if oldThumbnailKey != nil {
+		if err := encryption.Delete(c.Request.Context(), database.DB, *oldThumbnailKey); err != nil {
+			fmt.Printf("Erreur suppression aperçu: %v\n", err)
+		}
+	}
+
+	documentFileStored(documentID, vehicleID, userID.(int), docType, issuedAt)
+
+	fileSHA256 := stored.SHA256
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Nouvelle version ajoutée",
+		"version": models.DocumentVersion{
+			Version:     version,
+			Current:     true,
+			FileName:    stored.Name,
+			FileSize:    stored.Size,
+			MimeType:    stored.MimeType,
+			FileSHA256:  &fileSHA256,
+			IssuedAt:    issuedAt,
+			ExpiresAt:   expiresAt,
+			DownloadURL: fmt.Sprintf("/documents/%d/versions/%d/download", documentID, version),
+			CreatedAt:   time.Now(),
+		},
+	})
+}
+
+// addDocumentVersion fait du fichier stocké la version courante du document
+// et retourne son numéro, ainsi que l'aperçu de la version remplacée.
+// Retourne sql.ErrNoRows si le document a été supprimé entre-temps et
+// *quotas.ExceededError si l'espace de stockage est insuffisant
+func addDocumentVersion(ctx context.Context, documentID, userID int, stored *storedDocumentFile, issuedAt, expiresAt *time.Time) (int, *string, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	if err := quotas.LockUser(ctx, tx, userID); err != nil {
+		return 0, nil, err
+	}
+
+	// Le verrou sérialise deux nouvelles versions envoyées en même temps
+	var oldThumbnailKey *string
+	err = tx.QueryRow(`
+		SELECT thumbnail_key FROM documents
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE`, documentID, userID).Scan(&oldThumbnailKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Les versions précédentes restent stockées : la nouvelle s'y ajoute
+	if err := quotas.CheckStorage(ctx, tx, userID, stored.Size); err != nil {
+		return 0, nil, err
+	}
+
+	var version int
+	err = tx.QueryRow(`
+		UPDATE documents
+		SET current_version = current_version + 1, file_path = $2, file_name = $3, file_size = $4, mime_type = $5, file_sha256 = $6,
+		    issued_at = $7, expires_at = $8, thumbnail_key = NULL, thumbnail_status = $9, thumbnail_attempts = 0,
+		    thumbnail_updated_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING current_version`,
+		documentID, stored.Key, stored.Name, stored.Size, stored.MimeType, stored.SHA256,
+		issuedAt, expiresAt, thumbnails.StatusPending,
+	).Scan(&version)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := insertDocumentVersion(tx, documentID, version, userID, stored, issuedAt, expiresAt); err != nil {
+		return 0, nil, err
+	}
+	return version, oldThumbnailKey, tx.Commit()
+}
+
+// GetDocumentVersions liste les versions d'un document, la plus récente en premier
+func GetDocumentVersions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	var currentVersion int
+	err = database.DB.QueryRow(`
+		SELECT current_version FROM documents
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, documentID, userID).Scan(&currentVersion)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT version, file_name, file_size, mime_type, file_sha256, issued_at, expires_at, created_at
+		FROM document_versions
+		WHERE document_id = $1
+		ORDER BY version DESC`, documentID)
+	if err != nil {
+		fmt.Printf("Erreur récupération versions: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération des versions"})
+		return
+	}
+	defer rows.Close()
+
+	versions := []models.DocumentVersion{}
+	for rows.Next() {
+		var v models.DocumentVersion
+		err := rows.Scan(&v.Version, &v.FileName, &v.FileSize, &v.MimeType, &v.FileSHA256, &v.IssuedAt, &v.ExpiresAt, &v.CreatedAt)
+		if err != nil {
+			continue
+		}
+		v.Current = v.Version == currentVersion
+		v.DownloadURL = fmt.Sprintf("/documents/%d/versions/%d/download", documentID, v.Version)
+		versions = append(versions, v)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "current_version": currentVersion})
+}
+
+// DownloadDocumentVersion télécharge une version d'un document, courante ou non
+func DownloadDocumentVersion(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Numéro de version invalide"})
+		return
+	}
+
+	var filePath, fileName, mimeType string
+	err = database.DB.QueryRow(`
+		SELECT v.file_path, v.file_name, v.mime_type
+		FROM document_versions v
+		JOIN documents d ON d.id = v.document_id
+		WHERE v.document_id = $1 AND v.version = $2 AND d.user_id = $3 AND d.deleted_at IS NULL`,
+		documentID, version, userID).Scan(&filePath, &fileName, &mimeType)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Version non trouvée"})
+		return
+	}
+
+	serveStoredFile(c, storage.KeyFromPath(filePath), fileName, mimeType, true)
+}
+
+// GetDeletedDocuments liste les documents supprimés encore restaurables
+func GetDeletedDocuments(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	// Les documents d'un véhicule cédé depuis leur suppression ne sont plus restaurables
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.vehicle_id, v.plate, d.name, d.type, d.file_name, d.file_size, d.current_version,
+		       d.deleted_at, d.deleted_at + $2 * INTERVAL '1 second'
+		FROM documents d
+		JOIN vehicles v ON v.id = d.vehicle_id AND v.user_id = d.user_id
+		WHERE d.user_id = $1 AND d.deleted_at IS NOT NULL
+		ORDER BY d.deleted_at DESC`, userID, int64(retention.DocumentRetention.Seconds()))
+	if err != nil {
+		fmt.Printf("Erreur récupération documents supprimés: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération documents"})
+		return
+	}
+	defer rows.Close()
+
+	documents := []models.DeletedDocumentResponse{}
+	for rows.Next() {
+		var doc models.DeletedDocumentResponse
+		err := rows.Scan(&doc.ID, &doc.VehicleID, &doc.VehiclePlate, &doc.Name, &doc.Type, &doc.FileName, &doc.FileSize,
+			&doc.Version, &doc.DeletedAt, &doc.PurgeAt)
+		if err != nil {
+			continue
+		}
+		documents = append(documents, doc)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"documents": documents, "retention_days": int(retention.DocumentRetention.Hours() / 24)})
+}
+
+// RestoreDocument annule la suppression d'un document tant que ses fichiers
+// n'ont pas été purgés
+func RestoreDocument(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur restauration du document"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Un document restauré compte à nouveau dans la limite de son véhicule ;
+	// le verrou empêche une création ou une restauration simultanée de
+	// dépasser la limite
+	if err := quotas.LockUser(ctx, tx, userID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur restauration du document"})
+		return
+	}
+	var vehicleID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT vehicle_id FROM documents
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		FOR UPDATE`, documentID, userID).Scan(&vehicleID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document supprimé non trouvé"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur récupération document supprimé: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur restauration du document"})
+		return
+	}
+	if !checkQuota(c, quotas.CheckDocuments(ctx, tx, userID.(int), vehicleID)) {
+		return
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE documents SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		AND EXISTS (SELECT 1 FROM vehicles WHERE id = documents.vehicle_id AND user_id = $2)`,
+		documentID, userID,
+	)
+	if err != nil {
+		fmt.Printf("Erreur restauration document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur restauration du document"})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document supprimé non trouvé"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Erreur restauration document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur restauration du document"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document restauré"})
+}
@@ -1,17 +1,30 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"backend-go/database"
+	"backend-go/encryption"
+	"backend-go/entitlements"
+	"backend-go/extractions"
+	"backend-go/media"
 	"backend-go/models"
+	"backend-go/quotas"
+	"backend-go/retention"
+	"backend-go/storage"
+	"backend-go/thumbnails"
 )
 
 func UploadDocument(c *gin.Context) {
@@ -21,86 +34,247 @@ func UploadDocument(c *gin.Context) {
 		return
 	}
 
+	// Refuser les fichiers trop gros pendant la réception
+	limitUploadBody(c, media.MaxDocumentSize)
+
 	var req models.DocumentRequest
 	if err := c.ShouldBind(&req); err != nil {
+		if uploadError(c, err, "message", nil, media.MaxDocumentSize) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
 		return
 	}
 
+	allowedTypes, issuedAt, expiresAt, ok := checkDocumentRequest(c, userID.(int), req)
+	if !ok {
+		return
+	}
+
+	// Quotas de l'abonnement, vérifiés à nouveau à l'enregistrement en base
+	var fileSize int64
+	if header, err := c.FormFile("file"); err == nil {
+		fileSize = header.Size
+	}
+	if !checkQuota(c, quotas.CheckDocument(c.Request.Context(), database.DB, userID.(int), req.VehicleID, fileSize)) {
+		return
+	}
+
+	// Vérifier et enregistrer le fichier dans le stockage
+	stored, ok := storeDocumentFile(c, allowedTypes)
+	if !ok {
+		return
+	}
+
+	response, ok := createDocumentFromFile(c, userID.(int), req, stored, issuedAt, expiresAt)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Document uploadé avec succès", "document": response})
+}
+
+// checkDocumentRequest vérifie le type et les dates d'un nouveau document et
+// que le véhicule appartient à l'utilisateur. Retourne les formats acceptés
+// et les dates à enregistrer ; en cas d'échec la réponse est déjà envoyée
+func checkDocumentRequest(c *gin.Context, userID int, req models.DocumentRequest) ([]string, *time.Time, *time.Time, bool) {
+	allowedTypes, ok := models.DocumentAllowedMimeTypes[req.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Type de document invalide"})
+		return nil, nil, nil, false
+	}
+
+	// Dates de validité, vérifiées selon le type de document
+	issuedAt := formDate(req.IssuedAt)
+	expiresAt, err := models.ValidateDocumentDates(req.Type, issuedAt, formDate(req.ExpiresAt), time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Dates du document invalides", "code": "invalid_document_dates", "error": err.Error()})
+		return nil, nil, nil, false
+	}
+
 	// Vérifier que le véhicule appartient à l'utilisateur
 	var vehicleExists bool
-	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM vehicles WHERE id = $1 AND user_id = $2)", req.VehicleID, userID).Scan(&vehicleExists)
+	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM vehicles WHERE id = $1 AND user_id = $2)", req.VehicleID, userID).Scan(&vehicleExists)
 	if err != nil || !vehicleExists {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Véhicule non trouvé"})
-		return
+		return nil, nil, nil, false
 	}
+	return allowedTypes, issuedAt, expiresAt, true
+}
+
+// createDocumentFromFile enregistre en base un document dont le fichier est
+// déjà stocké et lance les traitements qui suivent ; en cas d'échec le
+// fichier est supprimé et la réponse déjà envoyée
+func createDocumentFromFile(c *gin.Context, userID int, req models.DocumentRequest, stored *storedDocumentFile, issuedAt, expiresAt *time.Time) (*models.DocumentResponse, bool) {
+	// Créer le document et sa première version
+	documentID, err := createDocument(c.Request.Context(), userID, req, stored, issuedAt, expiresAt)
+	if err != nil {
+		// Supprimer le fichier si erreur BDD ou quota dépassé
+		if err := encryption.Delete(c.Request.Context(), database.DB, stored.Key); err != nil {
+			fmt.Printf("Erreur suppression fichier: %v\n", err)
+		}
+		if quotaError(c, err) {
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde en base"})
+		return nil, false
+	}
+
+	documentFileStored(documentID, req.VehicleID, userID, req.Type, issuedAt)
+
+	return &models.DocumentResponse{
+		ID:          documentID,
+		VehicleID:   req.VehicleID,
+		Name:        req.Name,
+		Type:        req.Type,
+		Description: req.Description,
+		FileName:    stored.Name,
+		FileSize:    stored.Size,
+		Version:     1,
+		DownloadURL: fmt.Sprintf("/documents/%d/download", documentID),
+		IssuedAt:    issuedAt,
+		ExpiresAt:   expiresAt,
+		CreatedAt:   time.Now(),
+	}, true
+}
+
+// storedDocumentFile est un fichier de document enregistré dans le stockage
+type storedDocumentFile struct {
+	Key      string
+	Name     string
+	Size     int64
+	MimeType string
+	SHA256   string
+}
 
+// storeDocumentFile vérifie le champ "file" du formulaire et l'enregistre
+// sous une clé aléatoire ; en cas d'échec la réponse est déjà envoyée
+func storeDocumentFile(c *gin.Context, allowedTypes []string) (*storedDocumentFile, bool) {
 	// Récupérer le fichier uploadé
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Fichier requis", "error": err.Error()})
-		return
+		return nil, false
 	}
 	defer file.Close()
 
-	// Créer le dossier uploads s'il n'existe pas
-	uploadsDir := "uploads/documents"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création dossier"})
-		return
+	return saveDocumentFile(c, file, header, allowedTypes)
+}
+
+// saveDocumentFile vérifie le type réel d'un fichier reçu et l'enregistre,
+// chiffré s'il y a lieu ; en cas d'échec la réponse est déjà envoyée
+func saveDocumentFile(c *gin.Context, file multipart.File, header *multipart.FileHeader, allowedTypes []string) (*storedDocumentFile, bool) {
+	// Type réel d'après le contenu, métadonnées EXIF retirées des images
+	upload, err := checkUpload(file, header, allowedTypes, media.MaxDocumentSize)
+	if err != nil {
+		if !uploadError(c, err, "message", allowedTypes, media.MaxDocumentSize) {
+			fmt.Printf("Erreur lecture fichier: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture fichier"})
+		}
+		return nil, false
 	}
 
-	// Générer un nom de fichier unique
-	timestamp := time.Now().Unix()
-	fileName := fmt.Sprintf("%d_%s", timestamp, header.Filename)
-	filePath := filepath.Join(uploadsDir, fileName)
+	// Le fichier est stocké sous une clé aléatoire ; le nom d'origine n'est
+	// conservé qu'en base, pour l'affichage et le téléchargement
+	stored := &storedDocumentFile{
+		Key:      storage.NewKey("documents", ""),
+		Name:     storage.CleanFileName(header.Filename, "document"),
+		Size:     upload.Size,
+		MimeType: upload.MimeType,
+	}
 
-	// Sauvegarder le fichier
-	dst, err := os.Create(filePath)
-	if err != nil {
+	// Sauvegarder le fichier, chiffré au fil de l'eau, en calculant
+	// l'empreinte SHA-256 du contenu d'origine
+	hash := sha256.New()
+	if err := encryption.Put(c.Request.Context(), database.DB, stored.Key, io.TeeReader(upload.Body, hash), stored.Size, stored.MimeType); err != nil {
+		if uploadError(c, err, "message", allowedTypes, media.MaxDocumentSize) {
+			return nil, false
+		}
+		fmt.Printf("Erreur sauvegarde fichier: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde fichier"})
-		return
+		return nil, false
 	}
-	defer dst.Close()
+	stored.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return stored, true
+}
 
-	fileSize, err := io.Copy(dst, file)
+// createDocument enregistre un nouveau document et sa version 1 dans une
+// transaction, après avoir vérifié les quotas de l'abonnement
+// (*quotas.ExceededError)
+func createDocument(ctx context.Context, userID int, req models.DocumentRequest, stored *storedDocumentFile, issuedAt, expiresAt *time.Time) (int, error) {
+	tx, err := database.DB.BeginTx(ctx, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur copie fichier"})
-		return
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := quotas.LockUser(ctx, tx, userID); err != nil {
+		return 0, err
+	}
+	if err := quotas.CheckDocument(ctx, tx, userID, req.VehicleID, stored.Size); err != nil {
+		return 0, err
 	}
 
-	// Créer l'entrée en base de données
 	var documentID int
-	err = database.DB.QueryRow(`
-		INSERT INTO documents (vehicle_id, user_id, name, type, description, file_path, file_name, file_size, mime_type, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) 
+	err = tx.QueryRow(`
+		INSERT INTO documents (vehicle_id, user_id, name, type, description, file_path, file_name, file_size, mime_type, file_sha256, issued_at, expires_at, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) 
 		RETURNING id`,
-		req.VehicleID, userID.(int), req.Name, req.Type, req.Description, 
-		filePath, header.Filename, fileSize, header.Header.Get("Content-Type"), 
-		time.Now(), time.Now(),
+		req.VehicleID, userID, req.Name, req.Type, req.Description,
+		stored.Key, stored.Name, stored.Size, stored.MimeType, stored.SHA256,
+		issuedAt, expiresAt, time.Now(), time.Now(),
 	).Scan(&documentID)
-
 	if err != nil {
-		// Supprimer le fichier si erreur BDD
-		os.Remove(filePath)
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde en base"})
-		return
+		return 0, err
 	}
 
-	// Retourner la réponse
-	response := models.DocumentResponse{
-		ID:          documentID,
-		VehicleID:   req.VehicleID,
-		Name:        req.Name,
-		Type:        req.Type,
-		Description: req.Description,
-		FileName:    header.Filename,
-		FileSize:    fileSize,
-		DownloadURL: fmt.Sprintf("/documents/%d/download", documentID),
-		CreatedAt:   time.Now(),
+	if err := insertDocumentVersion(tx, documentID, 1, userID, stored, issuedAt, expiresAt); err != nil {
+		return 0, err
 	}
+	return documentID, tx.Commit()
+}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Document uploadé avec succès", "document": response})
+// insertDocumentVersion conserve un fichier dans l'historique des versions d'un document
+func insertDocumentVersion(tx *sql.Tx, documentID, version, userID int, stored *storedDocumentFile, issuedAt, expiresAt *time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO document_versions (document_id, version, file_path, file_name, file_size, mime_type, file_sha256, issued_at, expires_at, uploaded_by) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		documentID, version, stored.Key, stored.Name, stored.Size, stored.MimeType, stored.SHA256, issuedAt, expiresAt, userID,
+	)
+	return err
+}
+
+// documentFileStored lance les traitements qui suivent l'enregistrement d'un
+// fichier, nouveau document ou nouvelle version
+func documentFileStored(documentID, vehicleID, userID int, docType string, issuedAt *time.Time) {
+	// L'aperçu est généré en arrière-plan, de même que la lecture des champs
+	// d'une carte grise ou d'une attestation d'assurance si l'abonnement
+	// débloque le scanner de documents
+	thumbnails.Notify()
+	if extractions.Supported(docType) {
+		scanner, err := entitlements.Has(context.Background(), database.DB, userID, entitlements.FeatureDocumentScanner)
+		if err != nil {
+			fmt.Printf("Erreur lecture des droits: %v\n", err)
+		} else if scanner {
+			if err := extractions.Queue(database.DB, documentID, userID); err != nil {
+				fmt.Printf("Erreur mise en attente extraction: %v\n", err)
+			}
+		}
+	}
+
+	// Un nouveau contrôle technique met à jour la date du véhicule, sauf si
+	// celui-ci en a déjà un plus récent
+	if docType == "controle_technique" && issuedAt != nil {
+		_, err := database.DB.Exec(`
+			UPDATE vehicles SET technical_control_date = $1, updated_at = CURRENT_TIMESTAMP 
+			WHERE id = $2 AND user_id = $3 
+			AND (technical_control_date IS NULL OR technical_control_date < $1)`,
+			*issuedAt, vehicleID, userID,
+		)
+		if err != nil {
+			fmt.Printf("Erreur mise à jour date contrôle technique: %v\n", err)
+		}
+	}
 }
 
 func GetVehicleDocuments(c *gin.Context) {
@@ -127,9 +301,9 @@ func GetVehicleDocuments(c *gin.Context) {
 
 	// Récupérer les documents du véhicule
 	rows, err := database.DB.Query(`
-		SELECT id, vehicle_id, name, type, description, file_name, file_size, created_at 
+		SELECT id, vehicle_id, name, type, description, file_name, file_size, current_version, thumbnail_status, issued_at, expires_at, created_at 
 		FROM documents 
-		WHERE vehicle_id = $1 
+		WHERE vehicle_id = $1 AND deleted_at IS NULL 
 		ORDER BY created_at DESC`, vehicleID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération documents"})
@@ -142,18 +316,110 @@ func GetVehicleDocuments(c *gin.Context) {
 	for rows.Next() {
 		var doc models.DocumentResponse
 		var description *string
-		err := rows.Scan(&doc.ID, &doc.VehicleID, &doc.Name, &doc.Type, &description, &doc.FileName, &doc.FileSize, &doc.CreatedAt)
+		var thumbnailStatus string
+		err := rows.Scan(&doc.ID, &doc.VehicleID, &doc.Name, &doc.Type, &description, &doc.FileName, &doc.FileSize, &doc.Version, &thumbnailStatus, &doc.IssuedAt, &doc.ExpiresAt, &doc.CreatedAt)
 		if err != nil {
 			continue
 		}
 		doc.Description = description
-		doc.DownloadURL = fmt.Sprintf("/documents/%d/download", doc.ID)
+		setDocumentURLs(&doc, thumbnailStatus)
 		responses = append(responses, doc)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"documents": responses})
 }
 
+// maxExpiringWithin borne la période demandée à GET /documents/expiring
+const maxExpiringWithin = 366
+
+// GetExpiringDocuments liste, sur tous les véhicules de l'utilisateur, les
+// documents expirés ou qui expirent dans la période within (30d par défaut).
+// Seul le document le plus récent de chaque type est pris en compte : une
+// assurance renouvelée ne remonte plus
+func GetExpiringDocuments(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	withinDays, err := parseWithinDays(c.DefaultQuery("within", "30d"))
+	if err != nil || withinDays < 0 || withinDays > maxExpiringWithin {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Période invalide, exemple : within=30d", "max_days": maxExpiringWithin})
+		return
+	}
+
+	// Les documents de type "autre" ne se remplacent pas entre eux
+	rows, err := database.DB.Query(`
+		SELECT d.id, d.vehicle_id, d.name, d.type, d.description, d.file_name, d.file_size, d.current_version, d.thumbnail_status, 
+		       d.issued_at, d.expires_at, d.created_at, v.plate, d.expires_at - CURRENT_DATE 
+		FROM (
+			SELECT DISTINCT ON (vehicle_id, type, CASE WHEN type = 'autre' THEN id END) * 
+			FROM documents 
+			WHERE user_id = $1 AND expires_at IS NOT NULL AND deleted_at IS NULL 
+			ORDER BY vehicle_id, type, CASE WHEN type = 'autre' THEN id END, expires_at DESC
+		) d 
+		JOIN vehicles v ON v.id = d.vehicle_id AND v.user_id = d.user_id 
+		WHERE d.expires_at <= CURRENT_DATE + $2::int 
+		ORDER BY d.expires_at, d.id`, userID, withinDays)
+	if err != nil {
+		fmt.Printf("Erreur récupération documents expirants: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération documents"})
+		return
+	}
+	defer rows.Close()
+
+	responses := []models.ExpiringDocumentResponse{}
+	for rows.Next() {
+		var doc models.ExpiringDocumentResponse
+		var thumbnailStatus string
+		err := rows.Scan(&doc.ID, &doc.VehicleID, &doc.Name, &doc.Type, &doc.Description, &doc.FileName, &doc.FileSize, &doc.Version, &thumbnailStatus,
+			&doc.IssuedAt, &doc.ExpiresAt, &doc.CreatedAt, &doc.VehiclePlate, &doc.DaysLeft)
+		if err != nil {
+			continue
+		}
+		setDocumentURLs(&doc.DocumentResponse, thumbnailStatus)
+		doc.Expired = doc.DaysLeft < 0
+		responses = append(responses, doc)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"documents": responses, "within_days": withinDays})
+}
+
+// parseWithinDays lit une période en jours : "30d", "30" ou une durée Go
+// comme "720h", arrondie au jour supérieur
+func parseWithinDays(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		return strconv.Atoi(days)
+	}
+	if days, err := strconv.Atoi(value); err == nil {
+		return days, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return int((duration + 24*time.Hour - 1) / (24 * time.Hour)), nil
+}
+
+// formDate retourne nil pour un champ de date absent ou vide
+func formDate(date *time.Time) *time.Time {
+	if date == nil || date.IsZero() {
+		return nil
+	}
+	return date
+}
+
+// setDocumentURLs renseigne les liens de téléchargement et d'aperçu d'un document
+func setDocumentURLs(doc *models.DocumentResponse, thumbnailStatus string) {
+	doc.DownloadURL = fmt.Sprintf("/documents/%d/download", doc.ID)
+	if thumbnailStatus == thumbnails.StatusReady {
+		thumbnailURL := fmt.Sprintf("/documents/%d/thumbnail", doc.ID)
+		doc.ThumbnailURL = &thumbnailURL
+	}
+}
+
 func DownloadDocument(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -173,59 +439,176 @@ func DownloadDocument(c *gin.Context) {
 	err = database.DB.QueryRow(`
 		SELECT file_path, file_name, mime_type 
 		FROM documents 
-		WHERE id = $1 AND user_id = $2`, documentID, userID).Scan(&filePath, &fileName, &mimeType)
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, documentID, userID).Scan(&filePath, &fileName, &mimeType)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
 		return
 	}
 
-	// Vérifier que le fichier existe
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Fichier non trouvé"})
+	serveStoredFile(c, storage.KeyFromPath(filePath), fileName, mimeType, true)
+}
+
+// GetDocumentThumbnail sert l'aperçu JPEG d'un document, généré en
+// arrière-plan après l'upload
+func GetDocumentThumbnail(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentID, err := strconv.Atoi(c.Param("document_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	var thumbnailKey *string
+	var thumbnailStatus string
+	err = database.DB.QueryRow(`
+		SELECT thumbnail_key, thumbnail_status 
+		FROM documents 
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, documentID, userID).Scan(&thumbnailKey, &thumbnailStatus)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+		return
+	}
+
+	if thumbnailStatus != thumbnails.StatusReady || thumbnailKey == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Aperçu non disponible", "thumbnail_status": thumbnailStatus})
 		return
 	}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
-	c.Header("Content-Type", mimeType)
-	c.File(filePath)
+	// L'aperçu d'un document ne change jamais : une nouvelle clé est créée à chaque génération
+	c.Header("Cache-Control", "private, max-age=86400")
+	serveStoredFile(c, *thumbnailKey, "thumbnail.jpg", media.JPEG, false)
 }
 
-func DeleteDocument(c *gin.Context) {
+// GetDocumentDownloadURL retourne une URL de téléchargement temporaire qui
+// ne nécessite pas le jeton d'accès (stockage S3 uniquement)
+func GetDocumentDownloadURL(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
 		return
 	}
 
-	documentIDStr := c.Param("document_id")
-	documentID, err := strconv.Atoi(documentIDStr)
+	documentID, err := strconv.Atoi(c.Param("document_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
 		return
 	}
 
-	// Récupérer le document et vérifier les permissions
-	var filePath string
+	var filePath, fileName, mimeType string
 	err = database.DB.QueryRow(`
-		SELECT file_path 
+		SELECT file_path, file_name, mime_type 
 		FROM documents 
-		WHERE id = $1 AND user_id = $2`, documentID, userID).Scan(&filePath)
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, documentID, userID).Scan(&filePath, &fileName, &mimeType)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
 		return
 	}
 
-	// Supprimer l'entrée en base d'abord
-	_, err = database.DB.Exec("DELETE FROM documents WHERE id = $1 AND user_id = $2", documentID, userID)
+	// Un fichier chiffré n'est lisible qu'à travers le serveur
+	key := storage.KeyFromPath(filePath)
+	encrypted, err := encryption.Encrypted(c.Request.Context(), database.DB, key)
+	if err != nil {
+		fmt.Printf("Erreur lecture clé document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération URL de téléchargement"})
+		return
+	}
+	if encrypted {
+		c.JSON(http.StatusNotImplemented, gin.H{"message": "URL de téléchargement directe non disponible, utilisez /documents/:document_id/download"})
+		return
+	}
+
+	url, err := storage.Default.PresignGet(key, storage.PresignTTL, fileName, mimeType)
+	if errors.Is(err, storage.ErrPresignNotSupported) {
+		c.JSON(http.StatusNotImplemented, gin.H{"message": "URL de téléchargement directe non disponible, utilisez /documents/:document_id/download"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur signature URL document: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération URL de téléchargement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":        url,
+		"expires_in": int(storage.PresignTTL.Seconds()),
+	})
+}
+
+// DeleteDocument supprime un document : il disparaît des listes mais reste
+// restaurable pendant la durée de rétention, après laquelle ses fichiers
+// (toutes versions) sont purgés
+func DeleteDocument(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Utilisateur non authentifié"})
+		return
+	}
+
+	documentIDStr := c.Param("document_id")
+	documentID, err := strconv.Atoi(documentIDStr)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID document invalide"})
+		return
+	}
+
+	var purgeAt time.Time
+	err = database.DB.QueryRow(`
+		UPDATE documents SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP 
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL 
+		RETURNING deleted_at + $3 * INTERVAL '1 second'`,
+		documentID, userID, int64(retention.DocumentRetention.Seconds()),
+	).Scan(&purgeAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document non trouvé"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur suppression document: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur suppression en base"})
 		return
 	}
 
-	// Supprimer le fichier physique
-	if err := os.Remove(filePath); err != nil {
-		fmt.Printf("Erreur suppression fichier: %v\n", err)
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Document supprimé avec succès",
+		"purge_at":    purgeAt,
+		"restore_url": fmt.Sprintf("/documents/%d/restore", documentID),
+	})
+}
+
+// serveStoredFile envoie un fichier du stockage, déchiffré s'il y a lieu, en
+// pièce jointe si attachment est vrai ; les fichiers locaux passent par
+// http.ServeContent pour gérer Range et If-Modified-Since
+func serveStoredFile(c *gin.Context, key, fileName, contentType string, attachment bool) {
+	reader, object, err := encryption.Get(c.Request.Context(), database.DB, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Fichier non trouvé"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur lecture fichier %s: %v\n", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture fichier"})
+		return
 	}
+	defer reader.Close()
 
-	c.JSON(http.StatusOK, gin.H{"message": "Document supprimé avec succès"})
-}
\ No newline at end of file
+	if attachment {
+		c.Header("Content-Disposition", storage.ContentDisposition("attachment", fileName))
+	}
+	if contentType == "" {
+		contentType = object.ContentType
+	}
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, fileName, object.ModTime, seeker)
+		return
+	}
+	c.DataFromReader(http.StatusOK, object.Size, contentType, reader, nil)
+}
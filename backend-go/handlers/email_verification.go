@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/keys"
+	"backend-go/mailer"
+	"backend-go/models"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	emailVerificationTTL     = 24 * time.Hour
+	emailVerificationPurpose = "email_verification"
+)
+
+// sendVerificationEmail enregistre un jeton de vérification pour l'adresse
+// donnée et envoie le lien de confirmation à cette adresse
+func sendVerificationEmail(c *gin.Context, userID int, email, name, lang string) error {
+	jtiBytes := make([]byte, 16)
+	if _, err := rand.Read(jtiBytes); err != nil {
+		return err
+	}
+	jti := hex.EncodeToString(jtiBytes)
+	expiresAt := time.Now().Add(emailVerificationTTL)
+
+	// Le jeton est signé : l'adresse à confirmer ne peut pas être modifiée par le client
+	token, err := keys.Default.Sign(jwt.MapClaims{
+		"purpose": emailVerificationPurpose,
+		"user_id": userID,
+		"email":   email,
+		"jti":     jti,
+		"exp":     expiresAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Exec(
+		"INSERT INTO email_verification_tokens (user_id, email, token_id, expires_at) VALUES ($1, $2, $3, $4)",
+		userID, email, jti, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if lang == "" {
+		lang = c.GetHeader("Accept-Language")
+	}
+
+	msg, err := mailer.Render("email_verification", lang, email, gin.H{
+		"Name":           name,
+		"Email":          email,
+		"Link":           emailVerificationLink(token),
+		"ExpiresInHours": int(emailVerificationTTL.Hours()),
+	})
+	if err != nil {
+		return err
+	}
+	mailer.SendAsync(msg)
+
+	return nil
+}
+
+// emailVerificationLink construit le lien ouvert depuis l'email de vérification
+func emailVerificationLink(token string) string {
+	baseURL := os.Getenv("EMAIL_VERIFICATION_URL")
+	if baseURL == "" {
+		baseURL = "https://saveyourcar.fr/verify-email"
+	}
+	return baseURL + "?token=" + url.QueryEscape(token)
+}
+
+// VerifyEmail confirme une adresse email à partir du jeton reçu par email.
+// S'il s'agit d'un changement d'adresse, la nouvelle adresse devient l'identifiant de connexion
+func VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	token, err := keys.Default.Parse(req.Token)
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Token invalide ou expiré"})
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != emailVerificationPurpose {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Token invalide"})
+		return
+	}
+	jti, _ := claims["jti"].(string)
+
+	// Vérifier le jeton en base
+	var userID int
+	var email string
+	var used bool
+	err = database.DB.QueryRow(
+		"SELECT user_id, email, used FROM email_verification_tokens WHERE token_id = $1",
+		jti,
+	).Scan(&userID, &email, &used)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Token invalide"})
+		return
+	}
+
+	if used {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Token déjà utilisé"})
+		return
+	}
+
+	var currentEmail string
+	var pendingEmail sql.NullString
+	err = database.DB.QueryRow("SELECT email, pending_email FROM users WHERE id = $1", userID).Scan(&currentEmail, &pendingEmail)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Token invalide"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	switch {
+	case pendingEmail.Valid && pendingEmail.String == email:
+		// Changement d'adresse : l'adresse ne doit pas avoir été prise entre-temps
+		var taken bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1 AND id != $2)", email, userID).Scan(&taken)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"message": "Cet email est déjà utilisé par un autre utilisateur"})
+			return
+		}
+
+		_, err = tx.Exec(
+			"UPDATE users SET email = pending_email, pending_email = NULL, email_verified = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+			userID,
+		)
+	case currentEmail == email:
+		_, err = tx.Exec("UPDATE users SET email_verified = TRUE, updated_at = CURRENT_TIMESTAMP WHERE id = $1", userID)
+	default:
+		// L'adresse a changé depuis l'envoi du lien
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Ce lien ne correspond plus à votre adresse email"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour utilisateur"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE email_verification_tokens SET used = TRUE WHERE token_id = $1", jti); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur validation transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Adresse email confirmée", "email": email})
+}
+
+// ResendVerificationEmail renvoie le lien de confirmation de l'adresse en attente,
+// ou de l'adresse courante si elle n'est pas encore vérifiée
+func ResendVerificationEmail(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+
+	var email, fullName string
+	var pendingEmail sql.NullString
+	var verified bool
+	err := database.DB.QueryRow(
+		"SELECT email, full_name, pending_email, email_verified FROM users WHERE id = $1",
+		userID,
+	).Scan(&email, &fullName, &pendingEmail, &verified)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération utilisateur"})
+		return
+	}
+
+	target := email
+	if pendingEmail.Valid {
+		target = pendingEmail.String
+	} else if verified {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Adresse email déjà vérifiée"})
+		return
+	}
+
+	if err := sendVerificationEmail(c, userID.(int), target, fullName, ""); err != nil {
+		fmt.Printf("Erreur envoi email de vérification: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur envoi email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email de vérification envoyé"})
+}
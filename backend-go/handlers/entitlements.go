@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/entitlements"
+	"backend-go/models"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEntitlements retourne les fonctionnalités débloquées par l'abonnement de
+// l'utilisateur, pour que l'application affiche son paywall
+func GetEntitlements(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+
+	unlocked, err := entitlements.For(c.Request.Context(), database.DB, userID.(int))
+	if err != nil {
+		fmt.Printf("Erreur lecture des droits: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture des droits"})
+		return
+	}
+
+	features := map[string]bool{}
+	for _, feature := range entitlements.Features {
+		features[feature] = unlocked[feature]
+	}
+	c.JSON(http.StatusOK, models.EntitlementsResponse{Features: features})
+}
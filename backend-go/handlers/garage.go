@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// Statuts à partir desquels chaque action du garage est possible
+var (
+	garageValidateFrom = []string{models.AppointmentStatusPending}
+	garageRejectFrom   = []string{models.AppointmentStatusPending, models.AppointmentStatusValidated, models.AppointmentStatusProposed}
+	garageConfirmFrom  = []string{models.AppointmentStatusPending, models.AppointmentStatusValidated}
+	garageProposeFrom  = []string{models.AppointmentStatusPending, models.AppointmentStatusValidated}
+	garageCompleteFrom = []string{models.AppointmentStatusConfirmed}
+)
+
+// staffGarageID retourne le garage de l'appelant, 0 pour un administrateur qui
+// agit sur tous les garages. Écrit la réponse d'erreur et retourne false si le
+// compte garage n'est rattaché à aucun garage
+func staffGarageID(c *gin.Context) (int, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return 0, false
+	}
+
+	if c.GetString("role") == models.RoleAdmin {
+		return 0, true
+	}
+
+	var garageID sql.NullInt64
+	err := database.DB.QueryRow("SELECT garage_id FROM users WHERE id = $1", userID).Scan(&garageID)
+	if err != nil || !garageID.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Compte non rattaché à un garage"})
+		return 0, false
+	}
+	return int(garageID.Int64), true
+}
+
+// updateAppointmentStatus fait passer un rendez-vous du garage à un nouveau
+// statut si son statut actuel fait partie de from
+func updateAppointmentStatus(c *gin.Context, garageID int, from []string, to string, note string) {
+	appointmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de rendez-vous invalide"})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE appointments a
+		SET status = $1, garage_note = COALESCE(NULLIF($2, ''), a.garage_note),
+		    proposed_date = NULL, proposed_time = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE a.id = $3 AND a.status = ANY($4)
+		  AND ($5 = 0 OR a.garage_id = (SELECT external_id FROM garages WHERE id = $5))`,
+		to, note, appointmentID, pq.Array(from), garageID,
+	)
+	if err != nil {
+		fmt.Printf("Erreur mise à jour statut rendez-vous: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour rendez-vous"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Rendez-vous non trouvé ou déjà traité"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rendez-vous " + strings.ToLower(models.GetStatusDisplayName(to)) + " avec succès",
+		"status":  to,
+	})
+}
+
+// GetMyGarage retourne le garage auquel est rattaché le compte
+func GetMyGarage(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+	if garageID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Compte non rattaché à un garage"})
+		return
+	}
+
+	var garage models.Garage
+	err := database.DB.QueryRow(`
+		SELECT id, name, external_id, address, city, postal_code, phone, email, created_at, updated_at
+		FROM garages WHERE id = $1`, garageID,
+	).Scan(&garage.ID, &garage.Name, &garage.ExternalID, &garage.Address, &garage.City,
+		&garage.PostalCode, &garage.Phone, &garage.Email, &garage.CreatedAt, &garage.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Garage non trouvé"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"garage": garage})
+}
+
+// GetGarageAppointments liste les rendez-vous reçus par le garage, filtrables
+// par statut (?status=pending)
+func GetGarageAppointments(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && !models.IsValidStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Statut invalide"})
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.vehicle_id, a.garage_name, a.garage_id, a.date, a.time,
+		       a.service, a.description, a.status, a.created_at,
+		       a.proposed_date, a.proposed_time, a.garage_note,
+		       v.plate, v.model, v.brand, v.year, v.mileage,
+		       u.full_name, u.email, u.phone
+		FROM appointments a
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN vehicles v ON a.vehicle_id = v.id
+		WHERE ($1 = 0 OR a.garage_id = (SELECT external_id FROM garages WHERE id = $1))
+		  AND ($2 = '' OR a.status = $2)
+		ORDER BY a.date ASC, a.time ASC`,
+		garageID, status,
+	)
+	if err != nil {
+		fmt.Printf("Erreur récupération rendez-vous garage: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur récupération rendez-vous"})
+		return
+	}
+	defer rows.Close()
+
+	appointments := []models.GarageAppointmentResponse{}
+	for rows.Next() {
+		var appointment models.GarageAppointmentResponse
+		var vehiclePlate, vehicleModel, vehicleBrand sql.NullString
+		var vehicleYear, vehicleMileage sql.NullInt64
+
+		err := rows.Scan(
+			&appointment.ID, &appointment.VehicleID, &appointment.GarageName, &appointment.GarageID,
+			&appointment.Date, &appointment.Time, &appointment.Service, &appointment.Description,
+			&appointment.Status, &appointment.CreatedAt,
+			&appointment.ProposedDate, &appointment.ProposedTime, &appointment.GarageNote,
+			&vehiclePlate, &vehicleModel, &vehicleBrand, &vehicleYear, &vehicleMileage,
+			&appointment.Customer.FullName, &appointment.Customer.Email, &appointment.Customer.Phone,
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture rendez-vous"})
+			return
+		}
+
+		// Le garage voit le véhicule concerné, sans ses documents
+		if appointment.VehicleID != nil {
+			vehicle := models.VehicleResponse{
+				ID:    *appointment.VehicleID,
+				Plate: vehiclePlate.String,
+				Model: vehicleModel.String,
+				Brand: vehicleBrand.String,
+			}
+			if vehicleYear.Valid {
+				year := int(vehicleYear.Int64)
+				vehicle.Year = &year
+			}
+			if vehicleMileage.Valid {
+				mileage := int(vehicleMileage.Int64)
+				vehicle.Mileage = &mileage
+			}
+			appointment.Vehicle = &vehicle
+		}
+
+		appointments = append(appointments, appointment)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointments": appointments,
+	})
+}
+
+// ValidateGarageAppointment accepte une demande de rendez-vous
+func ValidateGarageAppointment(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+	updateAppointmentStatus(c, garageID, garageValidateFrom, models.AppointmentStatusValidated, "")
+}
+
+// RejectGarageAppointment refuse un rendez-vous, avec une raison facultative
+func RejectGarageAppointment(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+
+	var req models.GarageDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+			return
+		}
+	}
+
+	updateAppointmentStatus(c, garageID, garageRejectFrom, models.AppointmentStatusRejected, req.Reason)
+}
+
+// ConfirmGarageAppointment fixe définitivement le rendez-vous
+func ConfirmGarageAppointment(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+	updateAppointmentStatus(c, garageID, garageConfirmFrom, models.AppointmentStatusConfirmed, "")
+}
+
+// CompleteGarageAppointment marque l'intervention comme terminée
+func CompleteGarageAppointment(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+	updateAppointmentStatus(c, garageID, garageCompleteFrom, models.AppointmentStatusCompleted, "")
+}
+
+// ProposeAppointmentSlot propose un autre créneau au client, qui l'accepte ou
+// le refuse via PUT /appointments/:id/proposal
+func ProposeAppointmentSlot(c *gin.Context) {
+	garageID, ok := staffGarageID(c)
+	if !ok {
+		return
+	}
+
+	appointmentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID de rendez-vous invalide"})
+		return
+	}
+
+	var req models.ProposeSlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	proposedDate, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Format de date invalide (YYYY-MM-DD requis)"})
+		return
+	}
+	if proposedDate.Before(time.Now().Truncate(24 * time.Hour)) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "La date proposée doit être dans le futur"})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE appointments a
+		SET status = $1, proposed_date = $2, proposed_time = $3,
+		    garage_note = COALESCE(NULLIF($4, ''), a.garage_note), updated_at = CURRENT_TIMESTAMP
+		WHERE a.id = $5 AND a.status = ANY($6)
+		  AND ($7 = 0 OR a.garage_id = (SELECT external_id FROM garages WHERE id = $7))`,
+		models.AppointmentStatusProposed, proposedDate, req.Time, req.Note,
+		appointmentID, pq.Array(garageProposeFrom), garageID,
+	)
+	if err != nil {
+		fmt.Printf("Erreur proposition de créneau: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur proposition de créneau"})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Rendez-vous non trouvé ou déjà traité"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Nouveau créneau proposé au client",
+		"status":  models.AppointmentStatusProposed,
+	})
+}
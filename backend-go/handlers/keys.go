@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"backend-go/keys"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publie les clés publiques permettant de vérifier nos jetons
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, keys.Default.JWKS())
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"backend-go/oidc"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// OIDCNonce émet le nonce que l'application transmet au fournisseur avec sa
+// demande d'ID token, puis à OIDCLogin
+func OIDCNonce(c *gin.Context) {
+	nonce, err := oidc.IssueNonce(c.Request.Context())
+	if err != nil {
+		fmt.Printf("Erreur émission nonce OIDC: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"nonce":      nonce,
+		"expires_in": int64(oidc.NonceTTL.Seconds()),
+	})
+}
+
+// OIDCLogin connecte un utilisateur avec un ID token Apple ou Google. Le compte
+// est retrouvé par l'identité déjà liée, sinon par email vérifié, sinon créé
+func OIDCLogin(c *gin.Context) {
+	var req models.OIDCLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	verifier, err := oidc.Get(req.Provider)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Fournisseur non supporté"})
+		return
+	}
+
+	identity, err := verifier.Verify(c.Request.Context(), req.IDToken, req.Nonce)
+	if err != nil {
+		fmt.Printf("Erreur vérification ID token %s: %v\n", req.Provider, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "ID token invalide"})
+		return
+	}
+
+	var user models.User
+	err = database.DB.QueryRow(`
+		SELECT u.id, u.email, u.full_name, u.email_verified, u.totp_enabled, u.role
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.subject = $2`,
+		identity.Provider, identity.Subject,
+	).Scan(&user.ID, &user.Email, &user.FullName, &user.EmailVerified, &user.TOTPEnabled, &user.Role)
+
+	created := false
+	if err == sql.ErrNoRows {
+		if identity.Email == "" || !identity.EmailVerified {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Le fournisseur n'a pas fourni d'email vérifié"})
+			return
+		}
+
+		user, created, err = linkOrCreateOIDCUser(identity, req.FullName)
+		if errors.Is(err, errUnverifiedLocalAccount) {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "Un compte non vérifié existe déjà avec cet email. Connectez-vous avec votre mot de passe et confirmez votre adresse.",
+				"code":    "account_exists_unverified",
+			})
+			return
+		}
+	}
+	if err != nil {
+		fmt.Printf("Erreur connexion OIDC: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return
+	}
+
+	// Double authentification : même flux que la connexion par mot de passe
+	if user.TOTPEnabled {
+		challenge, err := issueTwoFactorChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(twoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	tokens, err := issueSession(c, user.ID, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	c.JSON(status, gin.H{
+		"user": models.UserResponse{
+			ID:            user.ID,
+			Email:         user.Email,
+			FullName:      user.FullName,
+			EmailVerified: user.EmailVerified,
+			Role:          user.Role,
+		},
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+var errUnverifiedLocalAccount = errors.New("compte local non vérifié")
+
+// linkOrCreateOIDCUser lie l'identité au compte portant le même email s'il est
+// vérifié, ou crée un nouveau compte. Un compte local non vérifié n'est jamais
+// lié : il a pu être créé par un tiers avant le vrai propriétaire de l'adresse
+func linkOrCreateOIDCUser(identity *oidc.Identity, fullName string) (models.User, bool, error) {
+	var user models.User
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return user, false, err
+	}
+	defer tx.Rollback()
+
+	created := false
+	err = tx.QueryRow(
+		"SELECT id, email, full_name, email_verified, totp_enabled, role FROM users WHERE email = $1",
+		identity.Email,
+	).Scan(&user.ID, &user.Email, &user.FullName, &user.EmailVerified, &user.TOTPEnabled, &user.Role)
+
+	switch {
+	case err == sql.ErrNoRows:
+		if fullName == "" {
+			fullName = identity.Name
+		}
+		if fullName == "" {
+			fullName = "Utilisateur"
+		}
+
+		// Mot de passe aléatoire : le compte n'est utilisable qu'avec le fournisseur
+		// tant que l'utilisateur n'a pas réinitialisé son mot de passe
+		randomPassword := make([]byte, 32)
+		if _, err := rand.Read(randomPassword); err != nil {
+			return user, false, err
+		}
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomPassword)), bcrypt.DefaultCost)
+		if err != nil {
+			return user, false, err
+		}
+
+		err = tx.QueryRow(
+			"INSERT INTO users (email, password, full_name, email_verified) VALUES ($1, $2, $3, TRUE) RETURNING id",
+			identity.Email, string(hashedPassword), fullName,
+		).Scan(&user.ID)
+		if err != nil {
+			return user, false, err
+		}
+		user.Email = identity.Email
+		user.FullName = fullName
+		user.EmailVerified = true
+		user.Role = models.RoleUser
+		created = true
+	case err != nil:
+		return user, false, err
+	case !user.EmailVerified:
+		return user, false, errUnverifiedLocalAccount
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)",
+		user.ID, identity.Provider, identity.Subject, identity.Email,
+	)
+	if err != nil {
+		return user, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return user, false, err
+	}
+	return user, created, nil
+}
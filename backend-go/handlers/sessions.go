@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/keys"
+	"backend-go/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Durées de vie des jetons
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// generateAccessToken signe un jeton d'accès court rattaché à une session. Le
+// rôle est figé dans le jeton : un changement de rôle révoque les sessions
+func generateAccessToken(userID int, email, role string, sessionID int) (string, error) {
+	return keys.Default.Sign(jwt.MapClaims{
+		"user_id": userID,
+		"email":   email,
+		"role":    role,
+		"sid":     sessionID,
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(accessTokenTTL).Unix(),
+	})
+}
+
+// generateRefreshToken retourne un jeton aléatoire et son empreinte SHA-256,
+// seule l'empreinte est stockée en base
+func generateRefreshToken() (string, string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession crée une session en base et retourne la paire de jetons associée
+func issueSession(c *gin.Context, userID int, email string) (*models.TokenPair, error) {
+	refreshToken, refreshHash, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionID int
+	var role string
+	err = database.DB.QueryRow(`
+		INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, (SELECT role FROM users WHERE id = $1)`,
+		userID, refreshHash, c.Request.UserAgent(), c.ClientIP(), time.Now().Add(refreshTokenTTL),
+	).Scan(&sessionID, &role)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := generateAccessToken(userID, email, role, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeAllSessions révoque toutes les sessions actives d'un utilisateur
+func revokeAllSessions(userID interface{}) error {
+	_, err := database.DB.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL",
+		userID,
+	)
+	return err
+}
+
+// RefreshToken échange un jeton de rafraîchissement contre une nouvelle paire de jetons
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Jeton de rafraîchissement requis"})
+		return
+	}
+
+	presentedHash := hashToken(req.RefreshToken)
+
+	var session models.Session
+	var email, role string
+	err := database.DB.QueryRow(`
+		SELECT s.id, s.user_id, s.expires_at, s.revoked_at, u.email, u.role
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.refresh_token_hash = $1`,
+		presentedHash,
+	).Scan(&session.ID, &session.UserID, &session.ExpiresAt, &session.RevokedAt, &email, &role)
+
+	if err == sql.ErrNoRows {
+		// Un jeton déjà utilisé est présenté à nouveau : il a probablement été volé,
+		// on révoque la session concernée par précaution
+		result, err := database.DB.Exec(
+			"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE previous_token_hash = $1 AND revoked_at IS NULL",
+			presentedHash,
+		)
+		if err == nil {
+			if rows, _ := result.RowsAffected(); rows > 0 {
+				log.Printf("Réutilisation d'un jeton de rafraîchissement détectée, session révoquée")
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Jeton de rafraîchissement invalide"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Session expirée, veuillez vous reconnecter"})
+		return
+	}
+
+	// Rotation du jeton de rafraîchissement
+	newRefreshToken, newRefreshHash, err := generateRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		UPDATE sessions
+		SET refresh_token_hash = $1, previous_token_hash = $2, expires_at = $3, last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND refresh_token_hash = $2 AND revoked_at IS NULL`,
+		newRefreshHash, presentedHash, time.Now().Add(refreshTokenTTL), session.ID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour session"})
+		return
+	}
+
+	// Une autre requête a déjà consommé ce jeton
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Jeton de rafraîchissement invalide"})
+		return
+	}
+
+	accessToken, err := generateAccessToken(session.UserID, email, role, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	})
+}
+
+// Logout révoque la session courante
+func Logout(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+	sessionID, _ := c.Get("session_id")
+
+	_, err := database.DB.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		sessionID, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lors de la déconnexion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Déconnexion réussie"})
+}
+
+// LogoutAll révoque toutes les sessions de l'utilisateur sur tous ses appareils
+func LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+
+	if err := revokeAllSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lors de la déconnexion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Déconnexion de tous les appareils réussie"})
+}
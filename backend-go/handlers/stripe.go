@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"backend-go/database"
+	"backend-go/entitlements"
 	"backend-go/models"
 	"database/sql"
 	"encoding/json"
@@ -131,6 +132,7 @@ func CreateSubscription(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur sauvegarde abonnement", "error": err.Error()})
 		return
 	}
+	entitlements.Invalidate(userID.(int))
 
 	// Retourner le client secret approprié
 	var clientSecret string
@@ -257,6 +259,7 @@ func CancelSubscription(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour base de données"})
 		return
 	}
+	entitlements.Invalidate(userID.(int))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":              "Abonnement programmé pour annulation",
@@ -345,22 +348,43 @@ func HandleStripeWebhook(c *gin.Context) {
 
 	// Gérer les différents types d'événements
 	switch event.Type {
-	case "customer.subscription.updated":
+	case "customer.subscription.updated", "customer.subscription.deleted":
 		var subscription stripe.Subscription
 		err := json.Unmarshal(event.Data.Raw, &subscription)
 		if err != nil {
-			log.Printf("Erreur unmarshalling subscription.updated: %v\n", err)
+			log.Printf("Erreur unmarshalling %s: %v\n", event.Type, err)
 			c.JSON(http.StatusBadRequest, gin.H{"message": "Erreur parsing événement"})
 			return
 		}
-		log.Printf("Subscription %s updated to status %s\n", subscription.ID, subscription.Status)
-		// Mettre à jour le statut dans la base de données locale
-		_, err = database.DB.Exec("UPDATE subscriptions SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE stripe_subscription_id = $2",
-			string(subscription.Status), subscription.ID)
-		if err != nil {
+		status := string(subscription.Status)
+		if event.Type == "customer.subscription.deleted" {
+			status = models.SubscriptionStatusCanceled
+		}
+		log.Printf("Subscription %s updated to status %s\n", subscription.ID, status)
+		// Un changement de formule remplace le prix ; un événement sans
+		// prix conserve celui enregistré
+		var priceID string
+		if subscription.Items != nil && len(subscription.Items.Data) > 0 && subscription.Items.Data[0].Price != nil {
+			priceID = subscription.Items.Data[0].Price.ID
+		}
+		// Mettre à jour le statut dans la base de données locale, puis oublier
+		// les droits en cache de l'utilisateur
+		var subscriberID int
+		err = database.DB.QueryRow(`
+			UPDATE subscriptions
+			SET status = $1, stripe_price_id = COALESCE(NULLIF($2, ''), stripe_price_id), updated_at = CURRENT_TIMESTAMP
+			WHERE stripe_subscription_id = $3
+			RETURNING user_id`,
+			status, priceID, subscription.ID,
+		).Scan(&subscriberID)
+		if err == sql.ErrNoRows {
+			log.Printf("Abonnement %s inconnu en base\n", subscription.ID)
+		} else if err != nil {
 			log.Printf("Erreur mise à jour statut abonnement en base: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur mise à jour base de données"})
 			return
+		} else {
+			entitlements.Invalidate(subscriberID)
 		}
 	case "invoice.payment_succeeded":
 		var invoice stripe.Invoice
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"backend-go/security"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondTooManyAttempts renvoie une erreur 429 avec l'en-tête Retry-After
+func respondTooManyAttempts(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"message":     "Trop de tentatives, veuillez réessayer plus tard",
+		"retry_after": seconds,
+	})
+}
+
+// loginAttempt est une tentative de connexion réservée auprès des limiteurs
+// du compte et de l'adresse IP
+type loginAttempt struct {
+	email, ip               string
+	accountLocked, ipLocked bool
+}
+
+// reserveLoginAttempt réserve la tentative avant la vérification du mot de
+// passe ; retourne l'attente imposée si le compte ou l'adresse IP est bloqué
+func reserveLoginAttempt(email, ip string) (*loginAttempt, time.Duration, error) {
+	attempt := &loginAttempt{email: email, ip: ip}
+
+	// L'adresse IP d'abord : une tentative refusée pour l'IP ne compte pas
+	// contre le compte visé
+	wait, locked, err := security.LoginByIP.Attempt(ip)
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+	attempt.ipLocked = locked
+
+	wait, locked, err = security.LoginByAccount.Attempt(accountThrottleKey(email))
+	if err != nil || wait > 0 {
+		return nil, wait, err
+	}
+	attempt.accountLocked = locked
+	return attempt, 0, nil
+}
+
+// failed journalise l'échec de la tentative, déjà comptée, et les verrouillages
+func (a *loginAttempt) failed(userID *int) {
+	security.LogEvent(security.EventLoginFailed, userID, a.ip, map[string]interface{}{"email": a.email})
+	if a.accountLocked {
+		security.LogEvent(security.EventAccountLocked, userID, a.ip, map[string]interface{}{"email": a.email})
+	}
+	if a.ipLocked {
+		security.LogEvent(security.EventIPLocked, nil, a.ip, nil)
+	}
+}
+
+// succeeded efface les échecs du compte et annule la tentative comptée pour
+// l'adresse IP
+func (a *loginAttempt) succeeded() {
+	if err := security.LoginByAccount.Reset(accountThrottleKey(a.email)); err != nil {
+		fmt.Printf("Erreur remise à zéro des échecs: %v\n", err)
+	}
+	if err := security.LoginByIP.Release(a.ip); err != nil {
+		fmt.Printf("Erreur remise à zéro des échecs: %v\n", err)
+	}
+}
+
+func accountThrottleKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
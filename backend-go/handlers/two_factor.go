@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/keys"
+	"backend-go/models"
+	"backend-go/security"
+	"backend-go/totp"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer             = "Save Your Car"
+	recoveryCodeCount      = 10
+	twoFactorChallengeTTL  = 5 * time.Minute
+	twoFactorChallengeType = "2fa_challenge"
+	// Codes essayés au plus avec un même challenge avant de devoir se reconnecter
+	twoFactorChallengeAttempts = 5
+)
+
+// EnrollTwoFactor génère un secret TOTP en attente de confirmation et
+// retourne l'URI otpauth:// à afficher en QR code
+func EnrollTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur non authentifié"})
+		return
+	}
+
+	var email string
+	var enabled bool
+	err := database.DB.QueryRow("SELECT email, totp_enabled FROM users WHERE id = $1", userID).Scan(&email, &enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de l'utilisateur"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "La double authentification est déjà activée"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la génération du secret"})
+		return
+	}
+
+	keyID, sealed, err := totp.SealSecret(userID.(int), secret)
+	if err != nil {
+		fmt.Printf("Erreur chiffrement secret TOTP: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement du secret"})
+		return
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET totp_pending_secret = $1, totp_pending_secret_key_id = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+		sealed, keyID, userID,
+	)
+	if err != nil {
+		fmt.Printf("Erreur enregistrement secret TOTP: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement du secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Scannez le QR code puis confirmez avec un premier code",
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, email, secret),
+	})
+}
+
+// ConfirmTwoFactor active la double authentification une fois un premier code
+// valide saisi et retourne les codes de secours, affichés une seule fois
+func ConfirmTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur non authentifié"})
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var pendingSecret sql.NullString
+	var pendingKeyID *string
+	err := database.DB.QueryRow(
+		"SELECT totp_pending_secret, totp_pending_secret_key_id FROM users WHERE id = $1",
+		userID,
+	).Scan(&pendingSecret, &pendingKeyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de l'utilisateur"})
+		return
+	}
+	if !pendingSecret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Aucun enrôlement en cours"})
+		return
+	}
+	secret, err := totp.OpenSecret(userID.(int), pendingKeyID, pendingSecret.String)
+	if err != nil {
+		fmt.Printf("Erreur déchiffrement secret TOTP: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de l'utilisateur"})
+		return
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now(), 0)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code invalide"})
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la génération des codes de secours"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création de la transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET totp_secret = totp_pending_secret, totp_secret_key_id = totp_pending_secret_key_id,
+		    totp_pending_secret = NULL, totp_pending_secret_key_id = NULL, totp_enabled = TRUE,
+		    totp_last_step = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`,
+		step, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'activation"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'activation"})
+		return
+	}
+
+	// Seule l'empreinte des codes de secours est conservée
+	for _, code := range codes {
+		if _, err := tx.Exec("INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hashToken(code)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'enregistrement des codes de secours"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la validation de la transaction"})
+		return
+	}
+
+	uid := userID.(int)
+	security.LogEvent(security.EventTwoFactorEnabled, &uid, c.ClientIP(), nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Double authentification activée",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor désactive la double authentification après vérification
+// du mot de passe et d'un code
+func DisableTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Utilisateur non authentifié"})
+		return
+	}
+
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var hashedPassword string
+	err := database.DB.QueryRow("SELECT password FROM users WHERE id = $1", userID).Scan(&hashedPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la récupération de l'utilisateur"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(req.Password)) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mot de passe incorrect"})
+		return
+	}
+
+	if !requireSecondFactor(c, userID.(int), req.Code) {
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		UPDATE users
+		SET totp_enabled = FALSE, totp_secret = NULL, totp_secret_key_id = NULL,
+		    totp_pending_secret = NULL, totp_pending_secret_key_id = NULL, totp_last_step = 0,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la désactivation"})
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		fmt.Printf("Erreur suppression codes de secours: %v\n", err)
+	}
+
+	uid := userID.(int)
+	security.LogEvent(security.EventTwoFactorDisabled, &uid, c.ClientIP(), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Double authentification désactivée"})
+}
+
+// LoginTwoFactor échange un jeton de challenge et un code TOTP (ou un code de
+// secours) contre une session
+func LoginTwoFactor(c *gin.Context) {
+	var req models.LoginTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Données invalides", "error": err.Error()})
+		return
+	}
+
+	token, err := keys.Default.Parse(req.ChallengeToken)
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Challenge expiré, veuillez vous reconnecter"})
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	rawUserID, okUser := claims["user_id"].(float64)
+	jti, okJTI := claims["jti"].(string)
+	if !ok || !okUser || !okJTI || claims["purpose"] != twoFactorChallengeType {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Challenge invalide"})
+		return
+	}
+	userID := int(rawUserID)
+
+	// L'essai est compté sur le challenge avant la vérification du code : un
+	// challenge n'autorise que twoFactorChallengeAttempts codes, même envoyés
+	// simultanément
+	var attempts int
+	err = database.DB.QueryRow(`
+		UPDATE two_factor_challenges SET attempts = attempts + 1
+		WHERE id = $1 AND user_id = $2 AND expires_at > CURRENT_TIMESTAMP AND attempts < $3
+		RETURNING attempts`,
+		jti, userID, twoFactorChallengeAttempts,
+	).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Challenge expiré, veuillez vous reconnecter"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur lecture challenge 2FA: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return
+	}
+
+	var user models.User
+	err = database.DB.QueryRow(
+		"SELECT id, email, full_name, email_verified, role FROM users WHERE id = $1",
+		userID,
+	).Scan(&user.ID, &user.Email, &user.FullName, &user.EmailVerified, &user.Role)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Challenge invalide"})
+		return
+	}
+
+	if !requireSecondFactor(c, user.ID, req.Code) {
+		// Dernier essai épuisé : le challenge ne sert plus
+		if attempts >= twoFactorChallengeAttempts {
+			deleteTwoFactorChallenge(jti)
+		}
+		return
+	}
+	// Le challenge ne sert qu'à une connexion
+	deleteTwoFactorChallenge(jti)
+
+	tokens, err := issueSession(c, user.ID, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur génération token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": models.UserResponse{
+			ID:            user.ID,
+			Email:         user.Email,
+			FullName:      user.FullName,
+			EmailVerified: user.EmailVerified,
+			TOTPEnabled:   true,
+			Role:          user.Role,
+		},
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+	})
+}
+
+// issueTwoFactorChallenge retourne le jeton à présenter avec le code TOTP
+// pour terminer la connexion. Son jti est enregistré dans
+// two_factor_challenges, qui compte les essais
+func issueTwoFactorChallenge(userID int) (string, error) {
+	// Les challenges expirés sont purgés au fil des émissions
+	if _, err := database.DB.Exec("DELETE FROM two_factor_challenges WHERE expires_at < CURRENT_TIMESTAMP"); err != nil {
+		fmt.Printf("Erreur purge challenges 2FA: %v\n", err)
+	}
+
+	jtiBytes := make([]byte, 16)
+	if _, err := rand.Read(jtiBytes); err != nil {
+		return "", err
+	}
+	jti := hex.EncodeToString(jtiBytes)
+
+	_, err := database.DB.Exec(
+		"INSERT INTO two_factor_challenges (id, user_id, expires_at) VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 second')",
+		jti, userID, int64(twoFactorChallengeTTL.Seconds()),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return keys.Default.Sign(jwt.MapClaims{
+		"purpose": twoFactorChallengeType,
+		"user_id": userID,
+		"jti":     jti,
+		"exp":     time.Now().Add(twoFactorChallengeTTL).Unix(),
+	})
+}
+
+func deleteTwoFactorChallenge(jti string) {
+	if _, err := database.DB.Exec("DELETE FROM two_factor_challenges WHERE id = $1", jti); err != nil {
+		fmt.Printf("Erreur suppression challenge 2FA: %v\n", err)
+	}
+}
+
+// requireSecondFactor vérifie le code lorsque la double authentification est
+// activée et écrit la réponse d'erreur sinon. Les échecs sont limités par compte
+func requireSecondFactor(c *gin.Context, userID int, code string) bool {
+	// La tentative est comptée avant la vérification du code : des requêtes
+	// simultanées ne peuvent pas dépasser ensemble le nombre d'essais
+	throttleKey := strconv.Itoa(userID)
+	wait, locked, err := security.TwoFactorByUser.Attempt(throttleKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return false
+	}
+	if wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return false
+	}
+
+	valid, err := verifySecondFactor(userID, code)
+	if err != nil {
+		fmt.Printf("Erreur vérification code 2FA: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur serveur"})
+		return false
+	}
+
+	if !valid {
+		security.LogEvent(security.EventTwoFactorFailed, &userID, c.ClientIP(), nil)
+		if locked {
+			security.LogEvent(security.EventAccountLocked, &userID, c.ClientIP(), map[string]interface{}{"scope": security.TwoFactorByUser.Scope})
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Code de double authentification invalide", "code": "totp_invalid"})
+		return false
+	}
+
+	if err := security.TwoFactorByUser.Reset(throttleKey); err != nil {
+		fmt.Printf("Erreur remise à zéro des échecs 2FA: %v\n", err)
+	}
+	return true
+}
+
+// verifySecondFactor accepte un code TOTP jamais utilisé ou un code de secours,
+// qui est alors consommé. Retourne vrai si la double authentification est désactivée
+func verifySecondFactor(userID int, code string) (bool, error) {
+	var enabled bool
+	var stored sql.NullString
+	var keyID *string
+	var lastStep int64
+	err := database.DB.QueryRow(
+		"SELECT totp_enabled, totp_secret, totp_secret_key_id, totp_last_step FROM users WHERE id = $1",
+		userID,
+	).Scan(&enabled, &stored, &keyID, &lastStep)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return true, nil
+	}
+	if code == "" || !stored.Valid {
+		return false, nil
+	}
+	secret, err := totp.OpenSecret(userID, keyID, stored.String)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now(), lastStep); ok {
+		// La condition sur totp_last_step empêche deux requêtes simultanées d'utiliser le même code
+		result, err := database.DB.Exec(
+			"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1",
+			step, userID,
+		)
+		if err != nil {
+			return false, err
+		}
+		rows, _ := result.RowsAffected()
+		return rows == 1, nil
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE totp_recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, hashToken(totp.NormalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1, nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"backend-go/media"
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// multipartOverhead laisse la place aux autres champs du formulaire et aux
+// en-têtes multipart en plus du fichier
+const multipartOverhead = 1 << 20
+
+var errUnsupportedMediaType = errors.New("type de fichier non autorisé")
+
+// limitUploadBody coupe la lecture du corps de la requête au-delà de
+// maxFileSize : un fichier trop gros est refusé pendant sa réception, sans
+// être écrit en entier sur le disque
+func limitUploadBody(c *gin.Context, maxFileSize int64) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFileSize+multipartOverhead)
+}
+
+// isTooLarge indique si err vient d'un dépassement de la taille maximale
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr) || errors.Is(err, media.ErrTooLarge)
+}
+
+// checkedUpload est un fichier dont le type a été vérifié, prêt à être stocké
+type checkedUpload struct {
+	Body     io.Reader
+	Size     int64
+	MimeType string
+}
+
+// checkUpload détecte le type réel du fichier d'après son contenu, le compare
+// à allowed et retire les métadonnées des images. Les erreurs sont
+// errUnsupportedMediaType, media.ErrInvalidImage ou media.ErrTooLarge
+func checkUpload(file multipart.File, header *multipart.FileHeader, allowed []string, maxSize int64) (*checkedUpload, error) {
+	if header.Size > maxSize {
+		return nil, media.ErrTooLarge
+	}
+
+	mimeType, err := media.Sniff(file)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(allowed, mimeType) {
+		return nil, errUnsupportedMediaType
+	}
+
+	body := media.LimitReader(file, maxSize)
+	if !media.IsImage(mimeType) {
+		return &checkedUpload{Body: body, Size: header.Size, MimeType: mimeType}, nil
+	}
+
+	data, err := media.StripMetadata(body, mimeType)
+	if err != nil {
+		return nil, err
+	}
+	return &checkedUpload{Body: bytes.NewReader(data), Size: int64(len(data)), MimeType: mimeType}, nil
+}
+
+// uploadError répond à une erreur de checkUpload ou de réception du fichier ;
+// retourne false si err n'en est pas une
+func uploadError(c *gin.Context, err error, key string, allowed []string, maxSize int64) bool {
+	switch {
+	case isTooLarge(err):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			key:        "Fichier trop volumineux",
+			"code":     "file_too_large",
+			"max_size": maxSize,
+		})
+	case errors.Is(err, errUnsupportedMediaType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			key:             "Type de fichier non autorisé",
+			"code":          "unsupported_media_type",
+			"allowed_types": allowed,
+		})
+	case errors.Is(err, media.ErrInvalidImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			key:    "Image illisible ou trop grande",
+			"code": "invalid_image",
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/models"
+	"backend-go/quotas"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaMessages sont les messages des dépassements de quota, par code
+var quotaMessages = map[string]string{
+	quotas.CodeStorage:   "Espace de stockage insuffisant",
+	quotas.CodeDocuments: "Nombre maximal de documents atteint pour ce véhicule",
+	quotas.CodeVehicles:  "Nombre maximal de véhicules atteint",
+}
+
+// quotaError répond à un dépassement de quota : 402 si un abonnement premium
+// lève la limite, 403 si elle est déjà celle de l'abonnement premium.
+// Retourne false si err n'est pas un dépassement de quota
+func quotaError(c *gin.Context, err error) bool {
+	var exceeded *quotas.ExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+	status := http.StatusForbidden
+	if exceeded.Plan == quotas.PlanFree {
+		status = http.StatusPaymentRequired
+	}
+	c.JSON(status, gin.H{
+		"message": quotaMessages[exceeded.Code],
+		"code":    exceeded.Code,
+		"plan":    exceeded.Plan,
+		"limit":   exceeded.Limit,
+		"usage":   exceeded.Usage,
+	})
+	return true
+}
+
+// checkQuota répond à l'erreur d'une vérification de quota ; retourne true si
+// l'opération peut continuer
+func checkQuota(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	if !quotaError(c, err) {
+		fmt.Printf("Erreur vérification quota: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur vérification quota"})
+	}
+	return false
+}
+
+// GetUsage retourne la consommation de l'utilisateur et les quotas de son abonnement
+func GetUsage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	plan, err := quotas.UserPlan(ctx, database.DB, userID.(int))
+	if err != nil {
+		fmt.Printf("Erreur lecture abonnement: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture consommation"})
+		return
+	}
+	storageUsed, err := quotas.StorageUsed(ctx, database.DB, userID.(int))
+	if err != nil {
+		fmt.Printf("Erreur lecture espace utilisé: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture consommation"})
+		return
+	}
+
+	rows, err := database.DB.QueryContext(ctx, `
+		SELECT v.id, v.plate, COUNT(d.id)
+		FROM vehicles v LEFT JOIN documents d ON d.vehicle_id = v.id AND d.deleted_at IS NULL
+		WHERE v.user_id = $1
+		GROUP BY v.id, v.plate
+		ORDER BY v.id`, userID)
+	if err != nil {
+		fmt.Printf("Erreur lecture documents par véhicule: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur lecture consommation"})
+		return
+	}
+	defer rows.Close()
+
+	documents := []models.VehicleUsage{}
+	for rows.Next() {
+		var usage models.VehicleUsage
+		if err := rows.Scan(&usage.VehicleID, &usage.Plate, &usage.Documents); err != nil {
+			continue
+		}
+		documents = append(documents, usage)
+	}
+
+	c.JSON(http.StatusOK, models.UsageResponse{
+		Plan:         plan,
+		Limits:       quotas.Plans[plan],
+		StorageBytes: storageUsed,
+		Vehicles:     len(documents),
+		Documents:    documents,
+	})
+}
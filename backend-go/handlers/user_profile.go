@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"backend-go/database"
+	"backend-go/media"
 	"backend-go/models"
+	"backend-go/security"
+	"backend-go/storage"
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -26,7 +29,7 @@ func GetUserProfile(c *gin.Context) {
 
 	var user models.User
 	query := `
-		SELECT id, email, full_name, first_name, last_name, phone, profile_picture, created_at, updated_at 
+		SELECT id, email, full_name, first_name, last_name, phone, profile_picture, email_verified, pending_email, totp_enabled, role, created_at, updated_at 
 		FROM users WHERE id = $1
 	`
 
@@ -38,6 +41,10 @@ func GetUserProfile(c *gin.Context) {
 		&user.LastName,
 		&user.Phone,
 		&user.ProfilePicture,
+		&user.EmailVerified,
+		&user.PendingEmail,
+		&user.TOTPEnabled,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -57,6 +64,14 @@ func GetUserProfile(c *gin.Context) {
 		LastName:       user.LastName,
 		Phone:          user.Phone,
 		ProfilePicture: user.ProfilePicture,
+		EmailVerified:  user.EmailVerified,
+		PendingEmail:   user.PendingEmail,
+		TOTPEnabled:    user.TOTPEnabled,
+		Role:           user.Role,
+	}
+	if user.ProfilePicture != nil && *user.ProfilePicture != "" {
+		url := profilePictureURL(*user.ProfilePicture)
+		response.ProfilePicture = &url
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -98,16 +113,23 @@ func UpdateUserProfile(c *gin.Context) {
 		fullName = *req.LastName
 	}
 
-	// Mettre à jour le profil
+	var currentEmail string
+	err = database.DB.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&currentEmail)
+	if err != nil {
+		fmt.Printf("Erreur récupération email: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour du profil"})
+		return
+	}
+
+	// Mettre à jour le profil, l'email n'est pas modifié ici
 	updateQuery := `
 		UPDATE users 
-		SET email = $1, full_name = $2, first_name = $3, last_name = $4, phone = $5, updated_at = $6
-		WHERE id = $7
+		SET full_name = $1, first_name = $2, last_name = $3, phone = $4, updated_at = $5
+		WHERE id = $6
 	`
 
 	_, err = database.DB.Exec(
 		updateQuery,
-		req.Email,
 		fullName,
 		req.FirstName,
 		req.LastName,
@@ -122,6 +144,28 @@ func UpdateUserProfile(c *gin.Context) {
 		return
 	}
 
+	// Une nouvelle adresse ne remplace l'ancienne qu'une fois confirmée
+	if req.Email != currentEmail {
+		_, err = database.DB.Exec("UPDATE users SET pending_email = $1 WHERE id = $2", req.Email, userID)
+		if err != nil {
+			fmt.Printf("Erreur enregistrement email en attente: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour du profil"})
+			return
+		}
+
+		if err := sendVerificationEmail(c, userID.(int), req.Email, fullName, ""); err != nil {
+			fmt.Printf("Erreur envoi email de vérification: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de l'envoi de l'email de vérification"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "Profil mis à jour. Un lien de confirmation a été envoyé à la nouvelle adresse email.",
+			"pending_email": req.Email,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Profil mis à jour avec succès",
 	})
@@ -142,8 +186,8 @@ func UpdatePassword(c *gin.Context) {
 	}
 
 	// Récupérer le mot de passe actuel hashé
-	var currentHashedPassword string
-	err := database.DB.QueryRow("SELECT password FROM users WHERE id = $1", userID).Scan(&currentHashedPassword)
+	var currentHashedPassword, email string
+	err := database.DB.QueryRow("SELECT password, email FROM users WHERE id = $1", userID).Scan(&currentHashedPassword, &email)
 	if err != nil {
 		fmt.Printf("Erreur récupération mot de passe: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la vérification du mot de passe"})
@@ -157,6 +201,11 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	// Code TOTP exigé si la double authentification est activée
+	if !requireSecondFactor(c, userID.(int), req.TOTPCode) {
+		return
+	}
+
 	// Hasher le nouveau mot de passe
 	hashedNewPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -174,8 +223,29 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	// Invalider toutes les sessions existantes, y compris celle en cours
+	if err := revokeAllSessions(userID); err != nil {
+		fmt.Printf("Erreur révocation sessions: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la révocation des sessions"})
+		return
+	}
+
+	uid := userID.(int)
+	security.LogEvent(security.EventPasswordChanged, &uid, c.ClientIP(), nil)
+
+	// Ouvrir une nouvelle session pour l'appareil courant
+	tokens, err := issueSession(c, userID.(int), email)
+	if err != nil {
+		fmt.Printf("Erreur création session: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création de la session"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Mot de passe changé avec succès",
+		"message":       "Mot de passe changé avec succès",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 	})
 }
 
@@ -187,116 +257,136 @@ func UploadProfilePicture(c *gin.Context) {
 		return
 	}
 
+	// Refuser les fichiers trop gros pendant la réception
+	limitUploadBody(c, media.MaxProfilePictureSize)
+
 	// Récupérer le fichier uploadé
 	file, header, err := c.Request.FormFile("profile_picture")
 	if err != nil {
+		if uploadError(c, err, "error", nil, media.MaxProfilePictureSize) {
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Aucun fichier fourni"})
 		return
 	}
 	defer file.Close()
 
-	// Vérifier le type de fichier
-	allowedTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/gif":  true,
-	}
-
-	contentType := header.Header.Get("Content-Type")
-	if !allowedTypes[contentType] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Type de fichier non autorisé. Seules les images sont acceptées."})
-		return
-	}
-
-	// Vérifier la taille du fichier (max 5MB)
-	if header.Size > 5*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Le fichier ne peut pas dépasser 5MB"})
-		return
-	}
-
-	// Créer le dossier de destination s'il n'existe pas
-	uploadDir := "uploads/profile_pictures"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		fmt.Printf("Erreur création dossier: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création du dossier"})
+	// Vérifier le type réel de l'image et retirer ses métadonnées EXIF
+	allowedTypes := []string{media.JPEG, media.PNG, media.GIF}
+	upload, err := checkUpload(file, header, allowedTypes, media.MaxProfilePictureSize)
+	if err != nil {
+		if !uploadError(c, err, "error", allowedTypes, media.MaxProfilePictureSize) {
+			fmt.Printf("Erreur lecture fichier: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la lecture du fichier"})
+		}
 		return
 	}
 
-	// Générer un nom de fichier unique
-	userIDStr := strconv.Itoa(userID.(int))
-	fileExt := filepath.Ext(header.Filename)
-	if fileExt == "" {
-		// Déterminer l'extension à partir du content type
-		switch contentType {
-		case "image/jpeg", "image/jpg":
-			fileExt = ".jpg"
-		case "image/png":
-			fileExt = ".png"
-		case "image/gif":
-			fileExt = ".gif"
-		default:
-			fileExt = ".jpg"
-		}
+	// Générer un nom de fichier aléatoire, l'extension découle du type
+	// détecté et jamais du nom envoyé par le client
+	var fileExt string
+	switch upload.MimeType {
+	case media.PNG:
+		fileExt = ".png"
+	case media.GIF:
+		fileExt = ".gif"
+	default:
+		fileExt = ".jpg"
 	}
+	fileKey := storage.NewKey("profile_pictures", fileExt)
 
-	fileName := fmt.Sprintf("user_%s_%d%s", userIDStr, time.Now().Unix(), fileExt)
-	filePath := filepath.Join(uploadDir, fileName)
-
-	// Supprimer l'ancienne photo de profil si elle existe
+	// Récupérer l'ancienne photo de profil, supprimée une fois la nouvelle enregistrée
 	var oldProfilePicture *string
-	err = database.DB.QueryRow("SELECT profile_picture FROM users WHERE id = $1", userID).Scan(&oldProfilePicture)
-	if err == nil && oldProfilePicture != nil && *oldProfilePicture != "" {
-		oldFilePath := *oldProfilePicture
-		if _, err := os.Stat(oldFilePath); err == nil {
-			os.Remove(oldFilePath)
-		}
-	}
+	database.DB.QueryRow("SELECT profile_picture FROM users WHERE id = $1", userID).Scan(&oldProfilePicture)
 
-	// Sauvegarder le nouveau fichier
-	dst, err := os.Create(filePath)
-	if err != nil {
-		fmt.Printf("Erreur création fichier: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde du fichier"})
-		return
+	// Sauvegarder le nouveau fichier et ses variantes redimensionnées
+	data, err := io.ReadAll(upload.Body)
+	if err == nil {
+		err = storage.Default.Put(c.Request.Context(), fileKey, bytes.NewReader(data), int64(len(data)), upload.MimeType)
 	}
-	defer dst.Close()
-
-	if _, err := io.Copy(dst, file); err != nil {
-		fmt.Printf("Erreur copie fichier: %v\n", err)
+	if err != nil {
+		if uploadError(c, err, "error", allowedTypes, media.MaxProfilePictureSize) {
+			return
+		}
+		fmt.Printf("Erreur sauvegarde fichier: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la sauvegarde du fichier"})
 		return
 	}
+	saveProfilePictureVariants(c.Request.Context(), fileKey, data)
 
-	// Mettre à jour le chemin de la photo de profil en base
+	// Mettre à jour la clé de la photo de profil en base
 	updateQuery := "UPDATE users SET profile_picture = $1, updated_at = $2 WHERE id = $3"
-	_, err = database.DB.Exec(updateQuery, filePath, time.Now(), userID)
+	_, err = database.DB.Exec(updateQuery, fileKey, time.Now(), userID)
 	if err != nil {
 		fmt.Printf("Erreur mise à jour photo profil: %v\n", err)
 		// Supprimer le fichier si la mise à jour en base échoue
-		os.Remove(filePath)
+		deleteProfilePicture(c.Request.Context(), fileKey)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la mise à jour de la photo de profil"})
 		return
 	}
 
+	if oldProfilePicture != nil && *oldProfilePicture != "" {
+		deleteProfilePicture(c.Request.Context(), storage.KeyFromPath(*oldProfilePicture))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":         "Photo de profil uploadée avec succès",
-		"profile_picture": filePath,
+		"profile_picture": profilePictureURL(fileKey),
 	})
 }
 
-// ServeProfilePicture sert les photos de profil statiquement
+// ServeProfilePicture sert les photos de profil depuis le stockage ;
+// ?size=64 ou ?size=256 sert la variante redimensionnée si elle existe
 func ServeProfilePicture(c *gin.Context) {
 	fileName := c.Param("filename")
-	filePath := filepath.Join("uploads/profile_pictures", fileName)
-
-	// Vérifier que le fichier existe
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	if strings.ContainsAny(fileName, "/\\") || strings.HasPrefix(fileName, ".") {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Fichier non trouvé"})
 		return
 	}
+	key := "profile_pictures/" + fileName
+
+	// Les photos envoyées avant les variantes n'en ont pas : l'original est servi
+	if size, err := strconv.Atoi(c.Query("size")); err == nil && containsInt(media.ProfilePictureSizes, size) {
+		variantKey := storage.VariantKey(key, strconv.Itoa(size), ".jpg")
+		if _, err := storage.Default.Stat(c.Request.Context(), variantKey); err == nil {
+			key = variantKey
+		}
+	}
 
-	c.File(filePath)
+	serveStoredFile(c, key, fileName, "", false)
+}
+
+// saveProfilePictureVariants enregistre les versions redimensionnées de la
+// photo ; en cas d'échec l'original est servi à la place
+func saveProfilePictureVariants(ctx context.Context, key string, data []byte) {
+	for _, size := range media.ProfilePictureSizes {
+		variant, err := media.Thumbnail(data, size)
+		if err == nil {
+			err = storage.Default.Put(ctx, storage.VariantKey(key, strconv.Itoa(size), ".jpg"), bytes.NewReader(variant), int64(len(variant)), media.JPEG)
+		}
+		if err != nil {
+			fmt.Printf("Erreur variante %d de la photo de profil: %v\n", size, err)
+		}
+	}
+}
+
+// deleteProfilePicture supprime une photo de profil et ses variantes
+func deleteProfilePicture(ctx context.Context, key string) {
+	keys := []string{key}
+	for _, size := range media.ProfilePictureSizes {
+		keys = append(keys, storage.VariantKey(key, strconv.Itoa(size), ".jpg"))
+	}
+	for _, key := range keys {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			fmt.Printf("Erreur suppression photo de profil %s: %v\n", key, err)
+		}
+	}
+}
+
+// profilePictureURL convertit la clé stockée en base en chemin servi par
+// ServeProfilePicture, format attendu par les applications
+func profilePictureURL(key string) string {
+	return storage.LegacyPrefix + storage.KeyFromPath(key)
 }
 
 func DeleteUser(c *gin.Context) {
@@ -306,6 +396,18 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// Code TOTP exigé si la double authentification est activée
+	var req models.DeleteUserRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !requireSecondFactor(c, userID.(int), req.TOTPCode) {
+		return
+	}
+
 	tx, err := database.DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Erreur lors de la création de la transaction"})
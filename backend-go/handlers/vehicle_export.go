@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"backend-go/database"
+	"backend-go/dossier"
+	"backend-go/storage"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportVehicle envoie le dossier complet d'un véhicule en ZIP : tous ses
+// documents, un résumé PDF et manifest.json. L'archive est produite au fil de
+// l'eau, sans être construite en mémoire ni sur le disque
+func ExportVehicle(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Non autorisé"})
+		return
+	}
+
+	vehicleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "ID véhicule invalide"})
+		return
+	}
+
+	d, err := dossier.Load(database.DB, vehicleID, userID.(int))
+	if errors.Is(err, dossier.ErrVehicleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Véhicule non trouvé"})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Erreur chargement dossier véhicule: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur export du véhicule"})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", storage.ContentDisposition("attachment", d.FileName()))
+	c.Header("Cache-Control", "private, no-store")
+	c.Status(http.StatusOK)
+
+	// Les en-têtes sont partis : une erreur ne peut plus qu'interrompre le transfert
+	if err := d.WriteZIP(c.Request.Context(), c.Writer); err != nil {
+		fmt.Printf("Erreur export véhicule %d: %v\n", vehicleID, err)
+		c.Abort()
+	}
+}
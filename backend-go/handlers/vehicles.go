@@ -2,12 +2,17 @@ package handlers
 
 import (
 	"backend-go/database"
+	"backend-go/mailer"
 	"backend-go/models"
+	"backend-go/quotas"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,8 +30,26 @@ func CreateVehicle(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+	tx, err := database.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création véhicule"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Nombre de véhicules limité par l'abonnement ; le verrou empêche deux
+	// créations simultanées de dépasser la limite
+	if err := quotas.LockUser(ctx, tx, userID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création véhicule"})
+		return
+	}
+	if !checkQuota(c, quotas.CheckVehicles(ctx, tx, userID.(int))) {
+		return
+	}
+
 	var vehicleID int
-	err := database.DB.QueryRow(
+	err = tx.QueryRow(
 		"INSERT INTO vehicles (user_id, plate, model, brand, year, mileage, technical_control_date, image_url, brand_image_url) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
 		userID, req.Plate, req.Model, req.Brand, req.Year, req.Mileage, req.TechnicalControlDate, req.ImageURL, req.BrandImageURL,
 	).Scan(&vehicleID)
@@ -35,6 +58,10 @@ func CreateVehicle(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création véhicule"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur création véhicule"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":    "Véhicule créé avec succès",
@@ -181,8 +208,8 @@ func UpdateVehicle(c *gin.Context) {
 	}
 
 	_, err = database.DB.Exec(
-		"UPDATE vehicles SET plate = $1, model = $2, brand = $3, year = $4, mileage = $5, technical_control_date = $6, image_url = $7, brand_image_url = $8, updated_at = CURRENT_TIMESTAMP WHERE id = $9",
-		req.Plate, req.Model, req.Brand, req.Year, req.Mileage, req.TechnicalControlDate, req.ImageURL, req.BrandImageURL, vehicleID,
+		"UPDATE vehicles SET plate = $1, model = $2, brand = $3, year = $4, mileage = $5, technical_control_date = $6, image_url = $7, brand_image_url = $8, updated_at = CURRENT_TIMESTAMP WHERE id = $9 AND user_id = $10",
+		req.Plate, req.Model, req.Brand, req.Year, req.Mileage, req.TechnicalControlDate, req.ImageURL, req.BrandImageURL, vehicleID, userID,
 	)
 
 	if err != nil {
@@ -374,20 +401,25 @@ func TransferVehicle(c *gin.Context) {
 	}
 
 	// Vérifier que le véhicule appartient à l'utilisateur
-	var vehicleExists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM vehicles WHERE id = $1 AND user_id = $2)", vehicleID, userID).Scan(&vehicleExists)
-	if err != nil || !vehicleExists {
+	var plate, brand, model string
+	err = database.DB.QueryRow("SELECT plate, brand, model FROM vehicles WHERE id = $1 AND user_id = $2", vehicleID, userID).Scan(&plate, &brand, &model)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Véhicule non trouvé"})
 		return
 	}
 
 	// Vérifier si l'utilisateur destinataire existe
 	var newOwnerID int
-	err = database.DB.QueryRow("SELECT id FROM users WHERE email = $1", req.NewOwnerEmail).Scan(&newOwnerID)
+	var newOwnerName string
+	err = database.DB.QueryRow("SELECT id, full_name FROM users WHERE email = $1", req.NewOwnerEmail).Scan(&newOwnerID, &newOwnerName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Utilisateur destinataire non trouvé. L'utilisateur doit d'abord créer un compte."})
 		return
 	}
+	if newOwnerID == userID.(int) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Le véhicule vous appartient déjà"})
+		return
+	}
 
 	// Démarrer une transaction pour transférer le véhicule et ses documents
 	tx, err := database.DB.Begin()
@@ -397,20 +429,49 @@ func TransferVehicle(c *gin.Context) {
 	}
 	defer tx.Rollback()
 
-	// Transférer le véhicule
-	_, err = tx.Exec("UPDATE vehicles SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", newOwnerID, vehicleID)
+	// Le véhicule et ses documents doivent tenir dans les quotas du nouveau
+	// propriétaire ; le verrou empêche un envoi ou une création simultanés de
+	// les dépasser
+	ctx := c.Request.Context()
+	if err := quotas.LockUser(ctx, tx, newOwnerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur transfert véhicule"})
+		return
+	}
+	if !checkQuota(c, quotas.CheckTransfer(ctx, tx, newOwnerID, vehicleID)) {
+		return
+	}
+
+	// Transférer le véhicule, s'il appartient toujours à l'utilisateur
+	result, err := tx.Exec("UPDATE vehicles SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND user_id = $3", newOwnerID, vehicleID, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur transfert véhicule"})
 		return
 	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Véhicule non trouvé"})
+		return
+	}
 
-	// Transférer tous les documents associés au véhicule
-	_, err = tx.Exec("UPDATE documents SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE vehicle_id = $2", newOwnerID, vehicleID)
+	// Transférer tous les documents associés au véhicule ; ceux que l'ancien
+	// propriétaire a supprimés restent à lui jusqu'à leur purge
+	_, err = tx.Exec("UPDATE documents SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE vehicle_id = $2 AND deleted_at IS NULL", newOwnerID, vehicleID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur transfert documents"})
 		return
 	}
 
+	// Les liens de partage créés par l'ancien propriétaire cessent de fonctionner
+	_, err = tx.Exec(`
+		UPDATE document_shares SET revoked_at = $1 
+		WHERE user_id = $2 AND revoked_at IS NULL 
+		AND document_id IN (SELECT id FROM documents WHERE vehicle_id = $3)`,
+		time.Now().UTC(), userID, vehicleID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur révocation des partages"})
+		return
+	}
+
 	// Transférer tous les rendez-vous associés au véhicule
 	_, err = tx.Exec("UPDATE appointments SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE vehicle_id = $2", newOwnerID, vehicleID)
 	if err != nil {
@@ -420,7 +481,7 @@ func TransferVehicle(c *gin.Context) {
 
 	// Compter le nombre de documents transférés
 	var documentCount int
-	err = tx.QueryRow("SELECT COUNT(*) FROM documents WHERE vehicle_id = $1", vehicleID).Scan(&documentCount)
+	err = tx.QueryRow("SELECT COUNT(*) FROM documents WHERE vehicle_id = $1 AND deleted_at IS NULL", vehicleID).Scan(&documentCount)
 	if err != nil {
 		documentCount = 0
 	}
@@ -438,10 +499,27 @@ func TransferVehicle(c *gin.Context) {
 		return
 	}
 
+	// Le nouveau propriétaire est prévenu que le dossier complet du véhicule
+	// (documents, historique) est disponible en export dans son compte
+	exportURL := fmt.Sprintf("/vehicles/%d/export", vehicleID)
+	msg, err := mailer.Render("vehicle_transferred", c.GetHeader("Accept-Language"), req.NewOwnerEmail, gin.H{
+		"Name":         newOwnerName,
+		"Plate":        plate,
+		"Vehicle":      strings.TrimSpace(brand + " " + model),
+		"Documents":    documentCount,
+		"Appointments": appointmentCount,
+	})
+	if err != nil {
+		fmt.Printf("Erreur préparation email de transfert: %v\n", err)
+	} else {
+		mailer.SendAsync(msg)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Véhicule transféré avec succès",
 		"newOwnerEmail": req.NewOwnerEmail,
 		"documentsTransferred": documentCount,
 		"appointmentsTransferred": appointmentCount,
+		"exportUrl": exportURL,
 	})
 }
@@ -0,0 +1,499 @@
+package keys
+
+import (
+	"backend-go/encryption"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Algorithmes de signature supportés
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Clé de verrou consultatif utilisée pendant une rotation
+const rotationLockID = 72150411
+
+// Délai minimal entre deux rechargements déclenchés par un kid inconnu
+const reloadCooldown = 10 * time.Second
+
+var ErrUnknownKey = errors.New("clé de signature inconnue")
+
+// Key est une clé de signature identifiée par son kid
+type Key struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	RetiredAt *time.Time
+	ExpiresAt *time.Time
+}
+
+// Public retourne la clé publique associée
+func (k *Key) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+func (k *Key) signingMethod() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Config regroupe les paramètres de rotation des clés
+type Config struct {
+	Algorithm        string
+	RotationInterval time.Duration
+	GracePeriod      time.Duration
+}
+
+// Manager garde en mémoire les clés actives, signe les jetons avec la clé
+// courante et vérifie ceux signés par une clé encore dans sa période de grâce
+type Manager struct {
+	db         *sql.DB
+	config     Config
+	mu         sync.RWMutex
+	keys       map[string]*Key
+	current    *Key
+	lastReload time.Time
+}
+
+// Default est le gestionnaire utilisé par les handlers et le middleware
+var Default *Manager
+
+// Init crée le gestionnaire par défaut à partir des variables d'environnement
+func Init(db *sql.DB) {
+	config := Config{
+		Algorithm:        os.Getenv("JWT_SIGNING_ALG"),
+		RotationInterval: durationFromEnv("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+		GracePeriod:      durationFromEnv("JWT_KEY_GRACE_PERIOD", 24*time.Hour),
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = AlgRS256
+	}
+
+	if !encryption.Enabled() {
+		log.Println("⚠️  DOCUMENT_ENCRYPTION_KEYS non configuré : les clés de signature JWT sont stockées en clair")
+	}
+
+	manager, err := NewManager(db, config)
+	if err != nil {
+		log.Fatal("Erreur initialisation clés de signature:", err)
+	}
+	Default = manager
+}
+
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Valeur invalide pour %s (%s), utilisation de %s", name, value, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// NewManager charge les clés depuis la base et en génère une si aucune n'est à jour
+func NewManager(db *sql.DB, config Config) (*Manager, error) {
+	if config.Algorithm != AlgRS256 && config.Algorithm != AlgEdDSA {
+		return nil, fmt.Errorf("algorithme de signature non supporté: %s", config.Algorithm)
+	}
+
+	m := &Manager{db: db, config: config, keys: map[string]*Key{}}
+
+	// Les clés stockées en clair ou sous une ancienne clé maître sont
+	// rechiffrées avant d'être chargées
+	if sealed, err := Rewrap(context.Background(), db); err != nil {
+		return nil, err
+	} else if sealed > 0 {
+		log.Printf("%d clé(s) de signature rechiffrée(s) avec la clé maître %s", sealed, encryption.ActiveKeyID())
+	}
+
+	// Au premier démarrage, ou si la clé courante a expiré pendant l'arrêt du service
+	if err := m.rotate(false); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Reload relit les clés non expirées depuis la base
+func (m *Manager) Reload() error {
+	rows, err := m.db.Query(`
+		SELECT kid, algorithm, private_key, master_key_id, created_at, retired_at, expires_at
+		FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at ASC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := map[string]*Key{}
+	var current *Key
+	for rows.Next() {
+		var key Key
+		var stored string
+		var masterKeyID *string
+		if err := rows.Scan(&key.ID, &key.Algorithm, &stored, &masterKeyID, &key.CreatedAt, &key.RetiredAt, &key.ExpiresAt); err != nil {
+			return err
+		}
+
+		privatePEM, err := openPrivateKey(key.ID, masterKeyID, stored)
+		if err != nil {
+			log.Printf("Clé de signature %s indéchiffrable: %v", key.ID, err)
+			continue
+		}
+		signer, err := parsePrivateKey(privatePEM)
+		if err != nil {
+			log.Printf("Clé de signature %s illisible: %v", key.ID, err)
+			continue
+		}
+		key.Private = signer
+		keys[key.ID] = &key
+
+		if key.RetiredAt == nil {
+			current = &key
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.current = current
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Rotate génère une nouvelle clé courante et retire la précédente, qui reste
+// acceptée en vérification pendant la période de grâce
+func (m *Manager) Rotate() error {
+	return m.rotate(true)
+}
+
+// rotate ne crée une clé que si force est vrai ou si la clé courante a dépassé
+// l'intervalle de rotation ; la vérification se fait sous verrou pour que
+// plusieurs répliques ne fassent pas tourner la clé au même moment
+func (m *Manager) rotate(force bool) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", rotationLockID); err != nil {
+		return err
+	}
+
+	if !force {
+		var fresh bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM signing_keys
+				WHERE retired_at IS NULL AND algorithm = $2
+				AND created_at > CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+			)`,
+			int64(m.config.RotationInterval.Seconds()), m.config.Algorithm,
+		).Scan(&fresh)
+		if err != nil {
+			return err
+		}
+		if fresh {
+			return m.Reload()
+		}
+	}
+
+	kid, privatePEM, err := generateKey(m.config.Algorithm)
+	if err != nil {
+		return err
+	}
+	masterKeyID, stored, err := sealPrivateKey(kid, privatePEM)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE signing_keys
+		SET retired_at = CURRENT_TIMESTAMP, expires_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		WHERE retired_at IS NULL`,
+		int64(m.config.GracePeriod.Seconds()),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO signing_keys (kid, algorithm, private_key, master_key_id) VALUES ($1, $2, $3, $4)",
+		kid, m.config.Algorithm, stored, masterKeyID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Nouvelle clé de signature %s (%s)", kid, m.config.Algorithm)
+	return m.Reload()
+}
+
+// StartRotation recharge périodiquement les clés et effectue la rotation
+// lorsque la clé courante a dépassé l'intervalle configuré
+func (m *Manager) StartRotation(checkEvery time.Duration) {
+	go func() {
+		ticker := time.NewTicker(checkEvery)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := m.rotate(false); err != nil {
+				log.Printf("Erreur rotation clé de signature: %v", err)
+			}
+
+			// Après une rotation de DOCUMENT_ENCRYPTION_KEYS
+			if sealed, err := Rewrap(context.Background(), m.db); err != nil {
+				log.Printf("Erreur rechiffrement clés de signature: %v", err)
+			} else if sealed > 0 {
+				log.Printf("%d clé(s) de signature rechiffrée(s) avec la clé maître %s", sealed, encryption.ActiveKeyID())
+			}
+
+			if _, err := m.db.Exec("DELETE FROM signing_keys WHERE expires_at < CURRENT_TIMESTAMP"); err != nil {
+				log.Printf("Erreur purge clés expirées: %v", err)
+			}
+		}
+	}()
+}
+
+func (m *Manager) currentKey() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+func (m *Manager) lookup(kid string) *Key {
+	m.mu.RLock()
+	key := m.keys[kid]
+	stale := time.Since(m.lastReload) > reloadCooldown
+	m.mu.RUnlock()
+
+	if key != nil || !stale {
+		return key
+	}
+
+	// La clé a peut-être été créée par une autre réplique
+	if err := m.Reload(); err != nil {
+		log.Printf("Erreur rechargement clés de signature: %v", err)
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+// Sign signe les claims avec la clé courante et renseigne l'en-tête kid
+func (m *Manager) Sign(claims jwt.Claims) (string, error) {
+	key := m.currentKey()
+	if key == nil {
+		return "", errors.New("aucune clé de signature active")
+	}
+
+	token := jwt.NewWithClaims(key.signingMethod(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc retrouve la clé publique désignée par le kid du jeton et refuse
+// tout algorithme différent de celui de la clé
+func (m *Manager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, ErrUnknownKey
+	}
+
+	key := m.lookup(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("algorithme %s inattendu pour la clé %s", token.Method.Alg(), kid)
+	}
+
+	return key.Public(), nil
+}
+
+// ValidMethods liste les algorithmes acceptés par le parseur
+func (m *Manager) ValidMethods() []string {
+	return []string{AlgRS256, AlgEdDSA}
+}
+
+// Parse vérifie un jeton signé par l'une des clés connues
+func (m *Manager) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, m.Keyfunc, jwt.WithValidMethods(m.ValidMethods()))
+}
+
+func generateKey(algorithm string) (string, string, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		err = fmt.Errorf("algorithme de signature non supporté: %s", algorithm)
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return "", "", err
+	}
+
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return "", "", err
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return hex.EncodeToString(kidBytes), string(privatePEM), nil
+}
+
+// sealedContext lie une clé privée chiffrée à son kid : elle ne peut pas être
+// déplacée sur une autre ligne
+func sealedContext(kid string) string {
+	return "signing_keys:" + kid
+}
+
+// sealPrivateKey chiffre une clé privée avec la clé maître active ; sans
+// DOCUMENT_ENCRYPTION_KEYS, la clé est conservée en PEM clair et l'identifiant
+// de clé maître retourné est nil
+func sealPrivateKey(kid, privatePEM string) (*string, string, error) {
+	if !encryption.Enabled() {
+		return nil, privatePEM, nil
+	}
+	masterKeyID, sealed, err := encryption.Seal(sealedContext(kid), []byte(privatePEM))
+	if err != nil {
+		return nil, "", err
+	}
+	return &masterKeyID, sealed, nil
+}
+
+// openPrivateKey retourne le PEM d'une clé privée lue en base
+func openPrivateKey(kid string, masterKeyID *string, stored string) (string, error) {
+	if masterKeyID == nil {
+		return stored, nil
+	}
+	privatePEM, err := encryption.Open(*masterKeyID, sealedContext(kid), stored)
+	if err != nil {
+		return "", err
+	}
+	return string(privatePEM), nil
+}
+
+// Rewrap chiffre avec la clé maître active les clés privées stockées en clair
+// ou sous une ancienne clé maître. Une clé illisible est signalée et laissée
+// en l'état. Retourne le nombre de clés rechiffrées
+func Rewrap(ctx context.Context, db *sql.DB) (int, error) {
+	if !encryption.Enabled() {
+		return 0, nil
+	}
+	active := encryption.ActiveKeyID()
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT kid, private_key, master_key_id FROM signing_keys WHERE master_key_id IS DISTINCT FROM $1",
+		active,
+	)
+	if err != nil {
+		return 0, err
+	}
+	type storedKey struct {
+		kid, stored string
+		masterKeyID *string
+	}
+	var pending []storedKey
+	for rows.Next() {
+		var k storedKey
+		if err := rows.Scan(&k.kid, &k.stored, &k.masterKeyID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sealed := 0
+	for _, k := range pending {
+		privatePEM, err := openPrivateKey(k.kid, k.masterKeyID, k.stored)
+		if err != nil {
+			log.Printf("Rechiffrement de la clé de signature %s impossible: %v", k.kid, err)
+			continue
+		}
+		masterKeyID, stored, err := sealPrivateKey(k.kid, privatePEM)
+		if err != nil {
+			return sealed, err
+		}
+		// Une clé supprimée ou déjà rechiffrée entre-temps est ignorée
+		result, err := db.ExecContext(ctx, `
+			UPDATE signing_keys SET private_key = $2, master_key_id = $3
+			WHERE kid = $1 AND master_key_id IS NOT DISTINCT FROM $4`,
+			k.kid, stored, masterKeyID, k.masterKeyID,
+		)
+		if err != nil {
+			return sealed, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			sealed++
+		}
+	}
+	return sealed, nil
+}
+
+func parsePrivateKey(privatePEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, errors.New("PEM invalide")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("type de clé non supporté")
+	}
+	return signer, nil
+}
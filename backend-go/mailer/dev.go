@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer écrit chaque email dans un fichier .eml, pratique en développement
+// pour ouvrir les messages dans un client mail
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) *FileMailer {
+	return &FileMailer{dir: dir}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+
+	body, err := buildMIME("no-reply@saveyourcar.local", msg)
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	filePath := filepath.Join(m.dir, fileName)
+	if err := os.WriteFile(filePath, body, 0600); err != nil {
+		return err
+	}
+
+	log.Printf("Email pour %s écrit dans %s", msg.To, filePath)
+	return nil
+}
+
+// LogMailer affiche les emails dans les logs. Sans ShowBody seuls le
+// destinataire et le sujet sont écrits, pour ne jamais exposer un lien
+// sensible quand aucun mailer n'est configuré
+type LogMailer struct {
+	ShowBody bool
+}
+
+func (m LogMailer) Send(msg Message) error {
+	if !m.ShowBody {
+		log.Printf("Email non envoyé (MAILER non configuré) pour %s: %s", msg.To, msg.Subject)
+		return nil
+	}
+	log.Printf("Email pour %s\nSujet: %s\n%s", msg.To, msg.Subject, msg.TextBody)
+	return nil
+}
@@ -0,0 +1,166 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Langues disponibles pour les emails, la première sert de repli
+var supportedLanguages = []string{"fr", "en"}
+
+// Message est un email prêt à être envoyé, avec ses versions texte et HTML
+type Message struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string
+}
+
+// Mailer est implémenté par chaque moyen d'envoi (SMTP, fichier, log)
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default est le mailer utilisé par les handlers
+var Default Mailer
+
+// Init choisit l'implémentation d'après MAILER (smtp, file ou log)
+func Init() {
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		Default = NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		})
+	case "file":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		Default = NewFileMailer(dir)
+	case "log":
+		Default = LogMailer{ShowBody: true}
+	default:
+		log.Println("MAILER non configuré, les emails ne seront pas envoyés")
+		Default = LogMailer{}
+	}
+}
+
+// NormalizeLanguage ramène une langue ou un en-tête Accept-Language à une langue supportée
+func NormalizeLanguage(lang string) string {
+	for _, part := range strings.Split(lang, ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		tag = strings.SplitN(tag, "-", 2)[0]
+		for _, supported := range supportedLanguages {
+			if tag == supported {
+				return supported
+			}
+		}
+	}
+	return supportedLanguages[0]
+}
+
+// Render construit un message à partir des templates <lang>/<name>.txt et
+// <lang>/<name>.html ; le sujet est défini dans le template texte
+func Render(name, lang, to string, data interface{}) (Message, error) {
+	lang = NormalizeLanguage(lang)
+	msg := Message{To: to}
+
+	textTmpl, err := texttemplate.ParseFS(templateFS, fmt.Sprintf("templates/%s/%s.txt", lang, name))
+	if err != nil {
+		return msg, err
+	}
+
+	var subject, text bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return msg, err
+	}
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return msg, err
+	}
+
+	htmlTmpl, err := htmltemplate.ParseFS(templateFS, fmt.Sprintf("templates/%s/%s.html", lang, name))
+	if err != nil {
+		return msg, err
+	}
+
+	var html bytes.Buffer
+	if err := htmlTmpl.Execute(&html, data); err != nil {
+		return msg, err
+	}
+
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.TextBody = text.String()
+	msg.HTMLBody = html.String()
+	return msg, nil
+}
+
+// SendAsync envoie le message en arrière-plan pour ne pas bloquer la requête
+// ni révéler par le temps de réponse si le destinataire existe
+func SendAsync(msg Message) {
+	go func() {
+		if err := Default.Send(msg); err != nil {
+			log.Printf("Erreur envoi email à %s: %v", msg.To, err)
+		}
+	}()
+}
+
+// buildMIME produit un message multipart/alternative conforme RFC 5322
+func buildMIME(from string, msg Message) ([]byte, error) {
+	boundaryBytes := make([]byte, 12)
+	if _, err := rand.Read(boundaryBytes); err != nil {
+		return nil, err
+	}
+	boundary := "syc-" + hex.EncodeToString(boundaryBytes)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", msg.TextBody},
+		{"text/html", msg.HTMLBody},
+	}
+
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		qp := quotedprintable.NewWriter(&buf)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
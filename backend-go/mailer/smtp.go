@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer envoie les emails via un serveur SMTP ; le port 465 utilise TLS
+// implicite, les autres passent en STARTTLS lorsque le serveur le propose
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	return &SMTPMailer{config: config}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.config.Host == "" || m.config.From == "" {
+		return errors.New("SMTP_HOST et MAIL_FROM doivent être configurés")
+	}
+
+	body, err := buildMIME(m.config.From, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.config.Host, m.config.Port)
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	if m.config.Port != "465" {
+		return smtp.SendMail(addr, auth, m.config.From, []string{msg.To}, body)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: m.config.Host})
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
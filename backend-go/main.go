@@ -2,10 +2,28 @@ package main
 
 import (
 	"backend-go/database"
+	"backend-go/encryption"
+	"backend-go/entitlements"
+	"backend-go/extractions"
 	"backend-go/handlers"
+	"backend-go/keys"
+	"backend-go/mailer"
+	"backend-go/media"
 	"backend-go/middleware"
+	"backend-go/models"
+	"backend-go/oidc"
+	"backend-go/quotas"
+	"backend-go/reconcile"
+	"backend-go/resumable"
+	"backend-go/retention"
+	"backend-go/shares"
+	"backend-go/storage"
+	"backend-go/thumbnails"
+	"backend-go/totp"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -20,16 +38,74 @@ func main() {
 	// Connexion à la base de données
 	database.Connect()
 
+	// Clés maîtres DOCUMENT_ENCRYPTION_KEYS, qui chiffrent les documents et
+	// les clés privées de signature JWT
+	encryption.Init()
+
+	// Chargement des clés de signature JWT et rotation planifiée
+	keys.Init(database.DB)
+	keys.Default.StartRotation(time.Minute)
+
+	// Envoi des emails (SMTP, fichier ou log selon MAILER)
+	mailer.Init()
+
+	// Fournisseurs Sign in with Apple / Google
+	oidc.Init(database.DB)
+
+	// Stockage des fichiers (dossier local ou S3 selon STORAGE_BACKEND)
+	storage.Init()
+
+	// Rechiffrement des clés de fichiers et des secrets TOTP après une
+	// rotation des clés maîtres
+	encryption.Start(database.DB, time.Hour)
+	totp.Start(database.DB, time.Hour)
+
+	// Tailles maximales des fichiers uploadés
+	media.Init()
+
+	// Clé de signature des liens de partage de documents
+	shares.Init()
+
+	// Génération des aperçus de documents en arrière-plan
+	thumbnails.Start(database.DB, 30*time.Second)
+
+	// Lecture des cartes grises et attestations d'assurance en arrière-plan
+	extractions.Start(database.DB, 30*time.Second)
+
+	// Purge des fichiers des documents supprimés, après la durée de rétention
+	retention.Init()
+	retention.Start(database.DB, time.Hour)
+
+	// Purge des envois reprenables (tus) expirés
+	resumable.Init()
+	resumable.Start(database.DB, time.Hour)
+
+	// Quotas de chaque abonnement (QUOTA_FREE_*, QUOTA_PREMIUM_*)
+	quotas.Init()
+
+	// Fonctionnalités débloquées par chaque prix Stripe (ENTITLEMENT_PRICES)
+	entitlements.Init()
+
+	// Réconciliation du stockage avec la base : fichiers orphelins supprimés,
+	// fichiers manquants relevés
+	reconcile.Init()
+	reconcile.Start(database.DB, 24*time.Hour)
+
 	// Initialiser Gin
 	r := gin.Default()
 
 	// Middleware CORS pour Flutter
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+		c.Header("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires")
 
 		if c.Request.Method == "OPTIONS" {
+			// Découverte du protocole tus par les clients d'envoi reprenable
+			if strings.HasPrefix(c.Request.URL.Path, "/documents/uploads") {
+				handlers.SetTusOptions(c)
+			}
 			c.AbortWithStatus(204)
 			return
 		}
@@ -40,28 +116,61 @@ func main() {
 	// Routes publiques
 	r.POST("/register", handlers.Register)
 	r.POST("/login", handlers.Login)
+	r.POST("/login/2fa", handlers.LoginTwoFactor)
+	r.POST("/auth/oidc/nonce", handlers.OIDCNonce)
+	r.POST("/auth/oidc", handlers.OIDCLogin)
 	r.POST("/register-with-vehicle", handlers.RegisterWithVehicle)
 	r.POST("/vehicles/from-plate", handlers.GetVehicleFromPlate)
 	r.POST("/forgot-password", handlers.ForgotPassword)
 	r.POST("/reset-password", handlers.ResetPassword)
+	r.POST("/auth/refresh", handlers.RefreshToken)
+	r.POST("/verify-email", handlers.VerifyEmail)
 	r.POST("/stripe-webhook", handlers.HandleStripeWebhook)
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+	r.GET("/shared/:token", handlers.GetSharedDocument)
 
 	// Routes protégées
 	protected := r.Group("/")
 	protected.Use(middleware.AuthMiddleware())
 	{
+		// Routes sessions
+		protected.POST("/logout", handlers.Logout)
+		protected.POST("/logout-all", handlers.LogoutAll)
+		protected.POST("/verify-email/resend", handlers.ResendVerificationEmail)
+
 		// Routes véhicules
 		protected.POST("/vehicles", handlers.CreateVehicle)
 		protected.GET("/vehicles", handlers.GetUserVehicles)
+		protected.GET("/usage", handlers.GetUsage)
 		protected.PUT("/vehicles/update-brand-images", handlers.UpdateVehicleBrandImages)
 		protected.PUT("/vehicles/:id", handlers.UpdateVehicle)
 		protected.DELETE("/vehicles/:id", handlers.DeleteVehicle)
 		protected.POST("/vehicles/:id/transfer", handlers.TransferVehicle)
+		protected.GET("/vehicles/:id/export", handlers.ExportVehicle)
 
 		// Routes documents
 		protected.POST("/documents", handlers.UploadDocument)
 		protected.GET("/vehicles/:vehicle_id/documents", handlers.GetVehicleDocuments)
+		protected.GET("/documents/expiring", handlers.GetExpiringDocuments)
+		protected.GET("/documents/deleted", handlers.GetDeletedDocuments)
+		protected.POST("/documents/uploads", handlers.CreateDocumentUpload)
+		protected.HEAD("/documents/uploads/:upload_id", handlers.HeadDocumentUpload)
+		protected.PATCH("/documents/uploads/:upload_id", handlers.PatchDocumentUpload)
+		protected.GET("/documents/uploads/:upload_id", handlers.GetDocumentUpload)
+		protected.DELETE("/documents/uploads/:upload_id", handlers.DeleteDocumentUpload)
 		protected.GET("/documents/:document_id/download", handlers.DownloadDocument)
+		protected.GET("/documents/:document_id/download-url", handlers.GetDocumentDownloadURL)
+		protected.GET("/documents/:document_id/thumbnail", handlers.GetDocumentThumbnail)
+		protected.GET("/documents/:document_id/extraction", middleware.RequireEntitlement(entitlements.FeatureDocumentScanner), handlers.GetDocumentExtraction)
+		protected.POST("/documents/:document_id/extraction", middleware.RequireEntitlement(entitlements.FeatureDocumentScanner), handlers.ExtractDocument)
+		protected.POST("/documents/:document_id/share", handlers.CreateDocumentShare)
+		protected.GET("/documents/:document_id/shares", handlers.GetDocumentShares)
+		protected.GET("/documents/:document_id/shares/:share_id/accesses", handlers.GetDocumentShareAccesses)
+		protected.DELETE("/documents/:document_id/shares/:share_id", handlers.RevokeDocumentShare)
+		protected.POST("/documents/:document_id/versions", handlers.AddDocumentVersion)
+		protected.GET("/documents/:document_id/versions", handlers.GetDocumentVersions)
+		protected.GET("/documents/:document_id/versions/:version/download", handlers.DownloadDocumentVersion)
+		protected.POST("/documents/:document_id/restore", handlers.RestoreDocument)
 		protected.DELETE("/documents/:document_id", handlers.DeleteDocument)
 
 		// Routes profil utilisateur
@@ -70,24 +179,53 @@ func main() {
 		protected.PUT("/api/user/password", handlers.UpdatePassword)
 		protected.POST("/api/user/profile-picture", handlers.UploadProfilePicture)
 		protected.DELETE("/api/user/delete", handlers.DeleteUser)
+		protected.POST("/api/user/2fa/enroll", handlers.EnrollTwoFactor)
+		protected.POST("/api/user/2fa/confirm", handlers.ConfirmTwoFactor)
+		protected.POST("/api/user/2fa/disable", handlers.DisableTwoFactor)
 
 		// Routes rendez-vous
 		protected.POST("/appointments", handlers.CreateAppointment)
 		protected.GET("/appointments", handlers.GetUserAppointments)
 		protected.GET("/appointments/:id", handlers.GetAppointment)
 		protected.PUT("/appointments/:id", handlers.UpdateAppointment)
-		protected.PUT("/appointments/:id/validate", handlers.ValidateAppointment)
 		protected.DELETE("/appointments/:id", handlers.DeleteAppointment)
+		protected.PUT("/appointments/:id/proposal", handlers.RespondToProposal)
+		protected.PUT("/appointments/:id/validate", middleware.RequireRole(models.RoleGarage, models.RoleAdmin), handlers.ValidateAppointment)
+
+		// Routes garages partenaires
+		garage := protected.Group("/garage")
+		garage.Use(middleware.RequireRole(models.RoleGarage, models.RoleAdmin))
+		{
+			garage.GET("", handlers.GetMyGarage)
+			garage.GET("/appointments", handlers.GetGarageAppointments)
+			garage.POST("/appointments/:id/validate", handlers.ValidateGarageAppointment)
+			garage.POST("/appointments/:id/reject", handlers.RejectGarageAppointment)
+			garage.POST("/appointments/:id/confirm", handlers.ConfirmGarageAppointment)
+			garage.POST("/appointments/:id/propose", handlers.ProposeAppointmentSlot)
+			garage.POST("/appointments/:id/complete", handlers.CompleteGarageAppointment)
+		}
+
+		// Routes administration
+		admin := protected.Group("/admin")
+		admin.Use(middleware.RequireRole(models.RoleAdmin))
+		{
+			admin.PUT("/users/:id/role", handlers.UpdateUserRole)
+			admin.POST("/garages", handlers.CreateGarage)
+			admin.POST("/garages/:id/staff", handlers.AddGarageStaff)
+			admin.DELETE("/garages/:id/staff/:user_id", handlers.RemoveGarageStaff)
+			admin.GET("/storage/missing-files", handlers.GetMissingFiles)
+		}
 
 		// Routes Stripe (abonnements)
 		protected.POST("/create-subscription", handlers.CreateSubscription)
 		protected.GET("/subscription-status", handlers.GetSubscriptionStatus)
 		protected.POST("/cancel-subscription", handlers.CancelSubscription)
 		protected.GET("/subscription-client-secret", handlers.GetSubscriptionClientSecret)
+		protected.GET("/entitlements", handlers.GetEntitlements)
 	}
 
-	// Routes statiques pour les photos de profil
-	r.Static("/uploads/profile_pictures", "./uploads/profile_pictures")
+	// Photos de profil, servies depuis le stockage
+	r.GET("/uploads/profile_pictures/:filename", handlers.ServeProfilePicture)
 
 	// Route de santé
 	r.GET("/health", func(c *gin.Context) {
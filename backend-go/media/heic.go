@@ -0,0 +1,228 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errInvalidHEIF = errors.New("structure HEIF invalide")
+
+// box est une boîte ISOBMFF : data[start:end] est son contenu, sans l'en-tête
+type box struct {
+	kind       string
+	start, end int
+}
+
+// readBoxes liste les boîtes contenues dans data[start:end]
+func readBoxes(data []byte, start, end int) ([]box, error) {
+	var boxes []box
+	for pos := start; pos < end; {
+		if pos+8 > end {
+			return nil, errInvalidHEIF
+		}
+		size := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		header := 8
+		switch size {
+		case 0:
+			size = end - pos
+		case 1:
+			if pos+16 > end {
+				return nil, errInvalidHEIF
+			}
+			large := binary.BigEndian.Uint64(data[pos+8:])
+			if large > uint64(end-pos) {
+				return nil, errInvalidHEIF
+			}
+			size = int(large)
+			header = 16
+		}
+		if size < header || pos+size > end {
+			return nil, errInvalidHEIF
+		}
+		boxes = append(boxes, box{kind: kind, start: pos + header, end: pos + size})
+		pos += size
+	}
+	return boxes, nil
+}
+
+func findBox(boxes []box, kind string) (box, bool) {
+	for _, b := range boxes {
+		if b.kind == kind {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+// heifReader lit des entiers big-endian de taille variable dans une boîte
+type heifReader struct {
+	data []byte
+	pos  int
+	end  int
+	err  error
+}
+
+func (r *heifReader) uint(size int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if size > 8 || r.pos+size > r.end {
+		r.err = errInvalidHEIF
+		return 0
+	}
+	var value uint64
+	for i := 0; i < size; i++ {
+		value = value<<8 | uint64(r.data[r.pos+i])
+	}
+	r.pos += size
+	return value
+}
+
+// blankHEICExif remplace par des zéros le contenu de l'élément Exif d'un
+// fichier HEIC. La structure du fichier et les pixels restent intacts
+func blankHEICExif(data []byte) error {
+	top, err := readBoxes(data, 0, len(data))
+	if err != nil {
+		return err
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok || meta.end-meta.start < 4 {
+		return errInvalidHEIF
+	}
+	// meta est une FullBox : 4 octets de version et flags avant les boîtes filles
+	children, err := readBoxes(data, meta.start+4, meta.end)
+	if err != nil {
+		return err
+	}
+
+	exifIDs, err := exifItemIDs(data, children)
+	if err != nil || len(exifIDs) == 0 {
+		return err
+	}
+
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return errInvalidHEIF
+	}
+	idat, hasIdat := findBox(children, "idat")
+
+	r := &heifReader{data: data, pos: iloc.start, end: iloc.end}
+	version := r.uint(1)
+	r.uint(3)
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0F)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0x0F)
+	}
+
+	idSize := 2
+	if version >= 2 {
+		idSize = 4
+	}
+	itemCount := r.uint(idSize)
+	for i := uint64(0); i < itemCount && r.err == nil; i++ {
+		itemID := r.uint(idSize)
+		constructionMethod := uint64(0)
+		if version == 1 || version == 2 {
+			constructionMethod = r.uint(2) & 0x0F
+		}
+		r.uint(2) // data_reference_index
+		baseOffset := r.uint(baseOffsetSize)
+		extentCount := r.uint(2)
+
+		for e := uint64(0); e < extentCount && r.err == nil; e++ {
+			if indexSize > 0 {
+				r.uint(indexSize)
+			}
+			offset := baseOffset + r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			if !exifIDs[itemID] || r.err != nil {
+				continue
+			}
+
+			// Méthode 0 : position dans le fichier, méthode 1 : dans la boîte idat
+			start, limit := uint64(0), uint64(len(data))
+			switch {
+			case constructionMethod == 0:
+			case constructionMethod == 1 && hasIdat:
+				start, limit = uint64(idat.start), uint64(idat.end)
+			default:
+				return errInvalidHEIF
+			}
+			if offset > limit-start {
+				return errInvalidHEIF
+			}
+			// Une longueur nulle désigne tout le reste de la source. Dans
+			// le fichier, ce serait effacer les pixels qui suivent : le
+			// fichier est refusé plutôt qu'abîmé
+			from, to := start+offset, limit
+			switch {
+			case length > 0:
+				if length > limit-from {
+					return errInvalidHEIF
+				}
+				to = from + length
+			case constructionMethod == 0:
+				return errInvalidHEIF
+			}
+			for j := from; j < to; j++ {
+				data[j] = 0
+			}
+		}
+	}
+	return r.err
+}
+
+// exifItemIDs retourne les identifiants des éléments de type Exif déclarés dans iinf
+func exifItemIDs(data []byte, metaChildren []box) (map[uint64]bool, error) {
+	iinf, ok := findBox(metaChildren, "iinf")
+	if !ok {
+		return nil, errInvalidHEIF
+	}
+
+	r := &heifReader{data: data, pos: iinf.start, end: iinf.end}
+	if r.uint(1) == 0 {
+		r.uint(3)
+		r.uint(2)
+	} else {
+		r.uint(3)
+		r.uint(4)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	entries, err := readBoxes(data, r.pos, iinf.end)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[uint64]bool{}
+	for _, entry := range entries {
+		if entry.kind != "infe" {
+			continue
+		}
+		e := &heifReader{data: data, pos: entry.start, end: entry.end}
+		version := e.uint(1)
+		e.uint(3)
+		if version < 2 {
+			continue
+		}
+		idSize := 2
+		if version >= 3 {
+			idSize = 4
+		}
+		itemID := e.uint(idSize)
+		e.uint(2) // item_protection_index
+		if e.err != nil || e.pos+4 > e.end {
+			return nil, errInvalidHEIF
+		}
+		if string(data[e.pos:e.pos+4]) == "Exif" {
+			ids[itemID] = true
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,185 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// testdata/exif.heic est le début d'une photo HEIC prise sur iPad (ftyp, meta
+// et les premiers octets de mdat, dont l'élément Exif), la taille de mdat
+// étant ramenée à celle du fichier tronqué
+func TestStripMetadataHEIC(t *testing.T) {
+	original, err := os.ReadFile("testdata/exif.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exif := bytes.Index(original, []byte("Exif\x00\x00MM"))
+	if exif < 0 || !bytes.Contains(original, []byte("iPad Pro")) {
+		t.Fatal("fixture sans bloc Exif")
+	}
+
+	stripped, err := StripMetadata(bytes.NewReader(original), HEIC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stripped) != len(original) {
+		t.Fatalf("taille %d, attendu %d", len(stripped), len(original))
+	}
+	for _, leaked := range []string{"Exif\x00\x00MM", "iPad Pro", "2017:09:27"} {
+		if bytes.Contains(stripped, []byte(leaked)) {
+			t.Errorf("%q toujours présent", leaked)
+		}
+	}
+	// Seul l'élément Exif est effacé : la structure et les données de
+	// l'image qui le suivent sont intactes
+	if !bytes.Equal(stripped[:exif-4], original[:exif-4]) {
+		t.Error("octets modifiés avant l'élément Exif")
+	}
+	tail := len(original) - 128
+	if !bytes.Equal(stripped[tail:], original[tail:]) {
+		t.Error("données d'image modifiées après l'élément Exif")
+	}
+}
+
+func TestStripMetadataHEICTruncated(t *testing.T) {
+	original, err := os.ReadFile("testdata/exif.heic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Un fichier coupé n'importe où dans ftyp ou meta est refusé, sans panique
+	for cut := 0; cut < 4000; cut++ {
+		if _, err := StripMetadata(bytes.NewReader(original[:cut]), HEIC); !errors.Is(err, ErrInvalidImage) {
+			t.Fatalf("coupé à %d octets : %v, attendu ErrInvalidImage", cut, err)
+		}
+	}
+}
+
+func heifBox(kind string, payload ...[]byte) []byte {
+	content := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(content)))
+	return append(append(out, kind...), content...)
+}
+
+// heifFullBox ajoute version et flags (nuls) avant le contenu
+func heifFullBox(kind string, version byte, payload ...[]byte) []byte {
+	return heifBox(kind, append([]byte{version, 0, 0, 0}, bytes.Join(payload, nil)...))
+}
+
+func u16(v int) []byte { return binary.BigEndian.AppendUint16(nil, uint16(v)) }
+func u32(v int) []byte { return binary.BigEndian.AppendUint32(nil, uint32(v)) }
+
+// heifExtent décrit l'unique extent d'un élément dans iloc version 1
+type heifExtent struct {
+	itemID, method, offset, length int
+}
+
+// buildHEIF construit un fichier minimal : un élément Exif (1) et une image
+// (2) déclarés dans iinf, leurs extents dans iloc et mdat. Un offset négatif
+// pour la méthode 0 est relatif au début du contenu de mdat
+func buildHEIF(extents []heifExtent, idat []byte, mdat []byte) []byte {
+	build := func(mdatStart int) []byte {
+		items := u16(len(extents))
+		for _, e := range extents {
+			offset := e.offset
+			if e.method == 0 && offset < 0 {
+				offset = mdatStart - offset - 1
+			}
+			items = append(items, bytes.Join([][]byte{u16(e.itemID), u16(e.method), u16(0), u16(1), u32(offset), u32(e.length)}, nil)...)
+		}
+		children := [][]byte{
+			heifFullBox("iinf", 0, u16(2),
+				heifFullBox("infe", 2, u16(1), u16(0), []byte("Exif\x00")),
+				heifFullBox("infe", 2, u16(2), u16(0), []byte("hvc1\x00")),
+			),
+			heifFullBox("iloc", 1, []byte{0x44, 0x00}, items),
+		}
+		if idat != nil {
+			children = append(children, heifBox("idat", idat))
+		}
+		return bytes.Join([][]byte{
+			heifBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")),
+			heifFullBox("meta", 0, children...),
+			heifBox("mdat", mdat),
+		}, nil)
+	}
+	file := build(0)
+	return build(len(file) - len(mdat))
+}
+
+func TestBlankHEICExif(t *testing.T) {
+	exifAndImage := []byte("EXIFEXIFPIXELS")
+
+	// Méthode 0 : seul l'extent de l'élément Exif est effacé dans mdat
+	data := buildHEIF([]heifExtent{{1, 0, -1, 8}, {2, 0, -9, 6}}, nil, exifAndImage)
+	if err := blankHEICExif(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(data, []byte("\x00\x00\x00\x00\x00\x00\x00\x00PIXELS")) {
+		t.Errorf("mdat = %q", data[len(data)-len(exifAndImage):])
+	}
+
+	// Méthode 1 : une longueur nulle couvre le reste de idat
+	data = buildHEIF([]heifExtent{{1, 1, 2, 0}}, []byte("..EXIF"), []byte("PIXELS"))
+	if err := blankHEICExif(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("idat..\x00\x00\x00\x00")) || !bytes.HasSuffix(data, []byte("PIXELS")) {
+		t.Errorf("idat mal effacé : %q", data)
+	}
+
+	// Sans élément Exif, le fichier n'est pas modifié
+	data = buildHEIF([]heifExtent{{2, 0, -1, 6}}, nil, []byte("PIXELS"))
+	want := append([]byte(nil), data...)
+	if err := blankHEICExif(data); err != nil || !bytes.Equal(data, want) {
+		t.Errorf("fichier sans Exif : %v", err)
+	}
+}
+
+func TestBlankHEICExifMalformed(t *testing.T) {
+	valid := buildHEIF([]heifExtent{{1, 0, -1, 4}}, nil, []byte("EXIF"))
+	if err := blankHEICExif(append([]byte(nil), valid...)); err != nil {
+		t.Fatalf("fichier valide : %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"vide", nil},
+		{"en-tête de boîte tronqué", []byte{0, 0, 0, 24, 'f', 't'}},
+		{"boîte plus grande que le fichier", valid[:len(valid)-1]},
+		{"taille inférieure à l'en-tête", append(u32(4), "ftyp"...)},
+		{"taille 64 bits hors du fichier", bytes.Join([][]byte{u32(1), []byte("mdat"), {0, 0, 0, 1, 0, 0, 0, 0}}, nil)},
+		{"sans meta", heifBox("ftyp", []byte("heic"))},
+		{"meta sans version", heifBox("meta", []byte{0, 0})},
+		{"meta sans iinf", heifFullBox("meta", 0, heifFullBox("iloc", 1))},
+		{"élément Exif sans iloc", func() []byte {
+			return heifFullBox("meta", 0, heifFullBox("iinf", 0, u16(1), heifFullBox("infe", 2, u16(1), u16(0), []byte("Exif\x00"))))
+		}()},
+		{"infe tronqué", heifFullBox("meta", 0, heifFullBox("iinf", 0, u16(1), heifFullBox("infe", 2, u16(1))))},
+		{"extent hors du fichier", buildHEIF([]heifExtent{{1, 0, -1, 5}}, nil, []byte("EXIF"))},
+		{"offset hors du fichier", buildHEIF([]heifExtent{{1, 0, 1 << 20, 4}}, nil, []byte("EXIF"))},
+		{"longueur nulle dans le fichier", buildHEIF([]heifExtent{{1, 0, -1, 0}}, nil, []byte("EXIFPIXELS"))},
+		{"méthode 1 sans idat", buildHEIF([]heifExtent{{1, 1, 0, 4}}, nil, []byte("EXIF"))},
+		{"extent hors de idat", buildHEIF([]heifExtent{{1, 1, 2, 4}}, []byte("EXIF"), nil)},
+		{"méthode 2", buildHEIF([]heifExtent{{1, 2, 0, 4}}, nil, []byte("EXIF"))},
+		{"iloc tronqué", func() []byte {
+			data := buildHEIF([]heifExtent{{1, 0, -1, 4}}, nil, []byte("EXIF"))
+			// item_count annonce un second élément absent de la boîte
+			iloc := bytes.Index(data, []byte("iloc"))
+			binary.BigEndian.PutUint16(data[iloc+10:], 2)
+			return data
+		}()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := append([]byte(nil), test.data...)
+			if err := blankHEICExif(data); !errors.Is(err, errInvalidHEIF) {
+				t.Errorf("blankHEICExif = %v, attendu errInvalidHEIF", err)
+			}
+		})
+	}
+}
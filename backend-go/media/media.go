@@ -0,0 +1,156 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Types MIME reconnus à partir du contenu des fichiers
+const (
+	PDF  = "application/pdf"
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	GIF  = "image/gif"
+	HEIC = "image/heic"
+)
+
+// ErrTooLarge est retournée quand un fichier dépasse la taille autorisée
+var ErrTooLarge = errors.New("fichier trop volumineux")
+
+// Tailles maximales des fichiers uploadés, modifiables par Init
+var (
+	MaxDocumentSize       int64 = 20 << 20
+	MaxProfilePictureSize int64 = 5 << 20
+)
+
+// Init lit les tailles maximales UPLOAD_MAX_SIZE et PROFILE_PICTURE_MAX_SIZE,
+// en octets ou avec un suffixe KB, MB ou GB ("20MB")
+func Init() {
+	for name, target := range map[string]*int64{
+		"UPLOAD_MAX_SIZE":          &MaxDocumentSize,
+		"PROFILE_PICTURE_MAX_SIZE": &MaxProfilePictureSize,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		size, err := ParseSize(value)
+		if err != nil {
+			log.Fatalf("%s invalide: %s", name, value)
+		}
+		*target = size
+	}
+}
+
+// ParseSize convertit "1048576", "512KB", "20MB" ou "1GB" en octets
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.factor
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, errors.New("taille invalide")
+	}
+	return size * multiplier, nil
+}
+
+// Detect identifie le type d'un fichier d'après ses premiers octets, ou
+// retourne "application/octet-stream" s'il n'est pas reconnu
+func Detect(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return PDF
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return GIF
+	case isHEIC(head):
+		return HEIC
+	}
+	return "application/octet-stream"
+}
+
+// isHEIC reconnaît la boîte ftyp d'un fichier HEIF avec une marque HEIC
+func isHEIC(head []byte) bool {
+	if len(head) < 16 || string(head[4:8]) != "ftyp" {
+		return false
+	}
+	boxSize := int(head[0])<<24 | int(head[1])<<16 | int(head[2])<<8 | int(head[3])
+	if boxSize < 16 || boxSize > len(head) {
+		boxSize = len(head)
+	}
+
+	// Marque principale puis marques compatibles, la version mineure est ignorée
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= boxSize; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+	for _, brand := range brands {
+		switch brand {
+		case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+			return true
+		}
+	}
+	return false
+}
+
+// Sniff détecte le type du fichier r puis le rembobine
+func Sniff(r io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return Detect(head[:n]), nil
+}
+
+// IsImage indique si le type est une image dont StripMetadata retire les métadonnées
+func IsImage(mimeType string) bool {
+	return mimeType == JPEG || mimeType == PNG || mimeType == HEIC
+}
+
+// LimitReader lit r en retournant ErrTooLarge au-delà de max octets
+func LimitReader(r io.Reader, max int64) io.Reader {
+	return &limitedReader{r: r, remaining: max}
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	// Un octet de plus que la limite pour distinguer "exactement max" de "trop grand"
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
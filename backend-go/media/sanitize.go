@@ -0,0 +1,66 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// ErrInvalidImage est retournée pour une image illisible ou trop grande à décoder
+var ErrInvalidImage = errors.New("image invalide")
+
+// maxPixels borne la taille des images décodées (protection contre les
+// fichiers compressés qui occupent des gigaoctets une fois décodés)
+const maxPixels = 50_000_000
+
+// jpegQuality est la qualité de réencodage des photos
+const jpegQuality = 90
+
+// StripMetadata retourne le contenu de r sans ses métadonnées EXIF, dont la
+// position GPS des photos prises au téléphone. Les JPEG et PNG sont réencodés
+// (l'orientation EXIF est appliquée aux pixels avant d'être perdue) ; les HEIC,
+// qu'on ne sait pas décoder, gardent leurs pixels et voient leur bloc EXIF
+// effacé sur place
+func StripMetadata(r io.Reader, mimeType string) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mimeType {
+	case JPEG:
+		return reencode(data, jpegOrientation(data), func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+		})
+	case PNG:
+		return reencode(data, 1, png.Encode)
+	case HEIC:
+		if err := blankHEICExif(data); err != nil {
+			return nil, ErrInvalidImage
+		}
+		return data, nil
+	}
+	return data, nil
+}
+
+func reencode(data []byte, orientation int, encode func(io.Writer, image.Image) error) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxPixels {
+		return nil, ErrInvalidImage
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	img = applyOrientation(img, orientation)
+
+	var out bytes.Buffer
+	if err := encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
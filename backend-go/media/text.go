@@ -0,0 +1,134 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Origine du texte retourné par ExtractText
+const (
+	TextSourcePDF = "pdf_text"
+	TextSourceOCR = "ocr"
+)
+
+// PDFTextExtractor est la commande de poppler-utils qui lit la couche texte d'un PDF
+var PDFTextExtractor = "pdftotext"
+
+// OCREngine est le moteur d'OCR local utilisé pour les photos et les PDF scannés
+var OCREngine = "tesseract"
+
+// OCRLanguages sont les langues passées au moteur d'OCR
+var OCRLanguages = "fra"
+
+// ocrPageSize est le plus grand côté d'une page de PDF rendue pour l'OCR,
+// environ 200 dpi pour un A4
+const ocrPageSize = 1200
+
+// textTimeout borne la lecture d'un document malveillant ou très lourd
+const textTimeout = 60 * time.Second
+
+// minPDFTextLength sépare un PDF avec une vraie couche texte d'un scan qui
+// n'en a pas (ou seulement quelques caractères parasites)
+const minPDFTextLength = 20
+
+// ExtractText retourne le texte d'un document : la couche texte des PDF, ou
+// l'OCR de l'image (de la première page pour un PDF scanné). Retourne
+// ErrUnsupported si le format ou les outils nécessaires manquent
+func ExtractText(data []byte) (text string, source string, err error) {
+	var img image.Image
+
+	switch Detect(data) {
+	case PDF:
+		text, err = pdfText(data)
+		if err != nil && err != ErrUnsupported {
+			return "", "", err
+		}
+		if len(strings.TrimSpace(text)) >= minPDFTextLength {
+			return text, TextSourcePDF, nil
+		}
+		img, err = renderPDFPage(data, ocrPageSize)
+	case JPEG, PNG, GIF:
+		img, err = decodeImage(data)
+	default:
+		return "", "", ErrUnsupported
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	text, err = ocr(img)
+	if err != nil {
+		return "", "", err
+	}
+	return text, TextSourceOCR, nil
+}
+
+// pdfText lit la couche texte des deux premières pages en conservant la mise
+// en page, chaque champ restant sur la ligne de son libellé
+func pdfText(data []byte) (string, error) {
+	extractor, err := exec.LookPath(PDFTextExtractor)
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	dir, err := os.MkdirTemp("", "pdf-text-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return "", err
+	}
+
+	return runTextCommand(extractor, "-layout", "-enc", "UTF-8", "-f", "1", "-l", "2", input, "-")
+}
+
+// ocr passe l'image au moteur d'OCR, absent en développement : les images
+// n'ont alors pas de texte
+func ocr(img image.Image) (string, error) {
+	engine, err := exec.LookPath(OCREngine)
+	if err != nil {
+		return "", ErrUnsupported
+	}
+
+	dir, err := os.MkdirTemp("", "ocr-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	input := filepath.Join(dir, "page.png")
+	if err := os.WriteFile(input, buf.Bytes(), 0600); err != nil {
+		return "", err
+	}
+
+	return runTextCommand(engine, input, "stdout", "-l", OCRLanguages)
+}
+
+func runTextCommand(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), textTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v: %s", filepath.Base(name), err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,166 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrUnsupported est retournée pour un format dont on ne sait pas faire
+// d'aperçu ou lire le texte, ou quand l'outil nécessaire n'est pas installé
+var ErrUnsupported = errors.New("format non supporté")
+
+// ThumbnailSize est le plus grand côté des aperçus de documents, en pixels
+const ThumbnailSize = 320
+
+// ProfilePictureSizes sont les tailles des variantes des photos de profil
+var ProfilePictureSizes = []int{64, 256}
+
+// PDFRenderer est la commande de poppler-utils qui rend la première page d'un PDF
+var PDFRenderer = "pdftoppm"
+
+// pdfRenderTimeout borne le rendu d'un PDF malveillant ou très lourd
+const pdfRenderTimeout = 30 * time.Second
+
+const thumbnailQuality = 80
+
+// Thumbnail retourne un aperçu JPEG de data dont le plus grand côté mesure au
+// plus maxSide pixels : l'image elle-même, ou la première page d'un PDF
+func Thumbnail(data []byte, maxSide int) ([]byte, error) {
+	var img image.Image
+	var err error
+
+	switch Detect(data) {
+	case JPEG, PNG, GIF:
+		img, err = decodeImage(data)
+	case PDF:
+		img, err = renderPDFPage(data, maxSide)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, Resize(img, maxSide), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func decodeImage(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxPixels {
+		return nil, ErrInvalidImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	// Les photos envoyées avant le nettoyage des EXIF peuvent encore être tournées
+	if Detect(data) == JPEG {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// renderPDFPage rend la première page avec pdftoppm, absent en développement :
+// les PDF n'ont alors pas d'aperçu
+func renderPDFPage(data []byte, maxSide int) (image.Image, error) {
+	renderer, err := exec.LookPath(PDFRenderer)
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	dir, err := os.MkdirTemp("", "pdf-thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(input, data, 0600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pdfRenderTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, renderer,
+		"-jpeg", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", strconv.Itoa(maxSide*2),
+		input, filepath.Join(dir, "page"),
+	).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", PDFRenderer, err, bytes.TrimSpace(output))
+	}
+
+	page, err := os.ReadFile(filepath.Join(dir, "page.jpg"))
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(page)
+}
+
+// Resize réduit img pour que son plus grand côté mesure au plus maxSide, en
+// moyennant les pixels sources de chaque pixel cible. La transparence est
+// remplacée par du blanc, les aperçus étant en JPEG
+func Resize(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	src := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+
+	if srcW <= maxSide && srcH <= maxSide {
+		return src
+	}
+
+	dstW, dstH := maxSide, srcH*maxSide/srcW
+	if srcH > srcW {
+		dstW, dstH = srcW*maxSide/srcH, maxSide
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for dy := 0; dy < dstH; dy++ {
+		y0, y1 := dy*srcH/dstH, (dy+1)*srcH/dstH
+		for dx := 0; dx < dstW; dx++ {
+			x0, x1 := dx*srcW/dstW, (dx+1)*srcW/dstW
+
+			var r, g, b, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					r += int(row[x*4])
+					g += int(row[x*4+1])
+					b += int(row[x*4+2])
+					n++
+				}
+			}
+			i := dy*dst.Stride + dx*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 0xFF
+		}
+	}
+	return dst
+}
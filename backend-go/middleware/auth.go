@@ -1,8 +1,9 @@
 package middleware
 
 import (
+	"backend-go/database"
+	"backend-go/keys"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -20,9 +21,8 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		// La clé est choisie d'après le kid et l'algorithme doit correspondre à celui de la clé
+		token, err := keys.Default.Parse(tokenString)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Token invalide"})
@@ -37,11 +37,35 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		userID := int(claims["user_id"].(float64))
-		email := claims["email"].(string)
+		rawUserID, okUser := claims["user_id"].(float64)
+		email, okEmail := claims["email"].(string)
+		rawSessionID, okSession := claims["sid"].(float64)
+		role, okRole := claims["role"].(string)
+		if !okUser || !okEmail || !okSession || !okRole {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Claims invalides"})
+			c.Abort()
+			return
+		}
+
+		userID := int(rawUserID)
+		sessionID := int(rawSessionID)
+
+		// Vérifier que la session n'a pas été révoquée (déconnexion, changement de mot de passe)
+		var active bool
+		err = database.DB.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP)",
+			sessionID, userID,
+		).Scan(&active)
+		if err != nil || !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Session expirée ou révoquée"})
+			c.Abort()
+			return
+		}
 
 		c.Set("user_id", userID)
 		c.Set("email", email)
+		c.Set("session_id", sessionID)
+		c.Set("role", role)
 		c.Next()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"backend-go/database"
+	"backend-go/entitlements"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireEntitlement n'autorise que les utilisateurs dont l'abonnement débloque
+// la fonctionnalité ; répond 402 sinon. Doit être placé après AuthMiddleware
+func RequireEntitlement(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt("user_id")
+		entitled, err := entitlements.Has(c.Request.Context(), database.DB, userID, feature)
+		if err != nil {
+			fmt.Printf("Erreur lecture des droits: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Erreur vérification abonnement"})
+			c.Abort()
+			return
+		}
+		if !entitled {
+			c.JSON(http.StatusPaymentRequired, gin.H{
+				"message": "Abonnement requis pour cette fonctionnalité",
+				"code":    "entitlement_required",
+				"feature": feature,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole n'autorise que les utilisateurs ayant l'un des rôles indiqués.
+// Doit être placé après AuthMiddleware, qui lit le rôle dans le jeton
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"message": "Accès refusé"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS subscriptions;
+DROP TABLE IF EXISTS appointments;
+DROP TABLE IF EXISTS documents;
+DROP TABLE IF EXISTS vehicles;
+DROP TABLE IF EXISTS users;
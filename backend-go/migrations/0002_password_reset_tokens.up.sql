@@ -1,4 +1,4 @@
--- Migration pour ajouter la table des tokens de réinitialisation de mot de passe
+-- Tokens de réinitialisation de mot de passe
 CREATE TABLE IF NOT EXISTS password_reset_tokens (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
@@ -11,4 +11,4 @@ CREATE TABLE IF NOT EXISTS password_reset_tokens (
 -- Index pour améliorer les performances
 CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_token ON password_reset_tokens(token);
 CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
-CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
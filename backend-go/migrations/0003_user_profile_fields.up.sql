@@ -0,0 +1,28 @@
+-- Champs de profil utilisateur : les colonnes sont créées par le schéma initial,
+-- on remplit prénom et nom à partir de full_name pour les comptes existants
+UPDATE users
+SET
+    first_name = SPLIT_PART(full_name, ' ', 1),
+    last_name = CASE
+        WHEN ARRAY_LENGTH(STRING_TO_ARRAY(full_name, ' '), 1) > 1
+        THEN SUBSTRING(full_name FROM LENGTH(SPLIT_PART(full_name, ' ', 1)) + 2)
+        ELSE NULL
+    END
+WHERE first_name IS NULL AND full_name IS NOT NULL AND full_name != '';
+
+-- Index sur l'email et le téléphone pour les recherches
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_users_phone ON users(phone);
+
+-- Format de l'email, vérifié pour les nouvelles lignes uniquement (NOT VALID)
+-- afin de ne pas bloquer la migration sur des comptes anciens. La contrainte
+-- sur le format du téléphone n'est pas reprise : l'API accepte les numéros
+-- étrangers
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'check_email_format') THEN
+        ALTER TABLE users
+        ADD CONSTRAINT check_email_format
+        CHECK (email ~* '^[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}$') NOT VALID;
+    END IF;
+END $$;
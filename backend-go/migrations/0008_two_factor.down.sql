@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS totp_recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS totp_last_step,
+DROP COLUMN IF EXISTS totp_pending_secret,
+DROP COLUMN IF EXISTS totp_secret,
+DROP COLUMN IF EXISTS totp_enabled;
@@ -0,0 +1,4 @@
+-- Rôle des comptes (user, garage, admin)
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'garage', 'admin'));
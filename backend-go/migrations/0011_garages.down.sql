@@ -0,0 +1,8 @@
+ALTER TABLE appointments
+DROP COLUMN IF EXISTS garage_note,
+DROP COLUMN IF EXISTS proposed_time,
+DROP COLUMN IF EXISTS proposed_date;
+
+ALTER TABLE users DROP COLUMN IF EXISTS garage_id;
+
+DROP TABLE IF EXISTS garages;
@@ -0,0 +1,22 @@
+-- Garages partenaires et rattachement du personnel
+CREATE TABLE IF NOT EXISTS garages (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    external_id VARCHAR(255) UNIQUE NOT NULL,
+    address TEXT,
+    city VARCHAR(100),
+    postal_code VARCHAR(20),
+    phone VARCHAR(20),
+    email VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS garage_id INTEGER REFERENCES garages(id) ON DELETE SET NULL;
+
+-- Créneau proposé par le garage au client
+ALTER TABLE appointments
+ADD COLUMN IF NOT EXISTS proposed_date TIMESTAMP,
+ADD COLUMN IF NOT EXISTS proposed_time VARCHAR(10),
+ADD COLUMN IF NOT EXISTS garage_note TEXT;
@@ -0,0 +1,7 @@
+UPDATE documents
+SET file_path = 'uploads/' || file_path
+WHERE file_path NOT LIKE 'uploads/%';
+
+UPDATE users
+SET profile_picture = 'uploads/' || profile_picture
+WHERE profile_picture IS NOT NULL AND profile_picture <> '' AND profile_picture NOT LIKE 'uploads/%';
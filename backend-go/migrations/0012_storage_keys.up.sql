@@ -0,0 +1,9 @@
+-- Les fichiers sont désormais référencés par leur clé dans le stockage
+-- ("documents/x.pdf") et non plus par leur chemin sur le disque du serveur
+UPDATE documents
+SET file_path = substring(file_path FROM 9)
+WHERE file_path LIKE 'uploads/%';
+
+UPDATE users
+SET profile_picture = substring(profile_picture FROM 9)
+WHERE profile_picture LIKE 'uploads/%';
@@ -0,0 +1,3 @@
+-- Empreinte SHA-256 du contenu, calculée à l'upload ; les fichiers sont
+-- désormais stockés sous une clé aléatoire
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS file_sha256 VARCHAR(64);
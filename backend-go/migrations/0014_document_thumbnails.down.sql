@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_documents_thumbnail_pending;
+
+ALTER TABLE documents
+DROP COLUMN IF EXISTS thumbnail_updated_at,
+DROP COLUMN IF EXISTS thumbnail_attempts,
+DROP COLUMN IF EXISTS thumbnail_status,
+DROP COLUMN IF EXISTS thumbnail_key;
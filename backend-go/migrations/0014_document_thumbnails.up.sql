@@ -0,0 +1,10 @@
+-- Aperçus des documents, générés en arrière-plan par le worker de thumbnails.
+-- Les documents existants sont en attente et seront traités au démarrage
+ALTER TABLE documents
+ADD COLUMN IF NOT EXISTS thumbnail_key TEXT,
+ADD COLUMN IF NOT EXISTS thumbnail_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+ADD COLUMN IF NOT EXISTS thumbnail_attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN IF NOT EXISTS thumbnail_updated_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_documents_thumbnail_pending
+ON documents(id) WHERE thumbnail_status IN ('pending', 'processing');
@@ -0,0 +1,8 @@
+-- Dates de validité des documents (attestation d'assurance, contrôle technique...).
+-- Les deux dates sont facultatives : les documents existants n'en ont pas
+ALTER TABLE documents
+ADD COLUMN IF NOT EXISTS issued_at DATE,
+ADD COLUMN IF NOT EXISTS expires_at DATE;
+
+CREATE INDEX IF NOT EXISTS idx_documents_expires_at
+ON documents(user_id, expires_at) WHERE expires_at IS NOT NULL;
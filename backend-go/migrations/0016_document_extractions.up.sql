@@ -0,0 +1,24 @@
+-- Champs lus sur les cartes grises et attestations d'assurance (couche texte
+-- des PDF ou OCR des photos), proposés à l'utilisateur pour remplir son véhicule.
+-- Les documents existants sont mis en attente et seront lus au démarrage
+CREATE TABLE IF NOT EXISTS document_extractions (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL UNIQUE REFERENCES documents(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    source VARCHAR(20),
+    fields JSONB NOT NULL DEFAULT '{}',
+    suggested_vehicle JSONB,
+    suggested_document JSONB,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_extractions_pending
+ON document_extractions(id) WHERE status IN ('pending', 'processing');
+
+INSERT INTO document_extractions (document_id, user_id)
+SELECT id, user_id FROM documents
+WHERE type IN ('carte_grise', 'assurance') AND user_id IS NOT NULL
+ON CONFLICT (document_id) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS document_share_accesses;
+DROP TABLE IF EXISTS document_shares;
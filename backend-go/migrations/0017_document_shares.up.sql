@@ -0,0 +1,29 @@
+-- Liens publics de partage d'un document (assurance envoyée à un garage, à un
+-- acheteur...). Le jeton signé n'est pas stocké, seulement son identifiant
+CREATE TABLE IF NOT EXISTS document_shares (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_id VARCHAR(64) NOT NULL UNIQUE,
+    label VARCHAR(255),
+    single_use BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMP NOT NULL,
+    first_used_at TIMESTAMP,
+    first_used_ip VARCHAR(64),
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_shares_document_id ON document_shares(document_id);
+
+-- Chaque accès public, accepté ou refusé, visible par le propriétaire
+CREATE TABLE IF NOT EXISTS document_share_accesses (
+    id SERIAL PRIMARY KEY,
+    share_id INTEGER NOT NULL REFERENCES document_shares(id) ON DELETE CASCADE,
+    outcome VARCHAR(20) NOT NULL,
+    ip_address VARCHAR(64),
+    user_agent TEXT,
+    accessed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_share_accesses_share_id ON document_share_accesses(share_id, accessed_at);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_documents_deleted_at;
+DROP TABLE IF EXISTS document_versions;
+
+ALTER TABLE documents
+DROP COLUMN IF EXISTS deleted_at,
+DROP COLUMN IF EXISTS current_version;
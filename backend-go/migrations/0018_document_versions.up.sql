@@ -0,0 +1,32 @@
+-- Versions successives d'un document. La ligne documents décrit la version
+-- courante ; document_versions les conserve toutes, courante comprise.
+-- La suppression devient logique (deleted_at) : les fichiers sont purgés
+-- après la durée de rétention
+ALTER TABLE documents
+ADD COLUMN IF NOT EXISTS current_version INTEGER NOT NULL DEFAULT 1,
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS document_versions (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    file_path TEXT NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    file_size BIGINT NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    file_sha256 VARCHAR(64),
+    issued_at DATE,
+    expires_at DATE,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (document_id, version)
+);
+
+-- Les documents existants deviennent leur version 1
+INSERT INTO document_versions (document_id, version, file_path, file_name, file_size, mime_type, file_sha256, issued_at, expires_at, uploaded_by, created_at)
+SELECT id, 1, file_path, file_name, file_size, mime_type, file_sha256, issued_at, expires_at, user_id, created_at
+FROM documents
+ON CONFLICT (document_id, version) DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_documents_deleted_at
+ON documents(deleted_at) WHERE deleted_at IS NOT NULL;
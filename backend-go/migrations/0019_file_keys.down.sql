@@ -0,0 +1,3 @@
+-- Les fichiers chiffrés deviennent illisibles : à ne lancer qu'après les
+-- avoir déchiffrés ou supprimés
+DROP TABLE IF EXISTS file_keys;
@@ -0,0 +1,11 @@
+-- Clés de données des fichiers chiffrés (documents, aperçus), enveloppées par
+-- une clé maître identifiée par key_id. Un fichier sans ligne est en clair
+CREATE TABLE IF NOT EXISTS file_keys (
+    storage_key TEXT PRIMARY KEY,
+    key_id VARCHAR(64) NOT NULL,
+    wrapped_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    rewrapped_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_keys_key_id ON file_keys(key_id);
@@ -0,0 +1,4 @@
+-- Les morceaux des envois en cours restent dans le stockage, repris par
+-- sycadmin reconcile-storage
+DROP TABLE IF EXISTS document_upload_parts;
+DROP TABLE IF EXISTS document_uploads;
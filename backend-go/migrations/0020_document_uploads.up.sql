@@ -0,0 +1,36 @@
+-- Envois de documents reprenables (protocole tus 1.0). Les métadonnées du
+-- document sont reçues à la création de l'envoi, le document n'est créé
+-- qu'une fois le fichier complet
+CREATE TABLE IF NOT EXISTS document_uploads (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    description TEXT,
+    file_name VARCHAR(255) NOT NULL,
+    issued_at DATE,
+    expires_at DATE,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    -- uploading, processing, completed ou failed
+    status VARCHAR(20) NOT NULL DEFAULT 'uploading',
+    document_id INTEGER REFERENCES documents(id) ON DELETE SET NULL,
+    upload_expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_uploads_user_id ON document_uploads(user_id);
+CREATE INDEX IF NOT EXISTS idx_document_uploads_expires_at ON document_uploads(upload_expires_at);
+
+-- Morceaux reçus d'un envoi, un fichier du stockage par requête PATCH,
+-- assemblés dans l'ordre des positions à la fin de l'envoi
+CREATE TABLE IF NOT EXISTS document_upload_parts (
+    upload_id VARCHAR(64) NOT NULL REFERENCES document_uploads(id) ON DELETE CASCADE,
+    upload_offset BIGINT NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (upload_id, upload_offset)
+);
@@ -0,0 +1,10 @@
+-- Lignes dont le fichier est introuvable dans le stockage, relevées par la
+-- réconciliation du stockage. source est la table de la ligne (documents,
+-- document_versions, users) ; la ligne disparaît quand le fichier est retrouvé
+CREATE TABLE IF NOT EXISTS missing_files (
+    source VARCHAR(30) NOT NULL,
+    record_id INTEGER NOT NULL,
+    storage_key TEXT NOT NULL,
+    detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (source, record_id, storage_key)
+);
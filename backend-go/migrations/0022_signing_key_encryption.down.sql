@@ -0,0 +1,4 @@
+-- Les clés chiffrées ne sont pas lisibles sans la colonne : elles sont
+-- supprimées et le serveur génère une nouvelle clé au démarrage
+DELETE FROM signing_keys WHERE master_key_id IS NOT NULL;
+ALTER TABLE signing_keys DROP COLUMN IF EXISTS master_key_id;
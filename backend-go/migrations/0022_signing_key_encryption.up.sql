@@ -0,0 +1,3 @@
+-- Clé maître qui chiffre la clé privée (private_key en base64) ; NULL pour une
+-- clé stockée en PEM clair, sans DOCUMENT_ENCRYPTION_KEYS
+ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS master_key_id VARCHAR(64);
@@ -0,0 +1,9 @@
+-- Nonces émis par le serveur pour la connexion Apple / Google (POST
+-- /auth/oidc/nonce), supprimés à leur première utilisation
+CREATE TABLE IF NOT EXISTS oidc_nonces (
+    nonce VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_nonces_expires_at ON oidc_nonces(expires_at);
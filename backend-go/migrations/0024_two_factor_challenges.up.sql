@@ -0,0 +1,12 @@
+-- Challenges de double authentification émis après le mot de passe (ou
+-- l'ID token) : attempts compte les codes essayés, la ligne est supprimée à la
+-- connexion ou après le dernier essai autorisé
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_two_factor_challenges_expires_at ON two_factor_challenges(expires_at);
@@ -0,0 +1,10 @@
+-- Les secrets chiffrés ne sont pas lisibles sans les colonnes : la double
+-- authentification des comptes concernés est désactivée et doit être réactivée
+DELETE FROM totp_recovery_codes WHERE user_id IN (SELECT id FROM users WHERE totp_secret_key_id IS NOT NULL);
+UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = 0 WHERE totp_secret_key_id IS NOT NULL;
+UPDATE users SET totp_pending_secret = NULL WHERE totp_pending_secret_key_id IS NOT NULL;
+ALTER TABLE users
+DROP COLUMN IF EXISTS totp_secret_key_id,
+DROP COLUMN IF EXISTS totp_pending_secret_key_id,
+ALTER COLUMN totp_secret TYPE VARCHAR(64),
+ALTER COLUMN totp_pending_secret TYPE VARCHAR(64);
@@ -0,0 +1,8 @@
+-- Les secrets TOTP sont chiffrés avec la clé maître active (base64, plus long
+-- que le secret en clair). Clé maître de chaque secret ; NULL pour un secret
+-- stocké en clair, sans DOCUMENT_ENCRYPTION_KEYS
+ALTER TABLE users
+ALTER COLUMN totp_secret TYPE TEXT,
+ALTER COLUMN totp_pending_secret TYPE TEXT,
+ADD COLUMN IF NOT EXISTS totp_secret_key_id VARCHAR(64),
+ADD COLUMN IF NOT EXISTS totp_pending_secret_key_id VARCHAR(64);
@@ -0,0 +1,327 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Les scripts sont embarqués dans le binaire : NNNN_nom.up.sql applique la
+// migration, NNNN_nom.down.sql l'annule
+//
+//go:embed *.sql
+var files embed.FS
+
+// Identifiant du verrou consultatif qui empêche deux répliques de migrer en même temps
+const advisoryLockID = 72150412
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration est une version du schéma avec ses scripts
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// State indique si une migration a été appliquée et quand
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load lit les migrations embarquées, triées par version
+func Load() ([]Migration, error) {
+	return load(files)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("nom de migration invalide: %s", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("version %d utilisée par deux migrations (%s, %s)", version, migration.Name, match[2])
+		}
+
+		// "1_init.up.sql" et "0001_init.up.sql" désignent la même version
+		if match[3] == "up" && migration.Checksum != "" || match[3] == "down" && migration.Down != "" {
+			return nil, fmt.Errorf("script %s en double pour la migration %d_%s", match[3], version, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("script up manquant pour la migration %d_%s", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applique les migrations en attente, chacune dans sa transaction, et
+// retourne le nombre de migrations appliquées. Échoue si une migration déjà
+// appliquée a été modifiée depuis
+func Up(db *sql.DB) (int, error) {
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		checksums, err := appliedChecksums(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if err := verifyApplied(migrations, checksums); err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := checksums[migration.Version]; ok {
+				continue
+			}
+
+			log.Printf("Migration %d_%s...", migration.Version, migration.Name)
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					"INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+					migration.Version, migration.Name, migration.Checksum,
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// verifyApplied échoue si une migration appliquée, d'après checksums, a été
+// modifiée depuis ; une version appliquée inconnue de ce binaire est signalée
+func verifyApplied(migrations []Migration, checksums map[int64]string) error {
+	known := map[int64]bool{}
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		checksum, ok := checksums[migration.Version]
+		if ok && checksum != migration.Checksum {
+			return fmt.Errorf("la migration %d_%s a été modifiée après son application (checksum différent)", migration.Version, migration.Name)
+		}
+	}
+	for version := range checksums {
+		if !known[version] {
+			log.Printf("Attention: migration %d appliquée en base mais inconnue de ce binaire", version)
+		}
+	}
+	return nil
+}
+
+// Down annule les steps dernières migrations appliquées, de la plus récente à
+// la plus ancienne, et retourne le nombre de migrations annulées
+func Down(db *sql.DB, steps int) (int, error) {
+	migrations, err := Load()
+	if err != nil {
+		return 0, err
+	}
+
+	byVersion := map[int64]Migration{}
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	reverted := 0
+	err = withLock(db, func(ctx context.Context, conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations ORDER BY version DESC LIMIT $1", steps)
+		if err != nil {
+			return err
+		}
+		var versions []int64
+		for rows.Next() {
+			var version int64
+			if err := rows.Scan(&version); err != nil {
+				rows.Close()
+				return err
+			}
+			versions = append(versions, version)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, version := range versions {
+			migration, ok := byVersion[version]
+			if !ok || migration.Down == "" {
+				return fmt.Errorf("aucun script down pour la migration %d", version)
+			}
+
+			log.Printf("Annulation de la migration %d_%s...", migration.Version, migration.Name)
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("annulation %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status retourne l'état de chaque migration embarquée
+func Status(db *sql.DB) ([]State, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(createTableSQL); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(migrations))
+	for _, migration := range migrations {
+		state := State{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+const createTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	checksum VARCHAR(64) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// withLock exécute fn sur une connexion dédiée qui détient le verrou
+// consultatif : les autres répliques attendent la fin de la migration
+func withLock(db *sql.DB, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockID); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryLockID); err != nil {
+			log.Printf("Erreur libération du verrou de migration: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createTableSQL); err != nil {
+		return err
+	}
+	return fn(ctx, conn)
+}
+
+func appliedChecksums(ctx context.Context, conn *sql.Conn) (map[int64]string, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := map[int64]string{}
+	for rows.Next() {
+		var version int64
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+		checksums[version] = checksum
+	}
+	return checksums, rows.Err()
+}
+
+func inTransaction(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
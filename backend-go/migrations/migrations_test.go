@@ -0,0 +1,172 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func mapFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return fsys
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := load(mapFS(map[string]string{
+		// Triés par nom, "10_..." précède "9_..." : l'ordre est celui des versions
+		"0010_ajout_index.up.sql":   "CREATE INDEX i ON t (c);",
+		"0010_ajout_index.down.sql": "DROP INDEX i;",
+		"9_sans_zeros.up.sql":       "ALTER TABLE t ADD COLUMN c INT;",
+		"0001_initial.up.sql":       "CREATE TABLE t (id INT);",
+		"0001_initial.down.sql":     "DROP TABLE t;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		version  int64
+		name     string
+		up, down string
+	}{
+		{1, "initial", "CREATE TABLE t (id INT);", "DROP TABLE t;"},
+		{9, "sans_zeros", "ALTER TABLE t ADD COLUMN c INT;", ""},
+		{10, "ajout_index", "CREATE INDEX i ON t (c);", "DROP INDEX i;"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("%d migrations, attendu %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		m := migrations[i]
+		if m.Version != w.version || m.Name != w.name || m.Up != w.up || m.Down != w.down {
+			t.Errorf("migration %d = %+v, attendu %+v", i, m, w)
+		}
+		// Seul le script up est couvert par le checksum
+		sum := sha256.Sum256([]byte(w.up))
+		if m.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("migration %d : checksum %s", m.Version, m.Checksum)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "nom sans version",
+			files: map[string]string{"initial.up.sql": "SELECT 1;"},
+			want:  "nom de migration invalide: initial.up.sql",
+		},
+		{
+			name:  "majuscules",
+			files: map[string]string{"0001_Initial.up.sql": "SELECT 1;"},
+			want:  "nom de migration invalide",
+		},
+		{
+			name:  "sens inconnu",
+			files: map[string]string{"0001_initial.sql": "SELECT 1;"},
+			want:  "nom de migration invalide",
+		},
+		{
+			name:  "fichier étranger",
+			files: map[string]string{"0001_initial.up.sql": "SELECT 1;", "README.md": ""},
+			want:  "nom de migration invalide: README.md",
+		},
+		{
+			name:  "script up manquant",
+			files: map[string]string{"0001_initial.up.sql": "SELECT 1;", "0002_index.down.sql": "DROP INDEX i;"},
+			want:  "script up manquant pour la migration 2_index",
+		},
+		{
+			name:  "script up vide",
+			files: map[string]string{"0001_initial.up.sql": "", "0001_initial.down.sql": "SELECT 1;"},
+			want:  "script up manquant pour la migration 1_initial",
+		},
+		{
+			name:  "version partagée",
+			files: map[string]string{"0002_index.up.sql": "SELECT 1;", "0002_colonne.up.sql": "SELECT 2;"},
+			want:  "version 2 utilisée par deux migrations",
+		},
+		{
+			name:  "même version écrite deux fois",
+			files: map[string]string{"0002_index.up.sql": "SELECT 1;", "2_index.up.sql": "SELECT 2;"},
+			want:  "script up en double pour la migration 2_index",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := load(mapFS(test.files))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("load = %v, attendu %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyApplied(t *testing.T) {
+	migrations, err := load(mapFS(map[string]string{
+		"0001_initial.up.sql":   "CREATE TABLE t (id INT);",
+		"0001_initial.down.sql": "DROP TABLE t;",
+		"0002_index.up.sql":     "CREATE INDEX i ON t (id);",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := map[int64]string{1: migrations[0].Checksum}
+
+	// Migration en attente, ou appliquée par un binaire plus récent
+	if err := verifyApplied(migrations, applied); err != nil {
+		t.Errorf("verifyApplied = %v", err)
+	}
+	if err := verifyApplied(migrations, map[int64]string{1: migrations[0].Checksum, 3: "inconnue"}); err != nil {
+		t.Errorf("version inconnue : %v", err)
+	}
+
+	// Le script down peut changer ; le script up appliqué, non
+	edited, err := load(mapFS(map[string]string{
+		"0001_initial.up.sql":   "CREATE TABLE t (id BIGINT);",
+		"0001_initial.down.sql": "DROP TABLE IF EXISTS t;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = verifyApplied(edited, applied)
+	if err == nil || !strings.Contains(err.Error(), "la migration 1_initial a été modifiée après son application") {
+		t.Errorf("script up modifié : %v", err)
+	}
+	downEdited, err := load(mapFS(map[string]string{
+		"0001_initial.up.sql":   "CREATE TABLE t (id INT);",
+		"0001_initial.down.sql": "DROP TABLE IF EXISTS t;",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyApplied(downEdited, applied); err != nil {
+		t.Errorf("script down modifié : %v", err)
+	}
+}
+
+// Les migrations embarquées se chargent, sans trou dans les versions, et
+// chacune peut être annulée
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s à la position %d", migration.Version, migration.Name, i+1)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %d_%s sans script down", migration.Version, migration.Name)
+		}
+	}
+}
@@ -48,6 +48,10 @@ type AppointmentResponse struct {
 	Service     string             `json:"service"`
 	Description string             `json:"description"`
 	Status      string             `json:"status"`
+	// Créneau proposé par le garage, en attente de réponse du client
+	ProposedDate *time.Time        `json:"proposed_date,omitempty"`
+	ProposedTime *string           `json:"proposed_time,omitempty"`
+	GarageNote  *string            `json:"garage_note,omitempty"`
 	CreatedAt   time.Time          `json:"created_at"`
 }
 
@@ -55,6 +59,7 @@ type AppointmentResponse struct {
 const (
 	AppointmentStatusPending   = "pending"   // En attente de validation
 	AppointmentStatusValidated = "validated" // Validé par le garage
+	AppointmentStatusProposed  = "proposed"  // Nouveau créneau proposé par le garage
 	AppointmentStatusConfirmed = "confirmed" // Confirmé (rdv fixé)
 	AppointmentStatusCompleted = "completed" // Terminé
 	AppointmentStatusCancelled = "cancelled" // Annulé
@@ -68,6 +73,8 @@ func GetStatusDisplayName(status string) string {
 		return "En attente"
 	case AppointmentStatusValidated:
 		return "Validé"
+	case AppointmentStatusProposed:
+		return "Nouveau créneau proposé"
 	case AppointmentStatusConfirmed:
 		return "Confirmé"
 	case AppointmentStatusCompleted:
@@ -84,7 +91,7 @@ func GetStatusDisplayName(status string) string {
 // IsValidStatus vérifie si un statut est valide
 func IsValidStatus(status string) bool {
 	switch status {
-	case AppointmentStatusPending, AppointmentStatusValidated, AppointmentStatusConfirmed,
+	case AppointmentStatusPending, AppointmentStatusValidated, AppointmentStatusProposed, AppointmentStatusConfirmed,
 		 AppointmentStatusCompleted, AppointmentStatusCancelled, AppointmentStatusRejected:
 		return true
 	default:
@@ -1,39 +1,126 @@
 package models
 
 import (
+	"errors"
 	"time"
 )
 
 type Document struct {
-	ID          int       `json:"id"`
-	VehicleID   int       `json:"vehicle_id"`
-	UserID      int       `json:"user_id"`
-	Name        string    `json:"name"`
-	Type        string    `json:"type"` // "carte_grise", "assurance", "controle_technique", "facture", "autre"
-	Description *string   `json:"description"`
-	FilePath    string    `json:"file_path"`
-	FileName    string    `json:"file_name"`
-	FileSize    int64     `json:"file_size"`
-	MimeType    string    `json:"mime_type"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	VehicleID   int        `json:"vehicle_id"`
+	UserID      int        `json:"user_id"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"` // "carte_grise", "assurance", "controle_technique", "facture", "autre"
+	Description *string    `json:"description"`
+	FilePath    string     `json:"file_path"`
+	FileName    string     `json:"file_name"`
+	FileSize    int64      `json:"file_size"`
+	MimeType    string     `json:"mime_type"`
+	FileSHA256  *string    `json:"file_sha256"`
+	IssuedAt    *time.Time `json:"issued_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// DocumentAllowedMimeTypes liste, pour chaque type de document, les formats
+// de fichier acceptés (détectés d'après le contenu, pas d'après le client)
+var DocumentAllowedMimeTypes = map[string][]string{
+	"carte_grise":        {"application/pdf", "image/jpeg", "image/png", "image/heic"},
+	"assurance":          {"application/pdf", "image/jpeg", "image/png", "image/heic"},
+	"controle_technique": {"application/pdf", "image/jpeg", "image/png", "image/heic"},
+	"facture":            {"application/pdf", "image/jpeg", "image/png", "image/heic"},
+	"autre":              {"application/pdf", "image/jpeg", "image/png", "image/heic"},
+}
+
+// DocumentDateRule décrit les dates de validité attendues pour un type de document
+type DocumentDateRule struct {
+	NoExpiry              bool // le document n'expire pas : expires_at est refusé
+	DefaultValidityMonths int  // expires_at calculé à partir de issued_at s'il n'est pas fourni (0 : aucun)
+	MaxValidityMonths     int  // durée maximale entre issued_at et expires_at (0 : illimitée)
+}
+
+// DocumentDateRules liste les règles de validité de chaque type de document :
+// un contrôle technique est valable 2 ans, une attestation d'assurance au plus
+// un an (avec un mois de tolérance pour les échéances décalées)
+var DocumentDateRules = map[string]DocumentDateRule{
+	"carte_grise":        {NoExpiry: true},
+	"assurance":          {MaxValidityMonths: 13},
+	"controle_technique": {DefaultValidityMonths: 24, MaxValidityMonths: 24},
+	"facture":            {NoExpiry: true},
+	"autre":              {},
+}
+
+// Erreurs de validation des dates d'un document
+var (
+	ErrIssuedInFuture     = errors.New("la date d'émission ne peut pas être dans le futur")
+	ErrExpiresBeforeIssue = errors.New("la date d'expiration doit être postérieure à la date d'émission")
+	ErrExpiryNotAllowed   = errors.New("ce type de document n'a pas de date d'expiration")
+	ErrValidityTooLong    = errors.New("durée de validité trop longue pour ce type de document")
+)
+
+// ValidateDocumentDates vérifie les dates d'un document de type docType et
+// retourne la date d'expiration à enregistrer, éventuellement calculée d'après
+// la règle du type. La date d'émission peut dépasser now d'un jour, l'utilisateur
+// n'étant pas forcément dans le fuseau horaire du serveur
+func ValidateDocumentDates(docType string, issuedAt, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	rule := DocumentDateRules[docType]
+
+	if issuedAt != nil && issuedAt.After(now.AddDate(0, 0, 1)) {
+		return nil, ErrIssuedInFuture
+	}
+	if expiresAt != nil && rule.NoExpiry {
+		return nil, ErrExpiryNotAllowed
+	}
+	if issuedAt == nil {
+		return expiresAt, nil
+	}
+
+	if expiresAt == nil {
+		if rule.DefaultValidityMonths == 0 {
+			return nil, nil
+		}
+		expires := issuedAt.AddDate(0, rule.DefaultValidityMonths, 0)
+		return &expires, nil
+	}
+	if !expiresAt.After(*issuedAt) {
+		return nil, ErrExpiresBeforeIssue
+	}
+	if rule.MaxValidityMonths > 0 && expiresAt.After(issuedAt.AddDate(0, rule.MaxValidityMonths, 0)) {
+		return nil, ErrValidityTooLong
+	}
+	return expiresAt, nil
 }
 
 type DocumentRequest struct {
-	VehicleID   int     `form:"vehicle_id" binding:"required"`
-	Name        string  `form:"name" binding:"required"`
-	Type        string  `form:"type" binding:"required"`
-	Description *string `form:"description"`
+	VehicleID   int        `form:"vehicle_id" binding:"required"`
+	Name        string     `form:"name" binding:"required"`
+	Type        string     `form:"type" binding:"required"`
+	Description *string    `form:"description"`
+	IssuedAt    *time.Time `form:"issued_at" time_format:"2006-01-02" time_utc:"1"`
+	ExpiresAt   *time.Time `form:"expires_at" time_format:"2006-01-02" time_utc:"1"`
 }
 
 type DocumentResponse struct {
-	ID          int       `json:"id"`
-	VehicleID   int       `json:"vehicle_id"`
-	Name        string    `json:"name"`
-	Type        string    `json:"type"`
-	Description *string   `json:"description"`
-	FileName    string    `json:"file_name"`
-	FileSize    int64     `json:"file_size"`
-	DownloadURL string    `json:"download_url"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID           int        `json:"id"`
+	VehicleID    int        `json:"vehicle_id"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	Description  *string    `json:"description"`
+	FileName     string     `json:"file_name"`
+	FileSize     int64      `json:"file_size"`
+	Version      int        `json:"version"`
+	DownloadURL  string     `json:"download_url"`
+	ThumbnailURL *string    `json:"thumbnail_url"` // nil tant que l'aperçu n'est pas généré
+	IssuedAt     *time.Time `json:"issued_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ExpiringDocumentResponse est un document dont l'échéance approche ou est passée
+type ExpiringDocumentResponse struct {
+	DocumentResponse
+	VehiclePlate string `json:"vehicle_plate"`
+	DaysLeft     int    `json:"days_left"` // négatif si le document a expiré
+	Expired      bool   `json:"expired"`
 }
\ No newline at end of file
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentExtraction est le résultat de la lecture d'un document scanné :
+// les champs reconnus tels qu'imprimés et les valeurs proposées à l'utilisateur
+type DocumentExtraction struct {
+	ID                int                      `json:"id"`
+	DocumentID        int                      `json:"document_id"`
+	VehicleID         int                      `json:"vehicle_id"`
+	Status            string                   `json:"status"` // "pending", "processing", "done", "failed", "unsupported"
+	Source            *string                  `json:"source"` // "pdf_text" ou "ocr"
+	Fields            map[string]string        `json:"fields"` // par libellé : "A", "B", "D.1", "D.2", "D.3", "E", "J.1"...
+	SuggestedVehicle  *SuggestedVehicleFields  `json:"suggested_vehicle"`
+	SuggestedDocument *SuggestedDocumentFields `json:"suggested_document"`
+	CreatedAt         time.Time                `json:"created_at"`
+	UpdatedAt         time.Time                `json:"updated_at"`
+}
+
+// SuggestedVehicleFields reprend les champs de VehicleRequest lus sur le document
+type SuggestedVehicleFields struct {
+	Plate                 *string `json:"plate,omitempty"`
+	Brand                 *string `json:"brand,omitempty"`
+	Model                 *string `json:"model,omitempty"`
+	Year                  *int    `json:"year,omitempty"`
+	FirstRegistrationDate *string `json:"first_registration_date,omitempty"` // AAAA-MM-JJ
+	VIN                   *string `json:"vin,omitempty"`
+	Category              *string `json:"category,omitempty"` // genre national (J.1) : VP, CTTE, MTL...
+}
+
+// SuggestedDocumentFields propose les dates de validité du document lui-même
+type SuggestedDocumentFields struct {
+	IssuedAt  *string `json:"issued_at,omitempty"`  // AAAA-MM-JJ
+	ExpiresAt *string `json:"expires_at,omitempty"` // AAAA-MM-JJ
+}
+
+// DocumentExtractionTypes sont les types de document dont on extrait les champs
+var DocumentExtractionTypes = []string{"carte_grise", "assurance"}
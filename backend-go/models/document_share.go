@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentShare est un lien public vers un document, vu par son propriétaire
+type DocumentShare struct {
+	ID             int        `json:"id"`
+	DocumentID     int        `json:"document_id"`
+	Label          *string    `json:"label"`
+	SingleUse      bool       `json:"single_use"`
+	Status         string     `json:"status"` // "active", "expired", "used", "revoked"
+	URL            *string    `json:"url"`    // nil une fois le lien inutilisable
+	ExpiresAt      time.Time  `json:"expires_at"`
+	FirstUsedAt    *time.Time `json:"first_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	AccessCount    int        `json:"access_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type DocumentShareRequest struct {
+	// En secondes, 7 jours par défaut ; bornes de shares.MinTTL et shares.MaxTTL
+	ExpiresIn *int    `json:"expires_in" binding:"omitempty,min=300,max=2592000"`
+	SingleUse bool    `json:"single_use"`
+	Label     *string `json:"label"` // destinataire, pour s'y retrouver dans la liste
+}
+
+// DocumentShareAccess est une ouverture d'un lien de partage
+type DocumentShareAccess struct {
+	ID         int       `json:"id"`
+	Outcome    string    `json:"outcome"` // "ok", "expired", "used", "revoked"
+	IPAddress  *string   `json:"ip_address"`
+	UserAgent  *string   `json:"user_agent"`
+	AccessedAt time.Time `json:"accessed_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentUploadResponse est l'état d'un envoi reprenable (tus). Une fois
+// l'envoi terminé, DocumentID désigne le document créé
+type DocumentUploadResponse struct {
+	ID           string    `json:"id"`
+	VehicleID    int       `json:"vehicle_id"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	FileName     string    `json:"file_name"`
+	UploadLength int64     `json:"upload_length"`
+	UploadOffset int64     `json:"upload_offset"`
+	Status       string    `json:"status"`
+	DocumentID   *int      `json:"document_id"`
+	DownloadURL  *string   `json:"download_url"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentVersion est un fichier successif d'un même document (attestation
+// renouvelée, meilleur scan...) ; la version courante en fait partie
+type DocumentVersion struct {
+	Version     int        `json:"version"`
+	Current     bool       `json:"current"`
+	FileName    string     `json:"file_name"`
+	FileSize    int64      `json:"file_size"`
+	MimeType    string     `json:"mime_type"`
+	FileSHA256  *string    `json:"file_sha256"`
+	IssuedAt    *time.Time `json:"issued_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	DownloadURL string     `json:"download_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// DocumentVersionRequest accompagne le fichier d'une nouvelle version. Sans
+// aucune date, celles de la version précédente sont conservées
+type DocumentVersionRequest struct {
+	IssuedAt  *time.Time `form:"issued_at" time_format:"2006-01-02" time_utc:"1"`
+	ExpiresAt *time.Time `form:"expires_at" time_format:"2006-01-02" time_utc:"1"`
+}
+
+// DeletedDocumentResponse est un document supprimé, restaurable jusqu'à la
+// purge de ses fichiers
+type DeletedDocumentResponse struct {
+	ID           int       `json:"id"`
+	VehicleID    int       `json:"vehicle_id"`
+	VehiclePlate string    `json:"vehicle_plate"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	FileName     string    `json:"file_name"`
+	FileSize     int64     `json:"file_size"`
+	Version      int       `json:"version"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	PurgeAt      time.Time `json:"purge_at"`
+}
@@ -0,0 +1,7 @@
+package models
+
+// EntitlementsResponse indique, pour chaque fonctionnalité connue, si
+// l'abonnement de l'utilisateur la débloque
+type EntitlementsResponse struct {
+	Features map[string]bool `json:"features"`
+}
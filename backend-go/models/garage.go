@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// Garage est un garage partenaire dont le personnel peut se connecter.
+// ExternalID correspond au garage_id opaque envoyé par l'application à la
+// création d'un rendez-vous
+type Garage struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	ExternalID string    `json:"external_id"`
+	Address    *string   `json:"address"`
+	City       *string   `json:"city"`
+	PostalCode *string   `json:"postal_code"`
+	Phone      *string   `json:"phone"`
+	Email      *string   `json:"email"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type CreateGarageRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	ExternalID string  `json:"external_id" binding:"required"`
+	Address    *string `json:"address"`
+	City       *string `json:"city"`
+	PostalCode *string `json:"postal_code"`
+	Phone      *string `json:"phone"`
+	Email      *string `json:"email"`
+}
+
+type AddGarageStaffRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type GarageDecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ProposeSlotRequest struct {
+	Date string `json:"date" binding:"required"`
+	Time string `json:"time" binding:"required"`
+	Note string `json:"note"`
+}
+
+type AppointmentProposalRequest struct {
+	Action string `json:"action" binding:"required"` // "accept" ou "decline"
+}
+
+// AppointmentCustomer regroupe les coordonnées du client visibles par le garage
+type AppointmentCustomer struct {
+	FullName string  `json:"full_name"`
+	Email    string  `json:"email"`
+	Phone    *string `json:"phone"`
+}
+
+type GarageAppointmentResponse struct {
+	AppointmentResponse
+	Customer AppointmentCustomer `json:"customer"`
+}
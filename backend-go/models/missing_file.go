@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// MissingFileResponse est une ligne dont le fichier est introuvable dans le
+// stockage, relevée par la réconciliation du stockage
+type MissingFileResponse struct {
+	Source     string    `json:"source"` // documents, document_versions ou users
+	RecordID   int       `json:"record_id"`
+	StorageKey string    `json:"storage_key"`
+	DetectedAt time.Time `json:"detected_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// PlanLimits sont les quotas d'un abonnement ; 0 signifie illimité
+type PlanLimits struct {
+	StorageBytes        int64 `json:"storage_bytes"`
+	DocumentsPerVehicle int   `json:"documents_per_vehicle"`
+	Vehicles            int   `json:"vehicles"`
+}
+
+// VehicleUsage est le nombre de documents d'un véhicule
+type VehicleUsage struct {
+	VehicleID int    `json:"vehicle_id"`
+	Plate     string `json:"plate"`
+	Documents int    `json:"documents"`
+}
+
+// UsageResponse est la consommation d'un utilisateur face aux quotas de son
+// abonnement. StorageBytes compte toutes les versions des documents, y
+// compris ceux supprimés mais encore restaurables
+type UsageResponse struct {
+	Plan         string         `json:"plan"`
+	Limits       PlanLimits     `json:"limits"`
+	StorageBytes int64          `json:"storage_bytes"`
+	Vehicles     int            `json:"vehicles"`
+	Documents    []VehicleUsage `json:"documents"`
+}
@@ -13,6 +13,10 @@ type User struct {
 	LastName       *string   `json:"last_name"`
 	Phone          *string   `json:"phone"`
 	ProfilePicture *string   `json:"profile_picture"`
+	EmailVerified  bool      `json:"email_verified"`
+	PendingEmail   *string   `json:"pending_email,omitempty"`
+	TOTPEnabled    bool      `json:"totp_enabled"`
+	Role           string    `json:"role"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -36,6 +40,10 @@ type UserResponse struct {
 	LastName       *string `json:"last_name"`
 	Phone          *string `json:"phone"`
 	ProfilePicture *string `json:"profile_picture"`
+	EmailVerified  bool    `json:"email_verified"`
+	PendingEmail   *string `json:"pending_email,omitempty"`
+	TOTPEnabled    bool    `json:"totp_enabled"`
+	Role           string  `json:"role,omitempty"`
 }
 
 type UpdateProfileRequest struct {
@@ -48,13 +56,48 @@ type UpdateProfileRequest struct {
 type UpdatePasswordRequest struct {
 	CurrentPassword string `json:"current_password" binding:"required"`
 	NewPassword     string `json:"new_password" binding:"required,min=6"`
+	TOTPCode        string `json:"totp_code"`
 }
 
 type ForgotPasswordRequest struct {
-	Email string `json:"email" binding:"required,email"`
+	Email    string `json:"email" binding:"required,email"`
+	Language string `json:"lang"`
 }
 
 type ResetPasswordRequest struct {
 	Token       string `json:"token" binding:"required"`
 	NewPassword string `json:"newPassword" binding:"required,min=6"`
-}
\ No newline at end of file
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type OIDCLoginRequest struct {
+	Provider string `json:"provider" binding:"required,oneof=apple google"`
+	IDToken  string `json:"id_token" binding:"required"`
+	Nonce    string `json:"nonce" binding:"required,len=64"` // émis par POST /auth/oidc/nonce
+	// Apple ne transmet le nom qu'à l'application, lors de la première connexion
+	FullName string `json:"full_name"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// Rôles des comptes
+const (
+	RoleUser   = "user"   // Particulier propriétaire de véhicules
+	RoleGarage = "garage" // Compte d'un garage partenaire
+	RoleAdmin  = "admin"  // Administrateur de la plateforme
+)
+
+// IsValidRole vérifie si un rôle est valide
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleGarage, RoleAdmin:
+		return true
+	default:
+		return false
+	}
+}
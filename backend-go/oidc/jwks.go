@@ -0,0 +1,137 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSCacheTTL = time.Hour
+	// Délai minimal entre deux téléchargements déclenchés par un kid inconnu
+	jwksRefreshCooldown = 30 * time.Second
+)
+
+// remoteKeySet télécharge et met en cache les clés publiques d'un fournisseur
+type remoteKeySet struct {
+	url       string
+	client    *http.Client
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	expiresAt time.Time
+	lastFetch time.Time
+}
+
+func newRemoteKeySet(url string, client *http.Client) *remoteKeySet {
+	return &remoteKeySet{url: url, client: client, keys: map[string]*rsa.PublicKey{}}
+}
+
+// key retourne la clé désignée par kid, en rechargeant le JWKS si le cache a
+// expiré ou si le fournisseur a fait tourner ses clés
+func (s *remoteKeySet) key(kid string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[kid]; ok && time.Now().Before(s.expiresAt) {
+		return key, nil
+	}
+
+	if time.Since(s.lastFetch) > jwksRefreshCooldown || time.Now().After(s.expiresAt) {
+		if err := s.fetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("clé %s absente du JWKS", kid)
+	}
+	return key, nil
+}
+
+func (s *remoteKeySet) fetch() error {
+	s.lastFetch = time.Now()
+
+	resp, err := s.client.Get(s.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS %s: statut %d", s.url, resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			KeyType string `json:"kty"`
+			KeyID   string `json:"kid"`
+			Use     string `json:"use"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseRSAKey(jwk.N, jwk.E)
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("aucune clé RSA utilisable dans le JWKS")
+	}
+
+	s.keys = keys
+	s.expiresAt = time.Now().Add(cacheTTL(resp.Header.Get("Cache-Control")))
+	return nil
+}
+
+// cacheTTL lit max-age dans l'en-tête Cache-Control du fournisseur
+func cacheTTL(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultJWKSCacheTTL
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(eBytes)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("exposant RSA invalide")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}, nil
+}
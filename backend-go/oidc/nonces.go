@@ -0,0 +1,68 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// NonceTTL est la durée pendant laquelle un nonce émis peut servir à se connecter
+var NonceTTL = 10 * time.Minute
+
+// NonceStore conserve les nonces émis par le serveur jusqu'à leur utilisation.
+// Un ID token n'est accepté qu'avec un nonce émis, non expiré et pas encore
+// utilisé : un token intercepté ne peut pas être rejoué
+type NonceStore interface {
+	// Issue génère et enregistre un nouveau nonce
+	Issue(ctx context.Context) (string, error)
+	// Consume supprime le nonce ; false s'il est inconnu, expiré ou déjà utilisé
+	Consume(ctx context.Context, nonce string) (bool, error)
+}
+
+// DBNonces conserve les nonces dans la table oidc_nonces, partagée entre les
+// répliques
+type DBNonces struct {
+	DB *sql.DB
+}
+
+func (n DBNonces) Issue(ctx context.Context) (string, error) {
+	// Les nonces expirés sans avoir servi sont purgés au fil des émissions
+	if _, err := n.DB.ExecContext(ctx, "DELETE FROM oidc_nonces WHERE expires_at < CURRENT_TIMESTAMP"); err != nil {
+		return "", err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	_, err = n.DB.ExecContext(ctx,
+		"INSERT INTO oidc_nonces (nonce, expires_at) VALUES ($1, CURRENT_TIMESTAMP + $2 * INTERVAL '1 second')",
+		nonce, int64(NonceTTL.Seconds()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return nonce, nil
+}
+
+func (n DBNonces) Consume(ctx context.Context, nonce string) (bool, error) {
+	result, err := n.DB.ExecContext(ctx,
+		"DELETE FROM oidc_nonces WHERE nonce = $1 AND expires_at > CURRENT_TIMESTAMP",
+		nonce,
+	)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func newNonce() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
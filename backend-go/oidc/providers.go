@@ -0,0 +1,67 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+)
+
+// Fournisseurs supportés
+const (
+	ProviderApple  = "apple"
+	ProviderGoogle = "google"
+)
+
+var (
+	verifiers = map[string]*Verifier{}
+	nonces    NonceStore
+)
+
+// Init configure les fournisseurs dont les identifiants client sont renseignés.
+// Les URL JWKS et émetteurs peuvent être surchargés, par exemple pour les tests.
+// Les nonces émis sont conservés dans db
+func Init(db *sql.DB) {
+	nonces = DBNonces{DB: db}
+	register(ProviderGoogle,
+		envOrDefault("OIDC_GOOGLE_ISSUERS", "https://accounts.google.com,accounts.google.com"),
+		os.Getenv("OIDC_GOOGLE_CLIENT_IDS"),
+		envOrDefault("OIDC_GOOGLE_JWKS_URL", "https://www.googleapis.com/oauth2/v3/certs"),
+	)
+	register(ProviderApple,
+		envOrDefault("OIDC_APPLE_ISSUERS", "https://appleid.apple.com"),
+		os.Getenv("OIDC_APPLE_CLIENT_IDS"),
+		envOrDefault("OIDC_APPLE_JWKS_URL", "https://appleid.apple.com/auth/keys"),
+	)
+}
+
+func register(provider, issuers, clientIDs, jwksURL string) {
+	audiences := splitList(clientIDs)
+	if len(audiences) == 0 {
+		log.Printf("Connexion %s désactivée (aucun identifiant client configuré)", provider)
+		return
+	}
+	verifiers[provider] = NewVerifier(provider, splitList(issuers), audiences, jwksURL, nonces)
+}
+
+// IssueNonce émet un nonce à utiliser pour une demande d'ID token, valable
+// NonceTTL et une seule fois
+func IssueNonce(ctx context.Context) (string, error) {
+	return nonces.Issue(ctx)
+}
+
+// Get retourne le vérificateur d'un fournisseur configuré
+func Get(provider string) (*Verifier, error) {
+	verifier, ok := verifiers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return verifier, nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
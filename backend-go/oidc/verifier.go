@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownProvider = errors.New("fournisseur OIDC inconnu ou non configuré")
+	ErrInvalidToken    = errors.New("ID token invalide")
+)
+
+// Identity regroupe les informations utiles extraites d'un ID token vérifié
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Verifier vérifie les ID tokens d'un fournisseur : signature via son JWKS,
+// émetteur, audience (identifiants client de l'application), expiration et nonce
+type Verifier struct {
+	Provider  string
+	Issuers   []string
+	Audiences []string
+	keySet    *remoteKeySet
+	nonces    NonceStore
+}
+
+// NewVerifier crée un vérificateur ; jwksURL peut pointer vers un fournisseur
+// local pour les tests. nonces contient les nonces émis par le serveur
+func NewVerifier(provider string, issuers, audiences []string, jwksURL string, nonces NonceStore) *Verifier {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &Verifier{
+		Provider:  provider,
+		Issuers:   issuers,
+		Audiences: audiences,
+		keySet:    newRemoteKeySet(jwksURL, client),
+		nonces:    nonces,
+	}
+}
+
+// Verify contrôle l'ID token et le nonce fourni par l'application, qui doit
+// avoir été émis par IssueNonce. Le nonce du token peut être ce nonce ou son
+// empreinte SHA-256 (cas de Sign in with Apple). Le nonce est consommé une
+// fois le token vérifié : le même token ne peut servir qu'une fois
+func (v *Verifier) Verify(ctx context.Context, idToken, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keySet.key(kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		return nil, fmt.Errorf("%w: expiration absente", ErrInvalidToken)
+	}
+
+	issuer, _ := claims.GetIssuer()
+	if !contains(v.Issuers, issuer) {
+		return nil, fmt.Errorf("%w: émetteur %q inattendu", ErrInvalidToken, issuer)
+	}
+
+	audiences, _ := claims.GetAudience()
+	if !containsAny(v.Audiences, audiences) {
+		return nil, fmt.Errorf("%w: audience inattendue", ErrInvalidToken)
+	}
+
+	if !nonceMatches(claims["nonce"], nonce) {
+		return nil, fmt.Errorf("%w: nonce invalide", ErrInvalidToken)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: sujet absent", ErrInvalidToken)
+	}
+
+	consumed, err := v.nonces.Consume(ctx, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, fmt.Errorf("%w: nonce inconnu, expiré ou déjà utilisé", ErrInvalidToken)
+	}
+
+	identity := &Identity{Provider: v.Provider, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+
+	// Google renvoie un booléen, Apple une chaîne "true"
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	return identity, nil
+}
+
+func nonceMatches(claim interface{}, nonce string) bool {
+	tokenNonce, _ := claim.(string)
+	if tokenNonce == "" || nonce == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(nonce))
+	hashed := hex.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) == 1 ||
+		subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(hashed)) == 1
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if contains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,293 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://appleid.apple.com"
+	testAudience = "com.saveyourcar.app"
+	testKeyID    = "test-key"
+	testNonce    = "n-0S6_WzA2Mj"
+)
+
+var (
+	testKeysOnce          sync.Once
+	providerKey, otherKey *rsa.PrivateKey
+)
+
+// testKeys génère une fois pour toutes la clé du fournisseur et une autre clé
+func testKeys(t *testing.T) (*rsa.PrivateKey, *rsa.PrivateKey) {
+	t.Helper()
+	testKeysOnce.Do(func() {
+		var err error
+		if providerKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+		if otherKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return providerKey, otherKey
+}
+
+// memoryNonces garde les nonces émis en mémoire
+type memoryNonces struct {
+	mu     sync.Mutex
+	issued map[string]time.Time
+}
+
+func (n *memoryNonces) Issue(ctx context.Context) (string, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	n.add(nonce, time.Now().Add(NonceTTL))
+	return nonce, nil
+}
+
+func (n *memoryNonces) Consume(ctx context.Context, nonce string) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	expiresAt, ok := n.issued[nonce]
+	delete(n.issued, nonce)
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+func (n *memoryNonces) add(nonce string, expiresAt time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.issued[nonce] = expiresAt
+}
+
+// issue enregistre testNonce comme émis par le serveur
+func issue(v *Verifier) {
+	v.nonces.(*memoryNonces).add(testNonce, time.Now().Add(NonceTTL))
+}
+
+// newTestVerifier démarre un fournisseur local qui publie la clé du
+// fournisseur dans son JWKS ; testNonce est émis
+func newTestVerifier(t *testing.T) *Verifier {
+	t.Helper()
+	key, _ := testKeys(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKeyID,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	v := NewVerifier("apple", []string{testIssuer}, []string{testAudience}, server.URL, &memoryNonces{issued: map[string]time.Time{}})
+	issue(v)
+	return v
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            testIssuer,
+		"aud":            testAudience,
+		"sub":            "001234.abcdef",
+		"email":          "jean@example.com",
+		"email_verified": "true",
+		"iat":            now.Unix(),
+		"exp":            now.Add(10 * time.Minute).Unix(),
+		"nonce":          testNonce,
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func expectInvalid(t *testing.T, v *Verifier, idToken, nonce string) {
+	t.Helper()
+	if _, err := v.Verify(context.Background(), idToken, nonce); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("erreur %v, attendu ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+
+	identity, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, testKeyID, key, validClaims()), testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Provider != "apple" || identity.Subject != "001234.abcdef" || identity.Email != "jean@example.com" || !identity.EmailVerified {
+		t.Errorf("identité inattendue: %+v", identity)
+	}
+}
+
+func TestVerifyBadSignature(t *testing.T) {
+	v := newTestVerifier(t)
+	_, other := testKeys(t)
+
+	// Signé par une autre clé sous le kid publié par le fournisseur
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, other, validClaims()), testNonce)
+}
+
+func TestVerifyUnknownKeyID(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, "unknown", key, validClaims()), testNonce)
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, "", key, validClaims()), testNonce)
+}
+
+func TestVerifyRejectsOtherAlgorithms(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+
+	// Même clé RSA, autre algorithme
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS512, testKeyID, key, validClaims()), testNonce)
+	expectInvalid(t, v, sign(t, jwt.SigningMethodPS256, testKeyID, key, validClaims()), testNonce)
+
+	// Confusion d'algorithme : HMAC avec la clé publique comme secret
+	expectInvalid(t, v, sign(t, jwt.SigningMethodHS256, testKeyID, key.N.Bytes(), validClaims()), testNonce)
+
+	// Jeton non signé
+	expectInvalid(t, v, sign(t, jwt.SigningMethodNone, testKeyID, jwt.UnsafeAllowNoneSignatureType, validClaims()), testNonce)
+}
+
+func TestVerifyIssuerAndAudience(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+
+	claims := validClaims()
+	claims["iss"] = "https://accounts.google.com"
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce)
+
+	claims = validClaims()
+	claims["aud"] = "com.autre.app"
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce)
+
+	// Une audience parmi plusieurs suffit
+	claims = validClaims()
+	claims["aud"] = []string{"com.autre.app", testAudience}
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce); err != nil {
+		t.Errorf("audience multiple refusée: %v", err)
+	}
+}
+
+func TestVerifyExpiration(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce)
+
+	claims = validClaims()
+	delete(claims, "exp")
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce)
+
+	// Un décalage d'horloge de moins d'une minute est toléré
+	claims = validClaims()
+	claims["exp"] = time.Now().Add(-30 * time.Second).Unix()
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce); err != nil {
+		t.Errorf("jeton expiré depuis 30 s refusé: %v", err)
+	}
+}
+
+func TestVerifyNonce(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+
+	// Google renvoie le nonce brut
+	if _, err := v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, testKeyID, key, validClaims()), testNonce); err != nil {
+		t.Errorf("nonce brut refusé: %v", err)
+	}
+
+	// Apple renvoie l'empreinte SHA-256 du nonce envoyé par l'application
+	sum := sha256.Sum256([]byte(testNonce))
+	claims := validClaims()
+	claims["nonce"] = hex.EncodeToString(sum[:])
+	hashed := sign(t, jwt.SigningMethodRS256, testKeyID, key, claims)
+	issue(v)
+	if _, err := v.Verify(context.Background(), hashed, testNonce); err != nil {
+		t.Errorf("nonce haché refusé: %v", err)
+	}
+	issue(v)
+	expectInvalid(t, v, hashed, "autre-nonce")
+
+	valid := sign(t, jwt.SigningMethodRS256, testKeyID, key, validClaims())
+	expectInvalid(t, v, valid, "autre-nonce")
+	expectInvalid(t, v, valid, "")
+
+	claims = validClaims()
+	delete(claims, "nonce")
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce)
+}
+
+func TestVerifyReplay(t *testing.T) {
+	v := newTestVerifier(t)
+	key, _ := testKeys(t)
+	ctx := context.Background()
+
+	// Le nonce est émis par le serveur et consommé par la première connexion
+	nonce, err := v.nonces.Issue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := validClaims()
+	claims["nonce"] = nonce
+	token := sign(t, jwt.SigningMethodRS256, testKeyID, key, claims)
+	if _, err := v.Verify(ctx, token, nonce); err != nil {
+		t.Fatalf("première connexion refusée: %v", err)
+	}
+
+	// Un token intercepté est rejoué avec le nonce qu'il contient
+	expectInvalid(t, v, token, nonce)
+
+	// Un nonce choisi par le client n'a jamais été émis
+	claims["nonce"] = "choisi-par-le-client"
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), "choisi-par-le-client")
+
+	// Un nonce expiré est refusé
+	v.nonces.(*memoryNonces).add("expire", time.Now().Add(-time.Second))
+	claims["nonce"] = "expire"
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), "expire")
+
+	// Un token invalide ne consomme pas le nonce
+	claims["nonce"] = testNonce
+	_, other := testKeys(t)
+	expectInvalid(t, v, sign(t, jwt.SigningMethodRS256, testKeyID, other, claims), testNonce)
+	if _, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, testKeyID, key, claims), testNonce); err != nil {
+		t.Errorf("nonce consommé par un token invalide: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package quotas
+
+import (
+	"backend-go/entitlements"
+	"backend-go/media"
+	"backend-go/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Abonnements : un utilisateur dont l'abonnement débloque
+// entitlements.FeaturePremiumQuotas est premium
+const (
+	PlanFree    = "free"
+	PlanPremium = "premium"
+)
+
+// Codes d'erreur des dépassements de quota
+const (
+	CodeStorage   = "storage_quota_exceeded"
+	CodeDocuments = "document_limit_reached"
+	CodeVehicles  = "vehicle_limit_reached"
+)
+
+// Plans sont les quotas de chaque abonnement
+var Plans = map[string]models.PlanLimits{
+	PlanFree: {
+		StorageBytes:        100 << 20,
+		DocumentsPerVehicle: 10,
+		Vehicles:            1,
+	},
+	PlanPremium: {
+		StorageBytes:        10 << 30,
+		DocumentsPerVehicle: 0,
+		Vehicles:            10,
+	},
+}
+
+// ExceededError est retournée quand une opération dépasserait un quota
+type ExceededError struct {
+	Plan  string
+	Code  string
+	Limit int64
+	Usage int64 // consommation actuelle, sans l'opération refusée
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota %s dépassé (abonnement %s, limite %d, utilisé %d)", e.Code, e.Plan, e.Limit, e.Usage)
+}
+
+// Queryer est *sql.DB ou *sql.Tx
+type Queryer interface {
+	entitlements.Queryer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Init lit les quotas QUOTA_<PLAN>_STORAGE ("100MB", "10GB"),
+// QUOTA_<PLAN>_DOCUMENTS_PER_VEHICLE et QUOTA_<PLAN>_VEHICLES pour chaque
+// abonnement (FREE, PREMIUM) ; 0 signifie illimité
+func Init() {
+	for plan, limits := range Plans {
+		prefix := "QUOTA_" + strings.ToUpper(plan) + "_"
+		if value := os.Getenv(prefix + "STORAGE"); value != "" {
+			size := int64(0)
+			if value != "0" {
+				var err error
+				if size, err = media.ParseSize(value); err != nil {
+					log.Fatalf("%sSTORAGE invalide: %s", prefix, value)
+				}
+			}
+			limits.StorageBytes = size
+		}
+		for name, target := range map[string]*int{
+			"DOCUMENTS_PER_VEHICLE": &limits.DocumentsPerVehicle,
+			"VEHICLES":              &limits.Vehicles,
+		} {
+			value := os.Getenv(prefix + name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				log.Fatalf("%s%s invalide: %s", prefix, name, value)
+			}
+			*target = n
+		}
+		Plans[plan] = limits
+	}
+}
+
+// UserPlan retourne l'abonnement d'un utilisateur, d'après les droits de
+// ses abonnements (ENTITLEMENT_PRICES)
+func UserPlan(ctx context.Context, q Queryer, userID int) (string, error) {
+	premium, err := entitlements.Has(ctx, q, userID, entitlements.FeaturePremiumQuotas)
+	if err != nil {
+		return "", err
+	}
+	if premium {
+		return PlanPremium, nil
+	}
+	return PlanFree, nil
+}
+
+// LockUser verrouille la ligne de l'utilisateur jusqu'à la fin de tx : deux
+// envois simultanés ne peuvent pas dépasser ensemble un quota
+func LockUser(ctx context.Context, tx *sql.Tx, userID int) error {
+	var id int
+	return tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id)
+}
+
+// StorageUsed retourne la taille de toutes les versions des documents de
+// l'utilisateur, supprimés compris tant qu'ils ne sont pas purgés
+func StorageUsed(ctx context.Context, q Queryer, userID int) (int64, error) {
+	var used int64
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(v.file_size), 0)
+		FROM document_versions v JOIN documents d ON d.id = v.document_id
+		WHERE d.user_id = $1`, userID).Scan(&used)
+	return used, err
+}
+
+// CheckDocument vérifie qu'un nouveau document de size octets respecte la
+// limite de documents du véhicule et l'espace de stockage
+func CheckDocument(ctx context.Context, q Queryer, userID, vehicleID int, size int64) error {
+	plan, err := UserPlan(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkDocuments(ctx, q, plan, vehicleID); err != nil {
+		return err
+	}
+	return checkStorage(ctx, q, plan, userID, size)
+}
+
+// CheckDocuments vérifie qu'un document de plus respecte la limite du véhicule
+func CheckDocuments(ctx context.Context, q Queryer, userID, vehicleID int) error {
+	plan, err := UserPlan(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	return checkDocuments(ctx, q, plan, vehicleID)
+}
+
+// CheckStorage vérifie que size octets de plus tiennent dans l'espace de stockage
+func CheckStorage(ctx context.Context, q Queryer, userID int, size int64) error {
+	plan, err := UserPlan(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	return checkStorage(ctx, q, plan, userID, size)
+}
+
+// CheckVehicles vérifie qu'un véhicule de plus respecte la limite
+func CheckVehicles(ctx context.Context, q Queryer, userID int) error {
+	plan, err := UserPlan(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	return checkVehicles(ctx, q, plan, userID)
+}
+
+// CheckTransfer vérifie que le véhicule vehicleID et ses documents, transférés
+// à userID, respectent ses limites de véhicules, de documents par véhicule et
+// d'espace de stockage
+func CheckTransfer(ctx context.Context, q Queryer, userID, vehicleID int) error {
+	plan, err := UserPlan(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkVehicles(ctx, q, plan, userID); err != nil {
+		return err
+	}
+
+	// Les documents supprimés restent à l'ancien propriétaire
+	var count int
+	var size int64
+	err = q.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT d.id), COALESCE(SUM(v.file_size), 0)
+		FROM documents d LEFT JOIN document_versions v ON v.document_id = d.id
+		WHERE d.vehicle_id = $1 AND d.deleted_at IS NULL`, vehicleID).Scan(&count, &size)
+	if err != nil {
+		return err
+	}
+	if limit := Plans[plan].DocumentsPerVehicle; limit != 0 && count > limit {
+		return &ExceededError{Plan: plan, Code: CodeDocuments, Limit: int64(limit), Usage: int64(count)}
+	}
+	return checkStorage(ctx, q, plan, userID, size)
+}
+
+func checkVehicles(ctx context.Context, q Queryer, plan string, userID int) error {
+	limit := Plans[plan].Vehicles
+	if limit == 0 {
+		return nil
+	}
+	var count int
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM vehicles WHERE user_id = $1", userID).Scan(&count); err != nil {
+		return err
+	}
+	if count >= limit {
+		return &ExceededError{Plan: plan, Code: CodeVehicles, Limit: int64(limit), Usage: int64(count)}
+	}
+	return nil
+}
+
+func checkDocuments(ctx context.Context, q Queryer, plan string, vehicleID int) error {
+	limit := Plans[plan].DocumentsPerVehicle
+	if limit == 0 {
+		return nil
+	}
+	var count int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM documents WHERE vehicle_id = $1 AND deleted_at IS NULL", vehicleID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= limit {
+		return &ExceededError{Plan: plan, Code: CodeDocuments, Limit: int64(limit), Usage: int64(count)}
+	}
+	return nil
+}
+
+func checkStorage(ctx context.Context, q Queryer, plan string, userID int, size int64) error {
+	limit := Plans[plan].StorageBytes
+	if limit == 0 {
+		return nil
+	}
+	used, err := StorageUsed(ctx, q, userID)
+	if err != nil {
+		return err
+	}
+	if used+size > limit {
+		return &ExceededError{Plan: plan, Code: CodeStorage, Limit: limit, Usage: used}
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+package reconcile
+
+import (
+	"backend-go/encryption"
+	"backend-go/media"
+	"backend-go/storage"
+	"backend-go/thumbnails"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Réconciliation du stockage avec la base : les fichiers qui ne sont plus
+// référencés (suppression d'un compte ou d'un véhicule, arrêt du serveur entre
+// l'écriture du fichier et l'INSERT) sont supprimés, les lignes dont le
+// fichier a disparu sont relevées dans missing_files
+
+// GracePeriod protège les fichiers récents : un fichier est écrit avant la
+// ligne qui le référence
+var GracePeriod = 24 * time.Hour
+
+// Sources des références, tables des lignes relevées dans missing_files
+const (
+	SourceDocuments        = "documents"
+	SourceDocumentVersions = "document_versions"
+	SourceThumbnails       = "thumbnails"
+	SourceProfilePictures  = "users"
+	SourceUploadParts      = "document_upload_parts"
+)
+
+// Identifiant du verrou consultatif : une seule réplique réconcilie à la fois
+const advisoryLockID = 72150413
+
+// Reference est un fichier du stockage référencé par une ligne
+type Reference struct {
+	Source   string `json:"source"`
+	RecordID int    `json:"record_id"`
+	Key      string `json:"storage_key"`
+}
+
+// Report résume une réconciliation
+type Report struct {
+	DryRun      bool             `json:"dry_run"`
+	Scanned     int              `json:"scanned"` // fichiers parcourus dans le stockage
+	Orphans     []storage.Object `json:"orphans"`
+	OrphanBytes int64            `json:"orphan_bytes"`
+	Deleted     int              `json:"deleted"`
+	Failed      int              `json:"failed"`
+	Missing     []Reference      `json:"missing"`
+	// Clés de chiffrement sans fichier ni référence (arrêt pendant un envoi)
+	DanglingKeys int `json:"dangling_keys"`
+}
+
+// Init lit STORAGE_GC_GRACE, une durée Go ("24h")
+func Init() {
+	value := os.Getenv("STORAGE_GC_GRACE")
+	if value == "" {
+		return
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace <= 0 {
+		log.Fatalf("STORAGE_GC_GRACE invalide: %s", value)
+	}
+	GracePeriod = grace
+}
+
+// Start réconcilie le stockage en arrière-plan, au démarrage puis toutes les every
+func Start(db *sql.DB, every time.Duration) {
+	go func() {
+		for {
+			report, err := runLocked(context.Background(), db)
+			if err != nil {
+				log.Printf("Erreur réconciliation du stockage: %v", err)
+			} else if report != nil && (len(report.Orphans) > 0 || len(report.Missing) > 0 || report.DanglingKeys > 0) {
+				log.Printf("Réconciliation du stockage: %d fichier(s) orphelin(s) supprimé(s) (%d octets), %d en échec, %d fichier(s) manquant(s), %d clé(s) sans fichier",
+					report.Deleted, report.OrphanBytes, report.Failed, len(report.Missing), report.DanglingKeys)
+			}
+			time.Sleep(every)
+		}
+	}()
+}
+
+// runLocked lance Run si aucune autre réplique ne le fait ; retourne nil sinon
+func runLocked(ctx context.Context, db *sql.DB) (*Report, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", advisoryLockID).Scan(&locked); err != nil {
+		return nil, err
+	}
+	if !locked {
+		return nil, nil
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryLockID); err != nil {
+			log.Printf("Erreur libération du verrou de réconciliation: %v", err)
+		}
+	}()
+
+	report, err := Run(ctx, db, false)
+	return &report, err
+}
+
+// Run compare le stockage aux références en base. Les fichiers non
+// référencés plus anciens que GracePeriod sont supprimés, les aperçus
+// manquants sont régénérés et les autres fichiers manquants relevés dans
+// missing_files. En dryRun, rien n'est modifié et le rapport liste ce qui le serait
+func Run(ctx context.Context, db *sql.DB, dryRun bool) (Report, error) {
+	report := Report{DryRun: dryRun}
+
+	// Les références sont lues avant le parcours du stockage : un fichier
+	// écrit ensuite est plus récent que GracePeriod
+	references, err := References(ctx, db)
+	if err != nil {
+		return report, err
+	}
+	referenced := ReferencedKeys(references)
+
+	existing := map[string]bool{}
+	err = storage.Default.List(ctx, "", func(object storage.Object) error {
+		report.Scanned++
+		existing[object.Key] = true
+		if referenced[object.Key] || time.Since(object.ModTime) < GracePeriod {
+			return nil
+		}
+
+		report.Orphans = append(report.Orphans, object)
+		report.OrphanBytes += object.Size
+		if dryRun {
+			return nil
+		}
+		if err := encryption.Delete(ctx, db, object.Key); err != nil {
+			log.Printf("Réconciliation: suppression de %s impossible: %v", object.Key, err)
+			report.Failed++
+			return nil
+		}
+		report.Deleted++
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	if report.Missing, err = missingFiles(ctx, references, existing); err != nil {
+		return report, err
+	}
+	if report.DanglingKeys, err = danglingKeys(ctx, db, referenced, existing, dryRun); err != nil {
+		return report, err
+	}
+	if dryRun {
+		return report, nil
+	}
+	return report, flagMissing(ctx, db, report.Missing)
+}
+
+// References retourne les fichiers référencés en base : documents, versions,
+// aperçus, photos de profil et morceaux des envois reprenables
+func References(ctx context.Context, db *sql.DB) ([]Reference, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT $1::text, id, file_path FROM documents
+		UNION ALL
+		SELECT $2::text, id, file_path FROM document_versions
+		UNION ALL
+		SELECT $3::text, id, thumbnail_key FROM documents WHERE thumbnail_key IS NOT NULL
+		UNION ALL
+		SELECT $4::text, id, profile_picture FROM users WHERE profile_picture IS NOT NULL AND profile_picture <> ''
+		UNION ALL
+		SELECT $5::text, 0, storage_key FROM document_upload_parts`,
+		SourceDocuments, SourceDocumentVersions, SourceThumbnails, SourceProfilePictures, SourceUploadParts,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var references []Reference
+	for rows.Next() {
+		var ref Reference
+		if err := rows.Scan(&ref.Source, &ref.RecordID, &ref.Key); err != nil {
+			return nil, err
+		}
+		ref.Key = storage.KeyFromPath(ref.Key)
+		references = append(references, ref)
+	}
+	return references, rows.Err()
+}
+
+// ReferencedKeys retourne l'ensemble des clés référencées, variantes des
+// photos de profil comprises
+func ReferencedKeys(references []Reference) map[string]bool {
+	referenced := map[string]bool{}
+	for _, ref := range references {
+		referenced[ref.Key] = true
+		if ref.Source == SourceProfilePictures {
+			for _, size := range media.ProfilePictureSizes {
+				referenced[storage.VariantKey(ref.Key, strconv.Itoa(size), ".jpg")] = true
+			}
+		}
+	}
+	return referenced
+}
+
+// missingFiles retourne les références dont le fichier n'a pas été vu dans
+// le stockage. Chaque absence est confirmée : le fichier a pu être écrit
+// pendant le parcours. Les morceaux d'envoi, temporaires, sont ignorés
+func missingFiles(ctx context.Context, references []Reference, existing map[string]bool) ([]Reference, error) {
+	var missing []Reference
+	for _, ref := range references {
+		if existing[ref.Key] || ref.Source == SourceUploadParts {
+			continue
+		}
+		_, err := storage.Default.Stat(ctx, ref.Key)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, storage.ErrNotFound) && !errors.Is(err, storage.ErrInvalidKey) {
+			return nil, err
+		}
+		missing = append(missing, ref)
+	}
+	return missing, nil
+}
+
+// danglingKeys supprime les clés de chiffrement dont le fichier n'existe pas
+// et n'est pas référencé : la clé est enregistrée avant l'écriture du fichier
+func danglingKeys(ctx context.Context, db *sql.DB, referenced, existing map[string]bool, dryRun bool) (int, error) {
+	rows, err := db.QueryContext(ctx,
+		"SELECT storage_key FROM file_keys WHERE created_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'",
+		int64(GracePeriod.Seconds()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var dangling []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !existing[key] && !referenced[key] {
+			dangling = append(dangling, key)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if dryRun || len(dangling) == 0 {
+		return len(dangling), nil
+	}
+
+	_, err = db.ExecContext(ctx, "DELETE FROM file_keys WHERE storage_key = ANY($1)", pq.Array(dangling))
+	return len(dangling), err
+}
+
+// flagMissing remet en attente les aperçus manquants, que le générateur
+// refait, et remplace le contenu de missing_files par les autres absences ;
+// detected_at est conservé pour une absence déjà relevée
+func flagMissing(ctx context.Context, db *sql.DB, missing []Reference) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var sources, keys []string
+	var ids []int64
+	for _, ref := range missing {
+		if ref.Source == SourceThumbnails {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE documents SET thumbnail_key = NULL, thumbnail_status = $3, thumbnail_attempts = 0, thumbnail_updated_at = CURRENT_TIMESTAMP
+				WHERE id = $1 AND thumbnail_key = $2`,
+				ref.RecordID, ref.Key, thumbnails.StatusPending,
+			)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		sources = append(sources, ref.Source)
+		ids = append(ids, int64(ref.RecordID))
+		keys = append(keys, ref.Key)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM missing_files m
+		WHERE NOT EXISTS (
+			SELECT 1 FROM unnest($1::text[], $2::int[], $3::text[]) AS f(source, record_id, storage_key)
+			WHERE f.source = m.source AND f.record_id = m.record_id AND f.storage_key = m.storage_key
+		)`,
+		pq.Array(sources), pq.Array(ids), pq.Array(keys),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO missing_files (source, record_id, storage_key)
+		SELECT * FROM unnest($1::text[], $2::int[], $3::text[])
+		ON CONFLICT DO NOTHING`,
+		pq.Array(sources), pq.Array(ids), pq.Array(keys),
+	)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	thumbnails.Notify()
+	return nil
+}
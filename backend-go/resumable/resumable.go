@@ -0,0 +1,181 @@
+package resumable
+
+import (
+	"backend-go/encryption"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// En-têtes du protocole tus 1.0 (https://tus.io/protocols/resumable-upload)
+const (
+	Version     = "1.0.0"
+	Extensions  = "creation,expiration,termination"
+	ContentType = "application/offset+octet-stream"
+)
+
+// Statuts d'un envoi (colonne document_uploads.status)
+const (
+	StatusUploading  = "uploading"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// TTL est la durée pendant laquelle un envoi interrompu peut être repris
+var TTL = 24 * time.Hour
+
+var ErrInvalidMetadata = errors.New("Upload-Metadata invalide")
+
+// Init lit RESUMABLE_UPLOAD_TTL, une durée Go ("24h")
+func Init() {
+	value := os.Getenv("RESUMABLE_UPLOAD_TTL")
+	if value == "" {
+		return
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Fatalf("RESUMABLE_UPLOAD_TTL invalide: %s", value)
+	}
+	TTL = ttl
+}
+
+// NewID retourne l'identifiant aléatoire d'un envoi, qui figure dans son URL
+func NewID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ParseMetadata lit l'en-tête Upload-Metadata : des paires "clé valeur"
+// séparées par des virgules, valeurs encodées en base64, éventuellement absentes
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" || strings.ContainsAny(key, " ,") {
+			return nil, ErrInvalidMetadata
+		}
+		if _, exists := metadata[key]; exists {
+			return nil, ErrInvalidMetadata
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, ErrInvalidMetadata
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// DeleteParts supprime les morceaux reçus d'un envoi, fichiers et lignes
+func DeleteParts(ctx context.Context, db *sql.DB, uploadID string) error {
+	rows, err := db.QueryContext(ctx, "DELETE FROM document_upload_parts WHERE upload_id = $1 RETURNING storage_key", uploadID)
+	if err != nil {
+		return err
+	}
+	keys, err := scanKeys(rows)
+	if err != nil {
+		return err
+	}
+	deleteFiles(ctx, db, keys)
+	return nil
+}
+
+// Start supprime les envois expirés, au démarrage puis toutes les every
+func Start(db *sql.DB, every time.Duration) {
+	go func() {
+		for {
+			purged, err := PurgeExpired(context.Background(), db)
+			if err != nil {
+				log.Printf("Erreur purge des envois expirés: %v", err)
+			} else if purged > 0 {
+				log.Printf("%d envoi(s) expiré(s) supprimé(s)", purged)
+			}
+			time.Sleep(every)
+		}
+	}()
+}
+
+// PurgeExpired supprime les envois expirés, terminés ou non, et les morceaux
+// reçus. Retourne le nombre d'envois supprimés
+func PurgeExpired(ctx context.Context, db *sql.DB) (int, error) {
+	return purge(ctx, db, "upload_expires_at < CURRENT_TIMESTAMP")
+}
+
+// Terminate supprime un envoi de l'utilisateur et ses morceaux, sauf pendant
+// la création du document. Retourne false si l'envoi n'existe pas ou est en
+// cours de traitement
+func Terminate(ctx context.Context, db *sql.DB, uploadID string, userID int) (bool, error) {
+	n, err := purge(ctx, db, "id = $1 AND user_id = $2 AND status <> $3", uploadID, userID, StatusProcessing)
+	return n > 0, err
+}
+
+// purge supprime les envois qui vérifient condition puis les fichiers de leurs
+// morceaux. Les lignes sont effacées en premier (cascade sur les morceaux) ;
+// les requêtes d'un WITH voient l'état d'avant la suppression
+func purge(ctx context.Context, db *sql.DB, condition string, args ...interface{}) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH purged AS (
+			DELETE FROM document_uploads WHERE `+condition+` RETURNING id
+		)
+		SELECT purged.id, p.storage_key
+		FROM purged LEFT JOIN document_upload_parts p ON p.upload_id = purged.id`, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	uploads := map[string]bool{}
+	var keys []string
+	for rows.Next() {
+		var id string
+		var key sql.NullString
+		if err := rows.Scan(&id, &key); err != nil {
+			return 0, err
+		}
+		uploads[id] = true
+		if key.Valid {
+			keys = append(keys, key.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleteFiles(ctx, db, keys)
+	return len(uploads), nil
+}
+
+func scanKeys(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func deleteFiles(ctx context.Context, db *sql.DB, keys []string) {
+	for _, key := range keys {
+		if err := encryption.Delete(ctx, db, key); err != nil {
+			log.Printf("Erreur suppression morceau d'envoi %s: %v", key, err)
+		}
+	}
+}
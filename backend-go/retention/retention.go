@@ -0,0 +1,166 @@
+package retention
+
+import (
+	"backend-go/encryption"
+	"backend-go/storage"
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentRetention est le délai entre la suppression d'un document et la
+// purge de ses fichiers ; le document reste restaurable pendant ce délai
+var DocumentRetention = 30 * 24 * time.Hour
+
+// Init lit DOCUMENT_RETENTION : un nombre de jours ("30d") ou une durée Go ("720h")
+func Init() {
+	value := os.Getenv("DOCUMENT_RETENTION")
+	if value == "" {
+		return
+	}
+	retention, err := ParseDuration(value)
+	if err != nil || retention < 0 {
+		log.Fatalf("DOCUMENT_RETENTION invalide: %s", value)
+	}
+	DocumentRetention = retention
+}
+
+// ParseDuration accepte un nombre de jours ("30d") en plus des durées Go
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// PurgedDocument est un document supprimé définitivement, avec les clés de
+// ses fichiers : toutes ses versions et son aperçu
+type PurgedDocument struct {
+	ID   int
+	Keys []string
+}
+
+// Report résume une purge
+type Report struct {
+	Documents []PurgedDocument
+	Files     int
+	Failed    int // fichiers restés dans le stockage, repris par la réconciliation du stockage
+}
+
+// Start purge les documents supprimés depuis plus de DocumentRetention, au
+// démarrage puis toutes les every
+func Start(db *sql.DB, every time.Duration) {
+	go func() {
+		for {
+			report, err := PurgeDeletedDocuments(context.Background(), db, false)
+			if err != nil {
+				log.Printf("Erreur purge des documents supprimés: %v", err)
+			} else if len(report.Documents) > 0 {
+				log.Printf("Purge: %d document(s) supprimé(s) définitivement, %d fichier(s) effacé(s), %d en échec",
+					len(report.Documents), report.Files, report.Failed)
+			}
+			time.Sleep(every)
+		}
+	}()
+}
+
+// PurgeDeletedDocuments supprime définitivement les documents dont la
+// rétention est écoulée. La ligne est effacée avant les fichiers : un
+// document n'est jamais visible sans ses fichiers. En dryRun, rien n'est
+// supprimé et le rapport liste ce qui le serait
+func PurgeDeletedDocuments(ctx context.Context, db *sql.DB, dryRun bool) (Report, error) {
+	var report Report
+	retention := int64(DocumentRetention.Seconds())
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT id FROM documents
+		WHERE deleted_at IS NOT NULL AND deleted_at < CURRENT_TIMESTAMP - $1 * INTERVAL '1 second'
+		ORDER BY deleted_at, id`, retention)
+	if err != nil {
+		return report, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return report, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	for _, id := range ids {
+		keys, err := purgeDocument(ctx, db, id, retention, dryRun)
+		if err != nil {
+			return report, err
+		}
+		// Document restauré entre-temps
+		if keys == nil {
+			continue
+		}
+		report.Documents = append(report.Documents, PurgedDocument{ID: id, Keys: keys})
+
+		for _, key := range keys {
+			if dryRun {
+				report.Files++
+				continue
+			}
+			if err := encryption.Delete(ctx, db, key); err != nil {
+				log.Printf("Purge du document %d: suppression de %s impossible: %v", id, key, err)
+				report.Failed++
+				continue
+			}
+			report.Files++
+		}
+	}
+	return report, nil
+}
+
+// purgeDocument supprime la ligne d'un document (ses versions suivent par
+// cascade) et retourne les clés de ses fichiers, ou nil s'il n'est plus à
+// purger. Les requêtes d'un WITH voient toutes l'état d'avant la suppression :
+// les versions sont lues dans la même instruction
+func purgeDocument(ctx context.Context, db *sql.DB, id int, retention int64, dryRun bool) ([]string, error) {
+	condition := `WHERE id = $1 AND deleted_at IS NOT NULL AND deleted_at < CURRENT_TIMESTAMP - $2 * INTERVAL '1 second'`
+	purged := `DELETE FROM documents ` + condition + ` RETURNING id, file_path, thumbnail_key`
+	if dryRun {
+		purged = `SELECT id, file_path, thumbnail_key FROM documents ` + condition
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		WITH purged AS (`+purged+`)
+		SELECT file_path FROM purged
+		UNION
+		SELECT thumbnail_key FROM purged WHERE thumbnail_key IS NOT NULL
+		UNION
+		SELECT v.file_path FROM document_versions v JOIN purged p ON p.id = v.document_id`,
+		id, retention,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		keys = append(keys, storage.KeyFromPath(path))
+	}
+	return keys, rows.Err()
+}
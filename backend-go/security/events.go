@@ -0,0 +1,53 @@
+package security
+
+import (
+	"backend-go/database"
+	"encoding/json"
+	"log"
+)
+
+// Types d'événements du journal de sécurité
+const (
+	EventLoginFailed       = "login_failed"
+	EventLoginThrottled    = "login_throttled"
+	EventAccountLocked     = "account_locked"
+	EventIPLocked          = "ip_locked"
+	EventResetTokenInvalid = "reset_token_invalid"
+	EventResetThrottled    = "reset_password_throttled"
+	EventPasswordResetDone = "password_reset"
+	EventPasswordChanged   = "password_changed"
+	EventTwoFactorEnabled  = "2fa_enabled"
+	EventTwoFactorDisabled = "2fa_disabled"
+	EventTwoFactorFailed   = "2fa_failed"
+	EventRoleChanged       = "role_changed"
+)
+
+// LogEvent écrit un événement dans le journal de sécurité. L'identifiant
+// utilisateur peut être nil lorsque le compte visé n'est pas connu
+func LogEvent(eventType string, userID *int, ipAddress string, details map[string]interface{}) {
+	var detailsJSON []byte
+	if details != nil {
+		var err error
+		detailsJSON, err = json.Marshal(details)
+		if err != nil {
+			log.Printf("Erreur sérialisation événement de sécurité: %v", err)
+		}
+	}
+
+	log.Printf("🔒 Sécurité: %s ip=%s details=%s", eventType, ipAddress, string(detailsJSON))
+
+	_, err := database.DB.Exec(
+		"INSERT INTO security_events (event_type, user_id, ip_address, details) VALUES ($1, $2, $3, $4)",
+		eventType, userID, ipAddress, nullableJSON(detailsJSON),
+	)
+	if err != nil {
+		log.Printf("Erreur écriture journal de sécurité: %v", err)
+	}
+}
+
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
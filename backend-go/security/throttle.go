@@ -0,0 +1,186 @@
+package security
+
+import (
+	"backend-go/database"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Limiter compte les échecs par clé (adresse IP, compte...) dans Postgres pour
+// que le blocage soit partagé entre toutes les répliques. Après FreeAttempts
+// échecs, chaque nouvel échec impose une attente qui double jusqu'à MaxDelay ;
+// au-delà de MaxFailures la clé est verrouillée pendant LockoutDuration
+type Limiter struct {
+	Scope           string
+	FreeAttempts    int
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	// Les échecs plus anciens que Window sont oubliés
+	Window time.Duration
+}
+
+// Limiteurs utilisés par les handlers d'authentification
+var (
+	LoginByAccount = &Limiter{
+		Scope:           "login_account",
+		FreeAttempts:    3,
+		MaxFailures:     10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	LoginByIP = &Limiter{
+		Scope:           "login_ip",
+		FreeAttempts:    10,
+		MaxFailures:     50,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+	TwoFactorByUser = &Limiter{
+		Scope:           "2fa_user",
+		FreeAttempts:    3,
+		MaxFailures:     10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+	ResetPasswordByIP = &Limiter{
+		Scope:           "reset_password_ip",
+		FreeAttempts:    5,
+		MaxFailures:     20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// Attempt réserve une tentative pour chaque clé avant sa vérification : elle
+// compte d'emblée comme un échec, et impose l'attente correspondante aux
+// tentatives suivantes, tant que Reset ou Release ne l'annule pas. Les lignes
+// des clés sont verrouillées le temps de la réservation : des requêtes
+// simultanées ne peuvent pas toutes passer avant que le blocage soit écrit.
+// Retourne l'attente restante la plus longue si une clé est bloquée ; la
+// tentative est alors refusée sans être comptée. locked indique que la
+// tentative réservée fait atteindre MaxFailures à une clé
+func (l *Limiter) Attempt(keys ...string) (wait time.Duration, locked bool, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	// Clés triées : deux réservations des mêmes clés les verrouillent dans le
+	// même ordre
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	failures := make([]int, len(sorted))
+	for i, key := range sorted {
+		_, err = tx.Exec(
+			"INSERT INTO auth_throttles (scope, key, failures, last_failure_at) VALUES ($1, $2, 0, CURRENT_TIMESTAMP) ON CONFLICT (scope, key) DO NOTHING",
+			l.Scope, key,
+		)
+		if err != nil {
+			return 0, false, err
+		}
+
+		var seconds float64
+		var expired bool
+		err = tx.QueryRow(`
+			SELECT failures,
+				last_failure_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second',
+				COALESCE(EXTRACT(EPOCH FROM (locked_until - CURRENT_TIMESTAMP)), 0)
+			FROM auth_throttles
+			WHERE scope = $1 AND key = $2
+			FOR UPDATE`,
+			l.Scope, key, int64(l.Window.Seconds()),
+		).Scan(&failures[i], &expired, &seconds)
+		if err != nil {
+			return 0, false, err
+		}
+		if remaining := roundUp(seconds); remaining > wait {
+			wait = remaining
+		}
+		// Les échecs plus anciens que Window sont oubliés
+		if expired {
+			failures[i] = 0
+		}
+	}
+	if wait > 0 {
+		return wait, false, nil
+	}
+
+	for i, key := range sorted {
+		failures[i]++
+		delay := l.delayFor(failures[i])
+		if failures[i] == l.MaxFailures {
+			locked = true
+		}
+		_, err = tx.Exec(`
+			UPDATE auth_throttles SET
+				failures = $3,
+				last_failure_at = CURRENT_TIMESTAMP,
+				locked_until = CASE WHEN $4 > 0 THEN CURRENT_TIMESTAMP + $4 * INTERVAL '1 second' END
+			WHERE scope = $1 AND key = $2`,
+			l.Scope, key, failures[i], int64(delay.Seconds()),
+		)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	return 0, locked, tx.Commit()
+}
+
+// Release annule la tentative réservée par Attempt après un succès, sans
+// effacer les autres échecs des clés : une adresse IP ne retrouve pas ses
+// essais parce qu'un de ses comptes s'est connecté
+func (l *Limiter) Release(keys ...string) error {
+	_, err := database.DB.Exec(
+		"UPDATE auth_throttles SET failures = GREATEST(failures - 1, 0) WHERE scope = $1 AND key = ANY($2)",
+		l.Scope, pq.Array(keys),
+	)
+	return err
+}
+
+// Reset efface les échecs et le blocage des clés après une tentative réussie,
+// tentative réservée comprise
+func (l *Limiter) Reset(keys ...string) error {
+	_, err := database.DB.Exec(
+		"DELETE FROM auth_throttles WHERE scope = $1 AND key = ANY($2)",
+		l.Scope, pq.Array(keys),
+	)
+	return err
+}
+
+func (l *Limiter) delayFor(failures int) time.Duration {
+	if failures >= l.MaxFailures {
+		return l.LockoutDuration
+	}
+	if failures <= l.FreeAttempts {
+		return 0
+	}
+
+	exponent := float64(failures - l.FreeAttempts - 1)
+	delay := time.Duration(float64(l.BaseDelay) * math.Pow(2, exponent))
+	if delay > l.MaxDelay || delay <= 0 {
+		return l.MaxDelay
+	}
+	return delay
+}
+
+func roundUp(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(seconds)) * time.Second
+}
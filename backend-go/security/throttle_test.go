@@ -0,0 +1,154 @@
+package security
+
+import (
+	"backend-go/database"
+	"backend-go/migrations"
+	"database/sql"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func TestDelayFor(t *testing.T) {
+	l := &Limiter{
+		FreeAttempts:    3,
+		MaxFailures:     10,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutDuration: 15 * time.Minute,
+	}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{8, 16 * time.Second},
+		{9, 30 * time.Second},
+		{10, 15 * time.Minute},
+		{50, 15 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := l.delayFor(test.failures); got != test.want {
+			t.Errorf("delayFor(%d) = %s, attendu %s", test.failures, got, test.want)
+		}
+	}
+}
+
+// newTestLimiter ouvre la base TEST_DATABASE_URL, migrée au besoin, et
+// retourne un limiteur dont la portée est propre au test
+func newTestLimiter(t *testing.T) *Limiter {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL non défini : test PostgreSQL ignoré")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+
+	l := &Limiter{
+		Scope:           "test_" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		FreeAttempts:    3,
+		MaxFailures:     5,
+		BaseDelay:       time.Minute,
+		MaxDelay:        time.Minute,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM auth_throttles WHERE scope = $1", l.Scope)
+		database.DB = previous
+		db.Close()
+	})
+	return l
+}
+
+func TestAttemptConcurrentBurst(t *testing.T) {
+	l := newTestLimiter(t)
+
+	// Une rafale de tentatives simultanées : seules les FreeAttempts+1
+	// premières passent, la suivante écrit le blocage
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, _, err := l.Attempt("compte")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != l.FreeAttempts+1 {
+		t.Errorf("%d tentatives acceptées, attendu %d", allowed, l.FreeAttempts+1)
+	}
+
+	// Un succès efface le blocage
+	if err := l.Reset("compte"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _, err := l.Attempt("compte"); err != nil || wait != 0 {
+		t.Errorf("après Reset : attente %s, %v", wait, err)
+	}
+}
+
+func TestAttemptLockoutAndRelease(t *testing.T) {
+	l := newTestLimiter(t)
+	l.BaseDelay, l.MaxDelay = 0, 0
+
+	// Sans délai progressif, la clé n'est bloquée qu'à MaxFailures
+	for i := 1; i <= l.MaxFailures; i++ {
+		wait, locked, err := l.Attempt("ip")
+		if err != nil || wait != 0 {
+			t.Fatalf("tentative %d : attente %s, %v", i, wait, err)
+		}
+		if locked != (i == l.MaxFailures) {
+			t.Errorf("tentative %d : locked %v", i, locked)
+		}
+		// Les succès n'annulent que leur propre tentative
+		if i < l.MaxFailures-1 {
+			if err := l.Release("ip"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := l.Attempt("ip"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wait, locked, err := l.Attempt("ip")
+	if err != nil || wait <= 0 || locked {
+		t.Errorf("clé verrouillée : attente %s, locked %v, %v", wait, locked, err)
+	}
+
+	// Une tentative refusée n'est pas comptée pour les autres clés
+	if wait, _, err := l.Attempt("autre", "ip"); err != nil || wait <= 0 {
+		t.Fatalf("clés mêlées : attente %s, %v", wait, err)
+	}
+	var failures int
+	err = database.DB.QueryRow("SELECT failures FROM auth_throttles WHERE scope = $1 AND key = 'autre'", l.Scope).Scan(&failures)
+	if err != sql.ErrNoRows && (err != nil || failures != 0) {
+		t.Errorf("clé non bloquée comptée : %d, %v", failures, err)
+	}
+}
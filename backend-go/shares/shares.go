@@ -0,0 +1,138 @@
+package shares
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Durées des liens de partage
+const (
+	DefaultTTL = 7 * 24 * time.Hour
+	MaxTTL     = 30 * 24 * time.Hour
+	MinTTL     = 5 * time.Minute
+)
+
+// SingleUseGrace laisse un lien à usage unique ouvert quelques minutes après
+// le premier accès, depuis la même adresse IP : les lecteurs PDF téléchargent
+// le fichier en plusieurs requêtes (Range)
+const SingleUseGrace = 2 * time.Minute
+
+// Statuts d'un partage ; un accès refusé est journalisé avec le statut en cause
+const (
+	StatusActive  = "active"
+	StatusExpired = "expired"
+	StatusUsed    = "used"
+	StatusRevoked = "revoked"
+
+	OutcomeOK = "ok"
+)
+
+var (
+	ErrInvalidToken = errors.New("lien de partage invalide")
+	ErrExpired      = errors.New("lien de partage expiré")
+)
+
+// minSecretLength est la taille minimale de SHARE_LINK_SECRET, en octets
+const minSecretLength = 32
+
+var (
+	secret  []byte
+	baseURL = "https://saveyourcar.fr/shared"
+)
+
+var encoding = base64.RawURLEncoding
+
+// Init lit SHARE_LINK_SECRET, la clé HMAC des liens de partage, et
+// SHARE_BASE_URL. Sans secret, une clé aléatoire est générée : les liens ne
+// survivent alors pas à un redémarrage et ne passent pas d'une réplique à l'autre
+func Init() {
+	if value := os.Getenv("SHARE_BASE_URL"); value != "" {
+		baseURL = strings.TrimRight(value, "/")
+	}
+
+	value := os.Getenv("SHARE_LINK_SECRET")
+	if len(value) >= minSecretLength {
+		secret = []byte(value)
+		return
+	}
+	if value != "" {
+		log.Fatalf("SHARE_LINK_SECRET doit contenir au moins %d caractères", minSecretLength)
+	}
+
+	log.Println("⚠️  SHARE_LINK_SECRET non configuré : clé temporaire, les liens de partage seront invalidés au redémarrage")
+	secret = make([]byte, minSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Erreur génération clé des liens de partage: %v", err)
+	}
+}
+
+// NewTokenID retourne l'identifiant aléatoire d'un partage, enregistré en base
+func NewTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Token construit le jeton public "<token_id>.<expiration>.<signature>" : il
+// n'est pas conservé en base et peut être recalculé pour réafficher le lien
+func Token(tokenID string, expiresAt time.Time) string {
+	payload := tokenID + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + encoding.EncodeToString(sign(payload))
+}
+
+// URL retourne le lien public d'un partage
+func URL(tokenID string, expiresAt time.Time) string {
+	return baseURL + "/" + Token(tokenID, expiresAt)
+}
+
+// Verify vérifie la signature et l'expiration d'un jeton et retourne
+// l'identifiant du partage. La base n'est consultée qu'ensuite, pour les
+// jetons authentiques
+func Verify(token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(parts[0]+"."+parts[1])) {
+		return "", ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if now.Unix() >= expiresAt {
+		return parts[0], ErrExpired
+	}
+	return parts[0], nil
+}
+
+func sign(payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Status retourne le statut d'un partage à l'instant now
+func Status(expiresAt time.Time, revokedAt *time.Time, singleUse bool, firstUsedAt *time.Time, now time.Time) string {
+	switch {
+	case revokedAt != nil:
+		return StatusRevoked
+	case !now.Before(expiresAt):
+		return StatusExpired
+	case singleUse && firstUsedAt != nil && now.After(firstUsedAt.Add(SingleUseGrace)):
+		return StatusUsed
+	}
+	return StatusActive
+}
@@ -0,0 +1,140 @@
+package shares
+
+import (
+	"backend-go/models"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func withSecret(t *testing.T, value string) {
+	t.Helper()
+	previous := secret
+	secret = []byte(value)
+	t.Cleanup(func() { secret = previous })
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	withSecret(t, testSecret)
+	now := time.Unix(1700000000, 0)
+
+	tokenID, err := NewTokenID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Verify(Token(tokenID, now.Add(time.Hour)), now)
+	if err != nil || got != tokenID {
+		t.Fatalf("Verify = %q, %v ; attendu %q", got, err, tokenID)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	withSecret(t, testSecret)
+	now := time.Unix(1700000000, 0)
+	expiresAt := now.Add(time.Hour)
+	token := Token("0123456789abcdef0123456789abcdef", expiresAt)
+	parts := strings.Split(token, ".")
+
+	// Signature d'un autre identifiant ou d'une autre expiration
+	otherID := Token("fedcba9876543210fedcba9876543210", expiresAt)
+	later := strconv.FormatInt(expiresAt.Add(30*24*time.Hour).Unix(), 10)
+
+	tampered := map[string]string{
+		"identifiant modifié":       "fedcba9876543210fedcba9876543210." + parts[1] + "." + parts[2],
+		"expiration prolongée":      parts[0] + "." + later + "." + parts[2],
+		"signature d'un autre lien": parts[0] + "." + parts[1] + "." + strings.Split(otherID, ".")[2],
+		"signature tronquée":        parts[0] + "." + parts[1] + "." + parts[2][:len(parts[2])-2],
+		"signature absente":         parts[0] + "." + parts[1] + ".",
+		"signature non base64":      parts[0] + "." + parts[1] + ".!!!",
+		"partie en trop":            token + ".x",
+		"partie manquante":          parts[0] + "." + parts[1],
+		"jeton vide":                "",
+		"expiration non numérique":  parts[0] + ".abc." + parts[2],
+	}
+	for name, value := range tampered {
+		if _, err := Verify(value, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s : erreur %v, attendu ErrInvalidToken", name, err)
+		}
+	}
+
+	// Un jeton signé avec une autre clé est refusé
+	withSecret(t, "une autre clé de partage de 32 octets")
+	if _, err := Verify(token, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("autre clé : erreur %v, attendu ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyExpiry(t *testing.T) {
+	withSecret(t, testSecret)
+	expiresAt := time.Unix(1700000000, 0)
+	tokenID := "0123456789abcdef0123456789abcdef"
+	token := Token(tokenID, expiresAt)
+
+	if _, err := Verify(token, expiresAt.Add(-time.Second)); err != nil {
+		t.Errorf("avant expiration : %v", err)
+	}
+	// L'identifiant est retourné avec ErrExpired pour journaliser l'accès refusé
+	for _, now := range []time.Time{expiresAt, expiresAt.Add(time.Second), expiresAt.Add(365 * 24 * time.Hour)} {
+		got, err := Verify(token, now)
+		if !errors.Is(err, ErrExpired) || got != tokenID {
+			t.Errorf("à %s : %q, %v ; attendu %q, ErrExpired", now.Sub(expiresAt), got, err, tokenID)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expiresAt := now.Add(time.Hour)
+	revokedAt := now.Add(-time.Minute)
+	justUsed := now.Add(-SingleUseGrace / 2)
+	usedLongAgo := now.Add(-SingleUseGrace - time.Second)
+
+	tests := []struct {
+		name        string
+		expiresAt   time.Time
+		revokedAt   *time.Time
+		singleUse   bool
+		firstUsedAt *time.Time
+		want        string
+	}{
+		{"actif", expiresAt, nil, false, nil, StatusActive},
+		{"expiré", now, nil, false, nil, StatusExpired},
+		{"révoqué", expiresAt, &revokedAt, false, nil, StatusRevoked},
+		{"révoqué et expiré", now.Add(-time.Hour), &revokedAt, false, nil, StatusRevoked},
+		{"usage unique jamais ouvert", expiresAt, nil, true, nil, StatusActive},
+		{"usage unique dans le délai de grâce", expiresAt, nil, true, &justUsed, StatusActive},
+		{"usage unique utilisé", expiresAt, nil, true, &usedLongAgo, StatusUsed},
+		{"usages multiples", expiresAt, nil, false, &usedLongAgo, StatusActive},
+	}
+	for _, test := range tests {
+		if got := Status(test.expiresAt, test.revokedAt, test.singleUse, test.firstUsedAt, now); got != test.want {
+			t.Errorf("%s : %s, attendu %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRequestExpiresInBounds(t *testing.T) {
+	valid := func(seconds int) bool {
+		return binding.Validator.ValidateStruct(&models.DocumentShareRequest{ExpiresIn: &seconds}) == nil
+	}
+
+	min, max := int(MinTTL.Seconds()), int(MaxTTL.Seconds())
+	if !valid(min) || !valid(max) {
+		t.Errorf("les bornes %d et %d doivent être acceptées", min, max)
+	}
+	// Hors bornes, ou assez grand pour déborder time.Duration une fois en secondes
+	for _, seconds := range []int{0, -1, min - 1, max + 1, 1 << 40, int(^uint(0) >> 1)} {
+		if valid(seconds) {
+			t.Errorf("expires_in %d accepté", seconds)
+		}
+	}
+	if binding.Validator.ValidateStruct(&models.DocumentShareRequest{}) != nil {
+		t.Error("expires_in absent refusé")
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NewKey retourne une clé aléatoire "prefix/<32 caractères hexadécimaux><ext>".
+// Le nom fourni par le client n'entre jamais dans la clé : il ne peut ni
+// sortir du dossier ni écraser un autre fichier
+func NewKey(prefix, ext string) string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic("storage: crypto/rand indisponible: " + err.Error())
+	}
+	return prefix + "/" + hex.EncodeToString(buf) + ext
+}
+
+// VariantKey retourne la clé d'une déclinaison d'un fichier, par exemple
+// "profile_pictures/ab12_256.jpg" pour la variante 256 de "profile_pictures/ab12.png"
+func VariantKey(key, variant, ext string) string {
+	if i := strings.LastIndexAny(key, "./"); i >= 0 && key[i] == '.' {
+		key = key[:i]
+	}
+	return key + "_" + variant + ext
+}
+
+// maxFileNameLength borne le nom d'origine conservé en base (colonne VARCHAR(255))
+const maxFileNameLength = 255
+
+// CleanFileName nettoie le nom d'origine d'un fichier, conservé uniquement
+// comme métadonnée : caractères de contrôle et chemins retirés, longueur bornée
+func CleanFileName(name, fallback string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." {
+		return fallback
+	}
+	return name
+}
+
+// ContentDisposition construit l'en-tête Content-Disposition selon la RFC 6266 :
+// filename contient une version ASCII pour les anciens clients et filename*
+// le nom exact encodé en UTF-8 (RFC 5987)
+func ContentDisposition(disposition, fileName string) string {
+	if fileName == "" {
+		return disposition
+	}
+
+	var fallback strings.Builder
+	for _, r := range fileName {
+		if r < 0x20 || r > 0x7E || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+
+	header := disposition + `; filename="` + fallback.String() + `"`
+	if fallback.String() != fileName {
+		header += "; filename*=UTF-8''" + encodeExtValue(fileName)
+	}
+	return header
+}
+
+// encodeExtValue encode en pourcentage tout ce qui n'est pas un attr-char (RFC 5987)
+func encodeExtValue(value string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0F])
+	}
+	return b.String()
+}
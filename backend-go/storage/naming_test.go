@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanFileName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"facture.pdf", "facture.pdf"},
+		{"  carte grise.pdf  ", "carte grise.pdf"},
+		{"Relevé d'entretien été.pdf", "Relevé d'entretien été.pdf"},
+		{"🚗 assurance.pdf", "🚗 assurance.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\moi\Documents\facture.pdf`, "facture.pdf"},
+		{"dossier/sous\\dossier/photo.jpg", "photo.jpg"},
+		{"fac\x00ture\r\n.pdf", "facture.pdf"},
+		{"bip\x07\x1b[31m.pdf", "bip[31m.pdf"},
+		{"suppr\x7f\u0085.pdf", "suppr.pdf"},
+		{"invalide\xff\xfe.pdf", "invalide.pdf"},
+		{`guillemets "et" \antislash`, "antislash"},
+		{"", "document"},
+		{"   ", "document"},
+		{".", "document"},
+		{"..", "document"},
+		{"photos/", "document"},
+		{"\x00\x01", "document"},
+	}
+	for _, test := range tests {
+		if got := CleanFileName(test.name, "document"); got != test.want {
+			t.Errorf("CleanFileName(%q) = %q, attendu %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCleanFileNameTruncation(t *testing.T) {
+	// Chaque "é" occupe deux octets : la coupe à 255 octets tomberait au
+	// milieu d'un caractère
+	long := strings.Repeat("é", 200) + ".pdf"
+	got := CleanFileName(long, "document")
+	if len(got) != 254 || !utf8.ValidString(got) || got != strings.Repeat("é", 127) {
+		t.Errorf("CleanFileName = %d octets, valide %v", len(got), utf8.ValidString(got))
+	}
+
+	// Émojis de quatre octets
+	got = CleanFileName(strings.Repeat("🚗", 100), "document")
+	if len(got) != 252 || !utf8.ValidString(got) {
+		t.Errorf("CleanFileName = %d octets, valide %v", len(got), utf8.ValidString(got))
+	}
+
+	exact := strings.Repeat("a", maxFileNameLength)
+	if got := CleanFileName(exact, "document"); got != exact {
+		t.Errorf("nom de 255 octets tronqué à %d", len(got))
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition, fileName, want string
+	}{
+		{"attachment", "", "attachment"},
+		{"attachment", "facture.pdf", `attachment; filename="facture.pdf"`},
+		{"inline", "carte grise (2024).pdf", `inline; filename="carte grise (2024).pdf"`},
+		{
+			"attachment", `mon "devis".pdf`,
+			`attachment; filename="mon _devis_.pdf"; filename*=UTF-8''mon%20%22devis%22.pdf`,
+		},
+		{
+			"attachment", `a\b.pdf`,
+			`attachment; filename="a_b.pdf"; filename*=UTF-8''a%5Cb.pdf`,
+		},
+		{
+			"attachment", "Relevé été.pdf",
+			`attachment; filename="Relev_ _t_.pdf"; filename*=UTF-8''Relev%C3%A9%20%C3%A9t%C3%A9.pdf`,
+		},
+		{
+			"inline", "🚗.jpg",
+			`inline; filename="_.jpg"; filename*=UTF-8''%F0%9F%9A%97.jpg`,
+		},
+		{
+			"attachment", "ligne\r\nSet-Cookie: x.pdf",
+			`attachment; filename="ligne__Set-Cookie: x.pdf"; filename*=UTF-8''ligne%0D%0ASet-Cookie%3A%20x.pdf`,
+		},
+		// Un nom ASCII sans guillemet ni antislash n'a pas besoin de filename*
+		{"attachment", "100%;x'y*.pdf", `attachment; filename="100%;x'y*.pdf"`},
+		{
+			"attachment", "à 100%;x'y*.pdf",
+			`attachment; filename="_ 100%;x'y*.pdf"; filename*=UTF-8''%C3%A0%20100%25%3Bx%27y%2A.pdf`,
+		},
+	}
+	for _, test := range tests {
+		if got := ContentDisposition(test.disposition, test.fileName); got != test.want {
+			t.Errorf("ContentDisposition(%q, %q) =\n%s\nattendu\n%s", test.disposition, test.fileName, got, test.want)
+		}
+	}
+}
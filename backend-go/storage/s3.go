@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3Config décrit un bucket S3 ou compatible (MinIO, Scaleway, OVH...)
+type S3Config struct {
+	// Endpoint vide : AWS S3 dans la région Region
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle adresse le bucket dans le chemin (http://minio:9000/bucket/cle)
+	// plutôt que dans le nom d'hôte, nécessaire pour MinIO
+	PathStyle bool
+}
+
+// S3 stocke les fichiers dans un bucket via l'API REST S3, signée en SigV4
+type S3 struct {
+	bucket    string
+	pathStyle bool
+	endpoint  *url.URL
+	signer    signer
+	client    *http.Client
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID et S3_SECRET_ACCESS_KEY sont requis")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("S3_ENDPOINT invalide: %s", cfg.Endpoint)
+	}
+
+	return &S3{
+		bucket:    cfg.Bucket,
+		pathStyle: cfg.PathStyle,
+		endpoint:  endpoint,
+		signer: signer{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			region:          cfg.Region,
+			service:         "s3",
+		},
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// url retourne l'adresse d'une clé, ou du bucket si key est vide
+func (s *S3) url(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + key
+	if s.pathStyle {
+		path = "/" + s.bucket + path
+		if key == "" {
+			path = "/" + s.bucket
+		}
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.signer.signRequest(req, payloadHash, time.Now())
+	return s.client.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	// S3 exige la taille du corps : un flux de taille inconnue passe par un fichier temporaire
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "s3-upload-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if size, err = io.Copy(tmp, r); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r = tmp
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.url(key), r, size, unsignedPayload, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	if !validKey(key) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.url(key), nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, s3Error(resp)
+	}
+	return resp.Body, objectFromHeader(key, resp), nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*Object, error) {
+	if !validKey(key) {
+		return nil, ErrInvalidKey
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, s.url(key), nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp)
+	}
+	return objectFromHeader(key, resp), nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, s.url(key), nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (s *S3) List(ctx context.Context, prefix string, fn func(Object) error) error {
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		u := s.url("")
+		u.RawQuery = canonicalQuery(query)
+
+		resp, err := s.do(ctx, http.MethodGet, u, nil, 0, emptyPayloadHash, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Contents {
+			object := Object{
+				Key:         item.Key,
+				Size:        item.Size,
+				ContentType: mime.TypeByExtension(keyExt(item.Key)),
+				ModTime:     item.LastModified,
+			}
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// PresignGet signe une URL GET ; fileName et contentType sont imposés à la
+// réponse de S3 pour que le navigateur enregistre le fichier sous son nom d'origine
+func (s *S3) PresignGet(key string, expires time.Duration, fileName, contentType string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+
+	query := url.Values{}
+	if fileName != "" {
+		query.Set("response-content-disposition", ContentDisposition("attachment", fileName))
+	}
+	if contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+	return s.signer.presign(http.MethodGet, s.url(key), query, expires, time.Now()), nil
+}
+
+func objectFromHeader(key string, resp *http.Response) *Object {
+	object := &Object{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.ModTime = modTime
+	}
+	return object
+}
+
+// s3Error convertit une réponse d'erreur S3 (corps XML <Error>) en erreur Go
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("S3 %d %s: %s", resp.StatusCode, body.Code, body.Message)
+	}
+	return fmt.Errorf("S3: statut %d", resp.StatusCode)
+}
+
+func keyExt(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 && !strings.Contains(key[i:], "/") {
+		return key[i:]
+	}
+	return ""
+}
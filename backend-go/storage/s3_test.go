@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests du stockage S3 contre MinIO, par exemple le service de
+// docker-compose.yml :
+//
+//	docker compose up -d minio
+//	S3_TEST_ENDPOINT=http://localhost:9000 go test ./storage
+//
+// S3_TEST_ACCESS_KEY_ID et S3_TEST_SECRET_ACCESS_KEY valent minioadmin par
+// défaut ; le bucket S3_TEST_BUCKET (save-your-car-test) est créé au besoin
+
+func testEnv(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// newTestS3 retourne un client vers le bucket de test et un préfixe propre au
+// test, nettoyé à la fin
+func newTestS3(t *testing.T) (*S3, string) {
+	t.Helper()
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT non défini : tests MinIO ignorés")
+	}
+
+	s3, err := NewS3(S3Config{
+		Endpoint:        endpoint,
+		Region:          testEnv("S3_TEST_REGION", "us-east-1"),
+		Bucket:          testEnv("S3_TEST_BUCKET", "save-your-car-test"),
+		AccessKeyID:     testEnv("S3_TEST_ACCESS_KEY_ID", "minioadmin"),
+		SecretAccessKey: testEnv("S3_TEST_SECRET_ACCESS_KEY", "minioadmin"),
+		PathStyle:       true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	resp, err := s3.do(ctx, http.MethodPut, s3.url(""), nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		t.Fatalf("création du bucket : %v", err)
+	}
+	resp.Body.Close()
+	// 409 : le bucket existe déjà
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusConflict {
+		t.Fatalf("création du bucket : statut %d", resp.StatusCode)
+	}
+
+	prefix := "test-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "/"
+	t.Cleanup(func() {
+		var keys []string
+		s3.List(ctx, prefix, func(object Object) error {
+			keys = append(keys, object.Key)
+			return nil
+		})
+		for _, key := range keys {
+			s3.Delete(ctx, key)
+		}
+	})
+	return s3, prefix
+}
+
+func TestS3PutGetStat(t *testing.T) {
+	s3, prefix := newTestS3(t)
+	ctx := context.Background()
+	content := []byte("%PDF-1.4 carte grise")
+
+	for _, test := range []struct {
+		key  string
+		size int64
+	}{
+		{prefix + "documents/taille-connue.pdf", int64(len(content))},
+		// Taille inconnue : passage par un fichier temporaire
+		{prefix + "documents/taille-inconnue.pdf", -1},
+		// Espaces et caractères non ASCII encodés dans le chemin signé
+		{prefix + "documents/carte grise é+1.pdf", int64(len(content))},
+	} {
+		if err := s3.Put(ctx, test.key, bytes.NewReader(content), test.size, "application/pdf"); err != nil {
+			t.Fatalf("Put(%s): %v", test.key, err)
+		}
+
+		object, err := s3.Stat(ctx, test.key)
+		if err != nil {
+			t.Fatalf("Stat(%s): %v", test.key, err)
+		}
+		if object.Size != int64(len(content)) || object.ContentType != "application/pdf" || object.ModTime.IsZero() {
+			t.Errorf("Stat(%s) = %+v", test.key, object)
+		}
+
+		reader, object, err := s3.Get(ctx, test.key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", test.key, err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, content) || object.Size != int64(len(content)) {
+			t.Errorf("Get(%s) = %q (%d octets)", test.key, data, object.Size)
+		}
+	}
+
+	if _, err := s3.Stat(ctx, prefix+"absent.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat d'un fichier absent : %v", err)
+	}
+	if _, _, err := s3.Get(ctx, prefix+"absent.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get d'un fichier absent : %v", err)
+	}
+	if err := s3.Put(ctx, "../hors-bucket", bytes.NewReader(content), int64(len(content)), ""); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Put d'une clé invalide : %v", err)
+	}
+}
+
+func TestS3List(t *testing.T) {
+	s3, prefix := newTestS3(t)
+	ctx := context.Background()
+
+	want := []string{prefix + "a/1.jpg", prefix + "a/2.jpg", prefix + "b/3.jpg"}
+	for _, key := range want {
+		if err := s3.Put(ctx, key, strings.NewReader(key), int64(len(key)), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	err := s3.List(ctx, prefix, func(object Object) error {
+		if object.Size != int64(len(object.Key)) || object.ContentType != "image/jpeg" {
+			t.Errorf("List : %+v", object)
+		}
+		got = append(got, object.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("List(%s) = %v, attendu %v", prefix, got, want)
+	}
+
+	got = nil
+	if err := s3.List(ctx, prefix+"a/", func(object Object) error {
+		got = append(got, object.Key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("List(%sa/) = %v", prefix, got)
+	}
+
+	// Une erreur du callback interrompt le parcours
+	stop := errors.New("stop")
+	if err := s3.List(ctx, prefix, func(Object) error { return stop }); err != stop {
+		t.Errorf("List interrompu : %v", err)
+	}
+}
+
+func TestS3Delete(t *testing.T) {
+	s3, prefix := newTestS3(t)
+	ctx := context.Background()
+	key := prefix + "documents/a-supprimer.pdf"
+
+	if err := s3.Put(ctx, key, strings.NewReader("x"), 1, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s3.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat après Delete : %v", err)
+	}
+	// Supprimer un fichier absent n'est pas une erreur
+	if err := s3.Delete(ctx, key); err != nil {
+		t.Errorf("Delete d'un fichier absent : %v", err)
+	}
+}
+
+func TestS3PresignGet(t *testing.T) {
+	s3, prefix := newTestS3(t)
+	ctx := context.Background()
+	key := prefix + "documents/attestation assurance.pdf"
+	content := "%PDF-1.4 attestation"
+
+	if err := s3.Put(ctx, key, strings.NewReader(content), int64(len(content)), "application/octet-stream"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := s3.PresignGet(key, time.Minute, "Attestation été.pdf", "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(data) != content {
+		t.Fatalf("GET signé : statut %d, %q", resp.StatusCode, data)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Content-Type %s", got)
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != ContentDisposition("attachment", "Attestation été.pdf") {
+		t.Errorf("Content-Disposition %s", got)
+	}
+
+	// Une signature modifiée est refusée
+	tampered := signed[:len(signed)-1] + "0"
+	if strings.HasSuffix(signed, "0") {
+		tampered = signed[:len(signed)-1] + "1"
+	}
+	resp, err = http.Get(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET avec signature modifiée : statut %d", resp.StatusCode)
+	}
+
+	// Une URL expirée est refusée
+	expired, err := s3.PresignGet(key, time.Second, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	resp, err = http.Get(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET expiré : statut %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature AWS Signature Version 4, limitée à ce dont S3 a besoin :
+// en-tête Authorization pour les requêtes du serveur, paramètres de requête
+// pour les URL signées remises aux clients
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// emptyPayloadHash est l'empreinte SHA-256 d'un corps vide
+var emptyPayloadHash = hashHex(nil)
+
+type signer struct {
+	accessKeyID     string
+	secretAccessKey string
+	region          string
+	service         string
+}
+
+func (s signer) scope(date string) string {
+	return date + "/" + s.region + "/" + s.service + "/aws4_request"
+}
+
+func (s signer) signingKey(date string) []byte {
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// signRequest ajoute les en-têtes x-amz-* et Authorization à req
+func (s signer) signRequest(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(headers)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	signature := s.signature(amzDate, canonicalRequest)
+	req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+s.accessKeyID+"/"+s.scope(amzDate[:8])+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+}
+
+// presign retourne u complétée des paramètres de signature, valable expires
+func (s signer) presign(method string, u *url.URL, query url.Values, expires time.Duration, now time.Time) string {
+	amzDate := now.UTC().Format(amzDateFormat)
+
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", s.accessKeyID+"/"+s.scope(amzDate[:8]))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires.Seconds()), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+	rawQuery := canonicalQuery(query)
+
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(map[string]string{"host": u.Host})
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		rawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	signature := s.signature(amzDate, canonicalRequest)
+	return u.Scheme + "://" + u.Host + u.EscapedPath() + "?" + rawQuery + "&X-Amz-Signature=" + signature
+}
+
+func (s signer) signature(amzDate, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		s.scope(amzDate[:8]),
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+	return hex.EncodeToString(hmacSHA256(s.signingKey(amzDate[:8]), stringToSign))
+}
+
+func canonicalizeHeaders(headers map[string]string) (canonical, signed string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// canonicalQuery encode et trie les paramètres comme l'exige SigV4
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode encode tout sauf les caractères non réservés (RFC 3986), et le
+// slash si encodeSlash est faux
+func uriEncode(value string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0x0F])
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
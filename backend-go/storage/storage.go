@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound            = errors.New("fichier introuvable")
+	ErrInvalidKey          = errors.New("clé de fichier invalide")
+	ErrPresignNotSupported = errors.New("URL signée non supportée par ce stockage")
+)
+
+// Object décrit un fichier stocké
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage stocke les fichiers uploadés sous une clé relative, par exemple
+// "documents/1700000000_carte_grise.pdf"
+type Storage interface {
+	// Put enregistre le contenu de r ; size vaut -1 si la taille est inconnue
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get ouvre le fichier, à fermer par l'appelant
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete supprime le fichier ; un fichier absent n'est pas une erreur
+	Delete(ctx context.Context, key string) error
+	// List parcourt les fichiers dont la clé commence par prefix
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+	// PresignGet retourne une URL de téléchargement temporaire, ou
+	// ErrPresignNotSupported
+	PresignGet(key string, expires time.Duration, fileName, contentType string) (string, error)
+}
+
+// Default est le stockage utilisé par les handlers
+var Default Storage = NewLocal("uploads")
+
+// PresignTTL est la durée de validité des URL de téléchargement signées
+var PresignTTL = 15 * time.Minute
+
+// Init choisit le stockage d'après STORAGE_BACKEND : "local" (par défaut,
+// dossier LOCAL_STORAGE_DIR) ou "s3" (AWS S3, MinIO ou tout service compatible)
+func Init() {
+	if ttl, err := time.ParseDuration(os.Getenv("STORAGE_PRESIGN_TTL")); err == nil && ttl > 0 {
+		PresignTTL = ttl
+	}
+
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		Default = NewLocal(dir)
+		log.Printf("Stockage des fichiers: dossier local %s", dir)
+	case "s3":
+		pathStyle, _ := strconv.ParseBool(envOrDefault("S3_PATH_STYLE", "true"))
+		s3, err := NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          envOrDefault("S3_REGION", "us-east-1"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       pathStyle,
+		})
+		if err != nil {
+			log.Fatal("Erreur configuration stockage S3:", err)
+		}
+		Default = s3
+		log.Printf("Stockage des fichiers: bucket S3 %s", os.Getenv("S3_BUCKET"))
+	default:
+		log.Fatalf("STORAGE_BACKEND inconnu: %s (local ou s3)", backend)
+	}
+}
+
+// LegacyPrefix précède les chemins enregistrés avant l'introduction du stockage
+const LegacyPrefix = "uploads/"
+
+// KeyFromPath convertit un chemin historique ("uploads/documents/x.pdf") en clé
+func KeyFromPath(path string) string {
+	return strings.TrimPrefix(path, LegacyPrefix)
+}
+
+// validKey refuse les clés vides, absolues ou qui remontent l'arborescence
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,160 @@
+package thumbnails
+
+import (
+	"backend-go/encryption"
+	"backend-go/media"
+	"backend-go/storage"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+// Statuts de l'aperçu d'un document (colonne documents.thumbnail_status)
+const (
+	StatusPending     = "pending"
+	StatusProcessing  = "processing"
+	StatusReady       = "ready"
+	StatusFailed      = "failed"
+	StatusUnsupported = "unsupported"
+)
+
+// maxAttempts est le nombre d'essais avant de marquer un aperçu en échec
+const maxAttempts = 3
+
+// retryAfter est le délai avant de reprendre un aperçu en cours : échec
+// temporaire (stockage indisponible) ou réplique arrêtée pendant le traitement
+const retryAfter = 10 * time.Minute
+
+var wake = make(chan struct{}, 1)
+
+// Notify réveille le worker après l'upload d'un document, sans attendre le
+// prochain passage périodique
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start lance le worker : il traite les documents en attente au démarrage,
+// à chaque Notify et toutes les pollEvery. Plusieurs répliques peuvent
+// tourner en même temps, chaque document n'est pris que par une seule
+func Start(db *sql.DB, pollEvery time.Duration) {
+	go func() {
+		ticker := time.NewTicker(pollEvery)
+		defer ticker.Stop()
+
+		for {
+			for {
+				processed, err := processNext(db)
+				if err != nil {
+					log.Printf("Erreur worker aperçus: %v", err)
+					break
+				}
+				if !processed {
+					break
+				}
+			}
+
+			select {
+			case <-wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// processNext génère l'aperçu d'un document en attente ; retourne false
+// s'il n'y en a aucun
+func processNext(db *sql.DB) (bool, error) {
+	var documentID, attempts int
+	var filePath string
+	err := db.QueryRow(`
+		UPDATE documents
+		SET thumbnail_status = $1, thumbnail_attempts = thumbnail_attempts + 1, thumbnail_updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM documents
+			WHERE thumbnail_status = $2
+			OR (thumbnail_status = $1 AND thumbnail_updated_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second')
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, file_path, thumbnail_attempts`,
+		StatusProcessing, StatusPending, int64(retryAfter.Seconds()),
+	).Scan(&documentID, &filePath, &attempts)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Réplique arrêtée pendant le dernier essai
+	if attempts > maxAttempts {
+		_, err = db.Exec("UPDATE documents SET thumbnail_status = $2 WHERE id = $1 AND file_path = $3", documentID, StatusFailed, filePath)
+		return true, err
+	}
+
+	thumbnailKey, err := generate(db, storage.KeyFromPath(filePath))
+	switch {
+	case err == nil:
+		result, err := db.Exec(`
+			UPDATE documents SET thumbnail_key = $2, thumbnail_status = $3, thumbnail_updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND file_path = $4`,
+			documentID, thumbnailKey, StatusReady, filePath,
+		)
+		if err != nil {
+			return true, err
+		}
+		// Document purgé ou remplacé par une nouvelle version pendant la génération
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			encryption.Delete(context.Background(), db, thumbnailKey)
+		}
+	case errors.Is(err, media.ErrUnsupported), errors.Is(err, media.ErrInvalidImage):
+		_, err = db.Exec("UPDATE documents SET thumbnail_status = $2 WHERE id = $1 AND file_path = $3", documentID, StatusUnsupported, filePath)
+		return true, err
+	case errors.Is(err, storage.ErrNotFound):
+		log.Printf("Aperçu du document %d impossible: fichier %s introuvable", documentID, filePath)
+		_, err = db.Exec("UPDATE documents SET thumbnail_status = $2 WHERE id = $1 AND file_path = $3", documentID, StatusFailed, filePath)
+		return true, err
+	default:
+		log.Printf("Aperçu du document %d impossible (essai %d/%d): %v", documentID, attempts, maxAttempts, err)
+		// Le document reste en cours et sera repris après retryAfter
+		if attempts >= maxAttempts {
+			_, err = db.Exec("UPDATE documents SET thumbnail_status = $2 WHERE id = $1 AND file_path = $3", documentID, StatusFailed, filePath)
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// generate lit le fichier, en fait un aperçu JPEG et l'enregistre sous une
+// nouvelle clé, chiffré comme le document
+func generate(db *sql.DB, key string) (string, error) {
+	ctx := context.Background()
+	reader, _, err := encryption.Get(ctx, db, key)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return "", err
+	}
+
+	thumbnail, err := media.Thumbnail(data, media.ThumbnailSize)
+	if err != nil {
+		return "", err
+	}
+
+	thumbnailKey := storage.NewKey("thumbnails", ".jpg")
+	if err := encryption.Put(ctx, db, thumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), media.JPEG); err != nil {
+		return "", err
+	}
+	return thumbnailKey, nil
+}
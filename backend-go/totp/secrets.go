@@ -0,0 +1,132 @@
+package totp
+
+import (
+	"backend-go/encryption"
+	"context"
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+)
+
+// sealedContext lie un secret chiffré à son utilisateur : il ne peut pas être
+// recopié sur un autre compte. Le secret en attente et le secret actif
+// partagent le même contexte, la confirmation recopie l'un dans l'autre
+func sealedContext(userID int) string {
+	return "users.totp_secret:" + strconv.Itoa(userID)
+}
+
+// SealSecret chiffre un secret avec la clé maître active ; sans
+// DOCUMENT_ENCRYPTION_KEYS, le secret est conservé en clair et l'identifiant
+// de clé maître retourné est nil
+func SealSecret(userID int, secret string) (*string, string, error) {
+	if !encryption.Enabled() {
+		return nil, secret, nil
+	}
+	keyID, sealed, err := encryption.Seal(sealedContext(userID), []byte(secret))
+	if err != nil {
+		return nil, "", err
+	}
+	return &keyID, sealed, nil
+}
+
+// OpenSecret retourne le secret base32 d'un secret lu en base
+func OpenSecret(userID int, keyID *string, stored string) (string, error) {
+	if keyID == nil {
+		return stored, nil
+	}
+	secret, err := encryption.Open(*keyID, sealedContext(userID), stored)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// secretColumns associe chaque colonne de secret à sa colonne de clé maître
+var secretColumns = [][2]string{
+	{"totp_secret", "totp_secret_key_id"},
+	{"totp_pending_secret", "totp_pending_secret_key_id"},
+}
+
+// Rewrap chiffre avec la clé maître active les secrets stockés en clair ou
+// sous une ancienne clé maître. Un secret illisible est signalé et laissé en
+// l'état. Retourne le nombre de secrets rechiffrés
+func Rewrap(ctx context.Context, db *sql.DB) (int, error) {
+	if !encryption.Enabled() {
+		return 0, nil
+	}
+	active := encryption.ActiveKeyID()
+
+	sealed := 0
+	for _, columns := range secretColumns {
+		secretColumn, keyColumn := columns[0], columns[1]
+		rows, err := db.QueryContext(ctx,
+			"SELECT id, "+secretColumn+", "+keyColumn+" FROM users WHERE "+secretColumn+" IS NOT NULL AND "+keyColumn+" IS DISTINCT FROM $1",
+			active,
+		)
+		if err != nil {
+			return sealed, err
+		}
+		type storedSecret struct {
+			userID int
+			stored string
+			keyID  *string
+		}
+		var pending []storedSecret
+		for rows.Next() {
+			var s storedSecret
+			if err := rows.Scan(&s.userID, &s.stored, &s.keyID); err != nil {
+				rows.Close()
+				return sealed, err
+			}
+			pending = append(pending, s)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return sealed, err
+		}
+
+		for _, s := range pending {
+			secret, err := OpenSecret(s.userID, s.keyID, s.stored)
+			if err != nil {
+				log.Printf("Rechiffrement du secret TOTP de l'utilisateur %d impossible: %v", s.userID, err)
+				continue
+			}
+			keyID, stored, err := SealSecret(s.userID, secret)
+			if err != nil {
+				return sealed, err
+			}
+			// Un secret remplacé, supprimé ou déjà rechiffré entre-temps est ignoré
+			result, err := db.ExecContext(ctx,
+				"UPDATE users SET "+secretColumn+" = $2, "+keyColumn+" = $3 WHERE id = $1 AND "+secretColumn+" = $4 AND "+keyColumn+" IS NOT DISTINCT FROM $5",
+				s.userID, stored, keyID, s.stored, s.keyID,
+			)
+			if err != nil {
+				return sealed, err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				sealed++
+			}
+		}
+	}
+	return sealed, nil
+}
+
+// Start rechiffre en arrière-plan, au démarrage puis toutes les every, les
+// secrets stockés en clair ou sous une ancienne clé maître
+func Start(db *sql.DB, every time.Duration) {
+	if !encryption.Enabled() {
+		return
+	}
+	go func() {
+		for {
+			sealed, err := Rewrap(context.Background(), db)
+			if err != nil {
+				log.Printf("Erreur rechiffrement des secrets TOTP: %v", err)
+			} else if sealed > 0 {
+				log.Printf("%d secret(s) TOTP rechiffré(s) avec la clé maître %s", sealed, encryption.ActiveKeyID())
+			}
+			time.Sleep(every)
+		}
+	}()
+}
@@ -0,0 +1,30 @@
+package totp
+
+import (
+	"backend-go/encryption"
+	"testing"
+)
+
+func TestSealSecret(t *testing.T) {
+	t.Setenv("DOCUMENT_ENCRYPTION_KEYS", "k1:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	encryption.Init()
+
+	keyID, sealed, err := SealSecret(42, rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID == nil || *keyID != "k1" || sealed == rfcSecret {
+		t.Fatalf("SealSecret = %v, %q", keyID, sealed)
+	}
+	if secret, err := OpenSecret(42, keyID, sealed); err != nil || secret != rfcSecret {
+		t.Errorf("OpenSecret = %q, %v", secret, err)
+	}
+	// Un secret recopié sur un autre compte est refusé
+	if _, err := OpenSecret(43, keyID, sealed); err == nil {
+		t.Error("secret d'un autre utilisateur accepté")
+	}
+	// Les secrets stockés avant le chiffrement restent lisibles
+	if secret, err := OpenSecret(42, nil, rfcSecret); err != nil || secret != rfcSecret {
+		t.Errorf("secret en clair = %q, %v", secret, err)
+	}
+}
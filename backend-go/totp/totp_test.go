@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Secret SHA-1 de l'annexe B de la RFC 6238, "12345678901234567890" en base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vecteurs SHA-1 de l'annexe B de la RFC 6238. La RFC donne des codes à 8
+// chiffres : les 6 derniers sont ceux d'un code à 6 chiffres
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},          // 94287082
+	{1111111109, "081804"},  // 07081804
+	{1111111111, "050471"},  // 14050471
+	{1234567890, "005924"},  // 89005924
+	{2000000000, "279037"},  // 69279037
+	{20000000000, "353130"}, // 65353130
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code(%d) = %s, attendu %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		now := time.Unix(v.unix, 0)
+		step, ok := Validate(rfcSecret, v.code, now, 0)
+		if !ok || step != Step(now) {
+			t.Errorf("Validate(%d) = %d, %v ; attendu %d, true", v.unix, step, ok, Step(now))
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code, err := Code(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now, 0)
+		accepted := offset >= -Skew && offset <= Skew
+		if ok != accepted {
+			t.Errorf("décalage %d : accepté = %v, attendu %v", offset, ok, accepted)
+		}
+		if ok && step != current+offset {
+			t.Errorf("décalage %d : pas %d retourné, attendu %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateRejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := Validate(rfcSecret, code, now, 0)
+	if !ok {
+		t.Fatal("premier usage du code refusé")
+	}
+	if _, ok := Validate(rfcSecret, code, now, step); ok {
+		t.Error("code rejoué accepté")
+	}
+	// Toujours dans la fenêtre au pas suivant, le code reste refusé
+	if _, ok := Validate(rfcSecret, code, now.Add(Period*time.Second), step); ok {
+		t.Error("code rejoué accepté au pas suivant")
+	}
+
+	// Un code d'un pas antérieur au dernier utilisé est refusé aussi
+	previous, err := Code(rfcSecret, step-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Validate(rfcSecret, previous, now, step); ok {
+		t.Error("code d'un pas déjà dépassé accepté")
+	}
+
+	// Le code du pas suivant reste utilisable
+	next, err := Code(rfcSecret, step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := Validate(rfcSecret, next, now, step); !ok || got != step+1 {
+		t.Errorf("code du pas suivant : %d, %v ; attendu %d, true", got, ok, step+1)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := Validate(rfcSecret, " 287 082 ", now, 0); !ok {
+		t.Error("code avec espaces refusé")
+	}
+	for _, code := range []string{"", "28708", "2870822", "94287082", "000000"} {
+		if _, ok := Validate(rfcSecret, code, now, 0); ok {
+			t.Errorf("code %q accepté", code)
+		}
+	}
+	if _, ok := Validate("pas du base32!", "287082", now, 0); ok {
+		t.Error("secret invalide accepté")
+	}
+}